@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,18 +19,23 @@ import (
 	"secure-ui-showcase-go/internal/database"
 	"secure-ui-showcase-go/internal/handlers"
 	"secure-ui-showcase-go/internal/i18n"
+	"secure-ui-showcase-go/internal/ipfilter"
+	"secure-ui-showcase-go/internal/mail"
 	"secure-ui-showcase-go/internal/middleware"
 	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/oidc"
 	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/telemetry"
+	"secure-ui-showcase-go/internal/webauthn"
 )
 
 const (
 	defaultPort            = "8080"
 	defaultDBPath          = "./data/secure-ui.db"
 	csrfTokenTTL           = 1 * time.Hour
-	rateLimitMax           = 100
-	rateLimitWindow        = 1 * time.Minute
+	layoutCSRFReuse        = 20 * time.Minute // well under csrfTokenTTL
 	sessionCleanupInterval = 15 * time.Minute
+	telemetryRetention     = 90 * 24 * time.Hour
 )
 
 func main() {
@@ -52,8 +62,9 @@ func main() {
 	}
 	defer database.Close(db)
 
-	// Seed sample data if database is empty
-	if err := database.SeedSampleData(db); err != nil {
+	// Seed sample data if database is empty, hashed like registered passwords
+	seedHasher := services.NewArgon2idHasher(services.DefaultArgon2idParams)
+	if err := database.SeedSampleData(db, seedHasher.Hash); err != nil {
 		log.Fatalf("Failed to seed sample data: %v", err)
 	}
 
@@ -72,17 +83,276 @@ func main() {
 	userDB := models.NewUserDatabase(db)
 	sessionDB := models.NewSessionDatabase(db)
 	loginAttemptDB := models.NewLoginAttemptDatabase(db)
-	csrfStore := middleware.NewCSRFTokenStore(ctx, csrfTokenTTL)
 
-	// behindProxy=false: do not trust X-Forwarded-For/X-Real-IP by default.
-	// Set to true only when running behind a trusted reverse proxy.
-	behindProxy := os.Getenv("BEHIND_PROXY") == "true"
-	rateLimiter := middleware.NewRateLimiter(ctx, rateLimitMax, rateLimitWindow, behindProxy)
+	// TELEMETRY_IP_HASH_KEY keys the client-IP hash stored with telemetry events.
+	// Without it a random per-process key is used and hashes won't correlate across restarts.
+	ipHashKey := []byte(os.Getenv("TELEMETRY_IP_HASH_KEY"))
+	if len(ipHashKey) == 0 {
+		log.Println("Warning: TELEMETRY_IP_HASH_KEY not set; using a random per-process key")
+		ipHashKey = make([]byte, 32)
+		if _, err := rand.Read(ipHashKey); err != nil {
+			log.Fatalf("Failed to generate IP hash key: %v", err)
+		}
+	}
+	telemetryDB := models.NewTelemetryEventDatabase(db, ipHashKey)
+	// CSRF_MODE=signed issues stateless HMAC tokens bound to the session and form
+	// action. The default stores tokens in SQLite so open forms survive restarts
+	// and machine hops.
+	var csrf middleware.CSRFProtector
+	var signedCSRF *middleware.SignedCSRF
+	if os.Getenv("CSRF_MODE") == "signed" {
+		csrfKey := []byte(os.Getenv("CSRF_SIGNING_KEY"))
+		if len(csrfKey) == 0 {
+			log.Println("Warning: CSRF_SIGNING_KEY not set; using a random per-process key")
+			csrfKey = make([]byte, 32)
+			if _, err := rand.Read(csrfKey); err != nil {
+				log.Fatalf("Failed to generate CSRF signing key: %v", err)
+			}
+		}
+		signedCSRF = middleware.NewSignedCSRF(ctx, csrfKey, csrfTokenTTL, secureCookie)
+		csrf = signedCSRF
+	} else {
+		csrf = middleware.StoreProtector{Store: middleware.NewSQLiteCSRFTokenStore(ctx, db, csrfTokenTTL, 0)}
+	}
+
+	// Forwarding headers are ignored by default. TRUSTED_PROXIES lists the proxy
+	// CIDRs whose forwarding entries are believed; BEHIND_PROXY=true without a
+	// list trusts loopback and private ranges only. FORWARDED_HEADER names the one
+	// header the proxy sets (X-Forwarded-For by default, Forwarded or X-Real-IP);
+	// the others are never read, since the proxy passes them through from the client.
+	var trustedProxies []netip.Prefix
+	if spec := os.Getenv("TRUSTED_PROXIES"); spec != "" {
+		trustedProxies, err = middleware.ParseTrustedProxies(spec)
+		if err != nil {
+			log.Fatalf("Failed to parse TRUSTED_PROXIES: %v", err)
+		}
+	} else if os.Getenv("BEHIND_PROXY") == "true" {
+		log.Println("Warning: BEHIND_PROXY set without TRUSTED_PROXIES; trusting loopback and private ranges")
+		trustedProxies = middleware.PrivateProxyRanges
+	}
+	forwardedHeader, err := middleware.ParseForwardedHeader(os.Getenv("FORWARDED_HEADER"))
+	if err != nil {
+		log.Fatalf("Failed to parse FORWARDED_HEADER: %v", err)
+	}
+	ipResolver := middleware.NewIPResolver(trustedProxies, forwardedHeader)
+
+	// Clients are bucketed by CLIENT_IPV4_PREFIX / CLIENT_IPV6_PREFIX bits (32 and 64
+	// by default) for rate limiting. IP_ALLOWLIST networks skip rate
+	// limits; IP_DENYLIST networks are refused and logged as security events.
+	clientBuckets := ipfilter.Bucketer{
+		IPv4Bits: envInt("CLIENT_IPV4_PREFIX", ipfilter.DefaultIPv4Prefix),
+		IPv6Bits: envInt("CLIENT_IPV6_PREFIX", ipfilter.DefaultIPv6Prefix),
+	}
+	ipAllow, err := ipfilter.ParsePrefixes(os.Getenv("IP_ALLOWLIST"))
+	if err != nil {
+		log.Fatalf("Failed to parse IP_ALLOWLIST: %v", err)
+	}
+	ipDeny, err := ipfilter.ParsePrefixes(os.Getenv("IP_DENYLIST"))
+	if err != nil {
+		log.Fatalf("Failed to parse IP_DENYLIST: %v", err)
+	}
+	clientAccess := ipfilter.NewList(ipAllow, ipDeny)
+	// RATE_LIMIT_BACKEND=sqlite shares rate limit state between instances
+	// that use the same database; the default keeps it in process memory.
+	var rateLimiter middleware.Limiter
+	if os.Getenv("RATE_LIMIT_BACKEND") == "sqlite" {
+		rateLimiter = middleware.NewSQLiteLimiter(ctx, db)
+	} else {
+		rateLimiter = middleware.NewMemoryLimiter(ctx)
+	}
+
+	// RATE_LIMIT_POLICIES points at a JSON policy table; see middleware.LoadRatePolicies
+	ratePolicies := middleware.DefaultRatePolicies()
+	if path := os.Getenv("RATE_LIMIT_POLICIES"); path != "" {
+		ratePolicies, err = middleware.LoadRatePolicies(path)
+		if err != nil {
+			log.Fatalf("Failed to load rate limit policies: %v", err)
+		}
+	}
 	countryService := services.NewCountryService(24 * time.Hour) // Cache for 24 hours
-	authService := services.NewAuthService(userDB, sessionDB, loginAttemptDB, 0, 0)
+
+	// Failed logins lock the account, the client IP and its subnet
+	// independently; each LOCKOUT_*_THRESHOLD failures within LOCKOUT_*_WINDOW_MINUTES
+	// starts a lock that doubles with every further failure. Subnets are
+	// LOCKOUT_SUBNET_IPV4_PREFIX / LOCKOUT_SUBNET_IPV6_PREFIX bits (24 and 48 by
+	// default), wider than the rate limiter's per-client buckets.
+	lockout := services.DefaultLockoutConfig()
+	lockout.Account.Threshold = envInt("LOCKOUT_ACCOUNT_THRESHOLD", lockout.Account.Threshold)
+	lockout.Account.Window = time.Duration(envInt("LOCKOUT_ACCOUNT_WINDOW_MINUTES", int(lockout.Account.Window/time.Minute))) * time.Minute
+	lockout.IP.Threshold = envInt("LOCKOUT_IP_THRESHOLD", lockout.IP.Threshold)
+	lockout.IP.Window = time.Duration(envInt("LOCKOUT_IP_WINDOW_MINUTES", int(lockout.IP.Window/time.Minute))) * time.Minute
+	lockout.Subnet.Threshold = envInt("LOCKOUT_SUBNET_THRESHOLD", lockout.Subnet.Threshold)
+	lockout.Subnet.Window = time.Duration(envInt("LOCKOUT_SUBNET_WINDOW_MINUTES", int(lockout.Subnet.Window/time.Minute))) * time.Minute
+	lockout.SubnetBuckets.IPv4Bits = envInt("LOCKOUT_SUBNET_IPV4_PREFIX", lockout.SubnetBuckets.IPv4Bits)
+	lockout.SubnetBuckets.IPv6Bits = envInt("LOCKOUT_SUBNET_IPV6_PREFIX", lockout.SubnetBuckets.IPv6Bits)
+	authService := services.NewAuthService(userDB, sessionDB, loginAttemptDB, lockout)
+
+	// Sessions end after SESSION_IDLE_MINUTES without a request or SESSION_ABSOLUTE_MINUTES
+	// after sign-in, and get a new token every SESSION_ROTATE_MINUTES (0 disables rotation).
+	sessionConfig := services.DefaultSessionConfig()
+	sessionConfig.IdleTimeout = time.Duration(envInt("SESSION_IDLE_MINUTES", int(sessionConfig.IdleTimeout/time.Minute))) * time.Minute
+	sessionConfig.AbsoluteTimeout = time.Duration(envInt("SESSION_ABSOLUTE_MINUTES", int(sessionConfig.AbsoluteTimeout/time.Minute))) * time.Minute
+	sessionConfig.RotateInterval = time.Duration(envInt("SESSION_ROTATE_MINUTES", int(sessionConfig.RotateInterval/time.Minute))) * time.Minute
+	authService.SetSessionConfig(sessionConfig)
+	if signedCSRF != nil {
+		// Bind signed CSRF tokens to the session rather than its rotating token
+		signedCSRF.SetSessionKey(authService.SessionKey)
+	}
+
+	// New passwords need PASSWORD_MIN_LENGTH characters and a strength score of
+	// PASSWORD_MIN_SCORE (0-4). BREACHED_PASSWORDS_FILE lists breached passwords,
+	// as plaintext or SHA-1 hashes, that are refused outright.
+	passwordPolicy := services.DefaultPasswordPolicy()
+	passwordPolicy.MinLength = envInt("PASSWORD_MIN_LENGTH", passwordPolicy.MinLength)
+	passwordPolicy.MinScore = envInt("PASSWORD_MIN_SCORE", passwordPolicy.MinScore)
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		passwordPolicy.Breached, err = services.LoadBreachedPasswords(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached passwords: %v", err)
+		}
+		log.Printf("Loaded %d breached passwords", passwordPolicy.Breached.Count)
+	}
+	authService.SetPasswordPolicy(passwordPolicy)
+	telemetryVerifier := telemetry.NewVerifier(ctx, 0)
+
+	// TELEMETRY_MASTER_SECRET derives the per-visitor telemetry signing keys.
+	// Without it a random per-process secret is used and every visitor's key
+	// changes on restart, so pages rendered before a restart fail verification.
+	masterSecret := []byte(os.Getenv("TELEMETRY_MASTER_SECRET"))
+	if len(masterSecret) == 0 {
+		log.Println("Warning: TELEMETRY_MASTER_SECRET not set; using a random per-process secret")
+		masterSecret = make([]byte, 32)
+		if _, err := rand.Read(masterSecret); err != nil {
+			log.Fatalf("Failed to generate telemetry master secret: %v", err)
+		}
+	}
+	keyRotation := time.Duration(envInt("TELEMETRY_KEY_ROTATION_MINUTES", 0)) * time.Minute
+	telemetryKeys := telemetry.NewKeyManager(masterSecret, keyRotation)
+
+	// Server-side risk scoring. RISK_MODE=enforce lets the engine refuse logins
+	// it scores at or above the challenge threshold; the default only logs
+	// assessments. RISK_RULES_FILE overrides the signal weights; the threshold
+	// variables override the file.
+	riskRules := telemetry.DefaultRiskRules()
+	if path := os.Getenv("RISK_RULES_FILE"); path != "" {
+		riskRules, err = telemetry.LoadRiskRules(path)
+		if err != nil {
+			log.Fatalf("Failed to load risk rules: %v", err)
+		}
+	}
+	riskRules.ChallengeThreshold = envInt("RISK_CHALLENGE_THRESHOLD", riskRules.ChallengeThreshold)
+	riskRules.BlockThreshold = envInt("RISK_BLOCK_THRESHOLD", riskRules.BlockThreshold)
+	if err := riskRules.Validate(); err != nil {
+		log.Fatalf("Invalid risk rules: %v", err)
+	}
+	riskEngine := telemetry.NewRiskEngine(riskRules)
+	authService.SetRiskMode(services.RiskMode(os.Getenv("RISK_MODE")))
+	authService.SetClientFilter(clientBuckets, clientAccess)
+
+	// MFA_ENCRYPTION_KEY encrypts TOTP secrets at rest. Without it a random
+	// per-process key is used and enrolled authenticators stop working on restart.
+	mfaKey := []byte(os.Getenv("MFA_ENCRYPTION_KEY"))
+	if len(mfaKey) == 0 {
+		log.Println("Warning: MFA_ENCRYPTION_KEY not set; using a random per-process key")
+		mfaKey = make([]byte, 32)
+		if _, err := rand.Read(mfaKey); err != nil {
+			log.Fatalf("Failed to generate MFA encryption key: %v", err)
+		}
+	}
+	if err := authService.SetMFA(models.NewMFADatabase(db), mfaKey); err != nil {
+		log.Fatalf("Failed to configure MFA: %v", err)
+	}
+
+	// Passkeys are scoped to WEBAUTHN_RP_ID (the site's registrable domain) and
+	// accepted only from the exact origins in WEBAUTHN_ORIGINS (comma-separated)
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	var rpOrigins []string
+	for _, o := range strings.Split(os.Getenv("WEBAUTHN_ORIGINS"), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			rpOrigins = append(rpOrigins, o)
+		}
+	}
+	if len(rpOrigins) == 0 {
+		scheme := "http"
+		if secureCookie {
+			scheme = "https"
+		}
+		rpOrigins = []string{scheme + "://localhost:" + port}
+	}
+	authService.SetPasskeys(
+		&webauthn.RelyingParty{ID: rpID, Name: "Secure-UI", Origins: rpOrigins},
+		models.NewWebAuthnCredentialDatabase(db),
+		middleware.NewSQLiteChallengeStore(ctx, db, webauthn.DefaultTimeout, 0),
+	)
+
+	// Password reset, verification and sign-in links are built from APP_BASE_URL and
+	// delivered through MAIL_TRANSPORT: "file" (default, .eml files in MAIL_DIR
+	// next to the database), "smtp" or "memory"
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = rpOrigins[0]
+	}
+	mailer, err := newMailer(filepath.Join(dbDir, "mail"))
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	authService.SetMailer(mailer, baseURL)
+	authService.SetPasswordReset(models.NewPasswordResetDatabase(db))
+	authService.SetMagicLinks(models.NewMagicLinkDatabase(db))
+	authService.SetAPITokens(models.NewAPITokenDatabase(db))
+
+	// Single sign-on through an OpenID provider is on when OIDC_ISSUER and
+	// OIDC_CLIENT_ID are set. The provider must allow the redirect URI
+	// APP_BASE_URL + /login/oidc/callback.
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		clientID := os.Getenv("OIDC_CLIENT_ID")
+		if clientID == "" {
+			log.Fatal("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+		}
+		scopes := strings.Fields(os.Getenv("OIDC_SCOPES"))
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+		name := os.Getenv("OIDC_PROVIDER_NAME")
+		if name == "" {
+			name = "SSO"
+		}
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  strings.TrimRight(baseURL, "/") + "/login/oidc/callback",
+			Scopes:       scopes,
+		}, nil)
+		authService.SetOIDC(provider, name, models.NewOIDCDatabase(db))
+	}
+
+	// EMAIL_VERIFICATION=true keeps new accounts pending until the emailed link
+	// is opened. EMAIL_VERIFICATION_KEY signs the links; without it a random
+	// per-process key is used and outstanding links stop working on restart.
+	if os.Getenv("EMAIL_VERIFICATION") == "true" {
+		verifyKey := []byte(os.Getenv("EMAIL_VERIFICATION_KEY"))
+		if len(verifyKey) == 0 {
+			log.Println("Warning: EMAIL_VERIFICATION_KEY not set; using a random per-process key")
+			verifyKey = make([]byte, 32)
+			if _, err := rand.Read(verifyKey); err != nil {
+				log.Fatalf("Failed to generate email verification key: %v", err)
+			}
+		}
+		if err := authService.SetEmailVerification(verifyKey); err != nil {
+			log.Fatalf("Failed to configure email verification: %v", err)
+		}
+	}
+
+	// Role-based access control: permissions granted to each role are kept in
+	// the database and edited on /admin/roles
+	authz := services.NewAuthorizer(models.NewRoleDatabase(db))
 
 	// Create handlers with dependencies injected
-	h := handlers.NewHandlers(userDB, csrfStore, countryService, authService, secureCookie)
+	h := handlers.NewHandlers(userDB, csrf, countryService, authService, authz, telemetryVerifier, telemetryKeys, riskEngine, telemetryDB, secureCookie)
 
 	go func() {
 		ticker := time.NewTicker(sessionCleanupInterval)
@@ -93,6 +363,11 @@ func main() {
 				return
 			case <-ticker.C:
 				authService.CleanupExpiredSessions()
+				if n, err := telemetryDB.DeleteOlderThan(telemetryRetention); err != nil {
+					log.Printf("Failed to prune telemetry events: %v", err)
+				} else if n > 0 {
+					log.Printf("Pruned %d telemetry events", n)
+				}
 			}
 		}
 	}()
@@ -100,8 +375,15 @@ func main() {
 	// Auth middleware factories
 	optAuth := middleware.OptionalAuth(authService, secureCookie)
 	reqAuth := middleware.RequireAuth(authService, secureCookie)
-	// Note: API route authorization (auth + admin checks) is enforced inside
-	// individual handlers because GET and mutating methods share the same mux pattern.
+	// requirePerm declares the permission a page route needs; use after reqAuth
+	requirePerm := func(permission string) func(http.Handler) http.Handler {
+		return middleware.RequirePermission(authz, permission, h.RenderErrorPage)
+	}
+	// API routes share one mux pattern between GET and mutating methods, so the
+	// permission is declared on each method's handler instead of the route
+	requirePermAPI := func(permission string, next http.HandlerFunc) http.Handler {
+		return middleware.RequirePermissionAPI(authz, permission)(next)
+	}
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
@@ -127,7 +409,7 @@ func main() {
 	mux.HandleFunc("/cookies", h.CookiePolicy)
 
 	// --- Auth routes ---
-	mux.Handle("/login", middleware.CSRF(csrfStore, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/login", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			h.LoginPage(w, r)
 		} else if r.Method == http.MethodPost {
@@ -137,7 +419,42 @@ func main() {
 		}
 	}))))
 
-	mux.Handle("/register", middleware.CSRF(csrfStore, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/login/mfa", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.LoginMFAPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.LoginMFASubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// Single sign-on: GET only, and bound to the browser by the state cookie
+	// rather than a CSRF token, since the callback comes from the provider
+	mux.Handle("/login/oidc", optAuth(http.HandlerFunc(h.OIDCLogin)))
+	mux.HandleFunc("/login/oidc/callback", h.OIDCCallback)
+
+	mux.Handle("/login/magic-link", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.MagicLinkPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.MagicLinkSubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/login/magic-link/verify", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.MagicLinkVerifyPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.MagicLinkVerifySubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/register", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			h.RegisterPage(w, r)
 		} else if r.Method == http.MethodPost {
@@ -147,7 +464,45 @@ func main() {
 		}
 	}))))
 
-	mux.Handle("/logout", middleware.CSRF(csrfStore, h.RenderErrorPage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/forgot-password", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.ForgotPasswordPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.ForgotPasswordSubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/reset-password", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.ResetPasswordPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.ResetPasswordSubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/verify-email", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			h.VerifyEmailPage(w, r)
+		} else if r.Method == http.MethodPost {
+			h.VerifyEmailSubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/verify-email/resend", middleware.CSRF(csrf, h.RenderErrorPage)(optAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			h.ResendVerificationSubmit(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	mux.Handle("/logout", middleware.CSRF(csrf, h.RenderErrorPage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			h.LogoutSubmit(w, r)
 		} else {
@@ -159,13 +514,20 @@ func main() {
 	mux.Handle("/dashboard", reqAuth(http.HandlerFunc(h.Dashboard)))
 	mux.Handle("/table", reqAuth(http.HandlerFunc(h.Table)))
 	mux.Handle("/profile", reqAuth(http.HandlerFunc(h.ProfilePage)))
-	mux.Handle("/profile/password", middleware.CSRF(csrfStore, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ChangePassword))))
+	mux.Handle("/profile/password", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ChangePassword))))
+	mux.Handle("/profile/mfa", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ProfileMFA))))
+	mux.Handle("/profile/passkeys", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ProfilePasskeys))))
+	mux.Handle("/profile/sessions", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ProfileSessions))))
+	mux.Handle("/profile/tokens", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.ProfileAPITokens))))
+
+	// --- Admin page routes (each declares the permission it requires) ---
+	mux.Handle("/admin/telemetry", reqAuth(requirePerm(models.PermTelemetryView)(http.HandlerFunc(h.AdminTelemetry))))
+	mux.Handle("/admin/roles", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(requirePerm(models.PermRolesManage)(http.HandlerFunc(h.AdminRoles)))))
 
 	// --- Form submission routes (with CSRF protection) ---
-	userFormMux := http.NewServeMux()
-	userFormMux.HandleFunc("/users", h.CreateUserFromForm)
-	mux.Handle("/users", middleware.CSRF(csrfStore, h.RenderErrorPage)(userFormMux))
-	mux.Handle("/users/delete", middleware.CSRF(csrfStore, h.RenderErrorPage)(reqAuth(http.HandlerFunc(h.DeleteUserFromForm))))
+	mux.Handle("/users", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(requirePerm(models.PermUsersCreate)(http.HandlerFunc(h.CreateUserFromForm)))))
+	mux.Handle("/users/delete", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(requirePerm(models.PermUsersDelete)(http.HandlerFunc(h.DeleteUserFromForm)))))
+	mux.Handle("/users/verify", middleware.CSRF(csrf, h.RenderErrorPage)(reqAuth(requirePerm(models.PermUsersVerify)(http.HandlerFunc(h.VerifyUserFromForm)))))
 
 	// --- API routes ---
 	// Public read-only endpoints (no auth required)
@@ -183,40 +545,50 @@ func main() {
 	apiMux.HandleFunc("/api/demo/component-submit", h.DemoComponentSubmitHandler)
 
 	// GET /api/users — public read (visitors may view)
-	// POST /api/users — requires auth
+	// POST /api/users — requires users.create
+	createUser := requirePermAPI(models.PermUsersCreate, h.CreateUser)
 	apiMux.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			h.GetUsers(w, r)
 		} else if r.Method == http.MethodPost {
-			// Auth enforced inside handler
-			h.CreateUser(w, r)
+			createUser.ServeHTTP(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
-	// /api/users/{id} — GET is public, PUT/PATCH requires auth (self-only), DELETE requires admin
+	// /api/users/{id} — GET is public, PUT/PATCH requires users.update (the
+	// handler checks own-account grants against the user), DELETE requires users.delete
+	updateUser := requirePermAPI(models.PermUsersUpdate, h.UpdateUser)
+	deleteUser := requirePermAPI(models.PermUsersDelete, h.DeleteUser)
 	apiMux.HandleFunc("/api/users/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			h.GetUser(w, r)
 		} else if r.Method == http.MethodPut || r.Method == http.MethodPatch {
-			// Auth enforced inside handler (self-only check)
-			h.UpdateUser(w, r)
+			updateUser.ServeHTTP(w, r)
 		} else if r.Method == http.MethodDelete {
-			// Auth enforced inside handler (admin-only check)
-			h.DeleteUser(w, r)
+			deleteUser.ServeHTTP(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 
+	// Passkey ceremonies — register requires a browser session (enforced inside handlers)
+	apiMux.HandleFunc("/api/webauthn/register/begin", h.PasskeyRegisterBegin)
+	apiMux.HandleFunc("/api/webauthn/register/finish", h.PasskeyRegisterFinish)
+	apiMux.HandleFunc("/api/webauthn/login/begin", h.PasskeyLoginBegin)
+	apiMux.HandleFunc("/api/webauthn/login/finish", h.PasskeyLoginFinish)
+
 	// Apply CSRF + auth middleware to API routes
-	// reqAuthAPI wraps mutating handlers; read handlers remain public
-	mux.Handle("/api/", middleware.CSRF(csrfStore, h.RenderErrorPage)(
-		optAuth(apiMux),
+	// reqAuthAPI wraps mutating handlers; read handlers remain public.
+	// A bearer API token authenticates the request instead of the session
+	// cookie and exempts it from CSRF; every such request is audited.
+	mux.Handle("/api/", middleware.APITokenAuth(authService)(
+		middleware.CSRF(csrf, h.RenderErrorPage)(
+			optAuth(apiMux),
+		),
 	))
 
-
 	// Language switcher — sets lang cookie and redirects; no CSRF needed
 	mux.HandleFunc("/lang", h.SetLanguage)
 
@@ -263,13 +635,22 @@ func main() {
 	})))
 
 	// Apply middleware chain
-	// Order matters: Compress (br/gzip) -> Security headers -> Site URL -> Layout CSRF -> Locale -> Rate limiting -> Routes
+	// Order matters: Compress (br/gzip) -> Security headers -> Client IP -> Site URL -> Layout CSRF -> Locale -> Rate limiting -> Routes
 	handler := middleware.Compress(
 		middleware.SecurityHeadersWithHSTS(secureCookie)(
-			middleware.InjectSiteURL(secureCookie)(
-				middleware.InjectLayoutCSRF(csrfStore)(
-					i18n.Middleware(
-						middleware.RateLimit(rateLimiter, h.RenderErrorPage)(mux),
+			middleware.ResolveClientIP(ipResolver)(
+				middleware.InjectSiteURL(secureCookie)(
+					middleware.InjectLayoutCSRF(ctx, csrf, layoutCSRFReuse, secureCookie)(
+						i18n.Middleware(
+							middleware.RateLimit(middleware.RateLimitConfig{
+								Limiter:      rateLimiter,
+								Policies:     ratePolicies,
+								Buckets:      clientBuckets,
+								Access:       clientAccess,
+								SecureCookie: secureCookie,
+								UserKey:      authService.SessionUserKey,
+							}, h.RenderErrorPage)(mux),
+						),
 					),
 				),
 			),
@@ -309,3 +690,46 @@ func main() {
 
 	log.Println("Server stopped gracefully")
 }
+
+// newMailer builds the transport selected by MAIL_TRANSPORT
+func newMailer(defaultDir string) (mail.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Secure-UI <no-reply@localhost>"
+	}
+
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "", "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = defaultDir
+		}
+		log.Printf("Mail: writing messages to %s", dir)
+		return mail.NewFileMailer(dir, from)
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST is required when MAIL_TRANSPORT=smtp")
+		}
+		return mail.NewSMTPMailer(host, envInt("SMTP_PORT", 587), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "memory":
+		log.Println("Warning: MAIL_TRANSPORT=memory; emails are kept in memory and never delivered")
+		return mail.NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", transport)
+	}
+}
+
+// envInt reads an integer environment variable, returning def when unset or invalid
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Warning: ignoring invalid %s=%q", name, v)
+		return def
+	}
+	return n
+}
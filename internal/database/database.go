@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	_ "modernc.org/sqlite" // Pure Go SQLite driver (no CGO required)
 
-	"golang.org/x/crypto/bcrypt"
+	"secure-ui-showcase-go/internal/models"
 )
 
 // InitDatabase initializes the SQLite database connection and creates tables
@@ -35,6 +36,7 @@ func InitDatabase(dbPath string) (*sql.DB, error) {
 		"PRAGMA journal_mode=WAL",    // Write-Ahead Logging for concurrent reads
 		"PRAGMA foreign_keys=ON",     // Enforce foreign key constraints
 		"PRAGMA secure_delete=ON",    // Zero-fill deleted data on disk
+		"PRAGMA busy_timeout=5000",   // Wait for other instances' writes instead of failing with SQLITE_BUSY
 	}
 	for _, p := range pragmas {
 		if _, err := db.Exec(p); err != nil {
@@ -52,25 +54,29 @@ func InitDatabase(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
-// createSchema creates the database tables if they don't exist
-func createSchema(db *sql.DB) error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
+// usersColumns defines the users table; rebuildUsersTable reuses it
+const usersColumns = `
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		first_name TEXT NOT NULL,
 		last_name TEXT NOT NULL,
 		email TEXT NOT NULL UNIQUE,
 		password_hash TEXT NOT NULL DEFAULT '',
-		role TEXT NOT NULL CHECK(role IN ('admin', 'moderator', 'user')),
+		role TEXT NOT NULL REFERENCES roles(name),
 		status TEXT NOT NULL CHECK(status IN ('active', 'inactive', 'pending')),
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-	);
+	`
 
+// usersIndexes indexes the users table
+const usersIndexes = `
 	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 	CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
 	CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
 	`
 
+// createSchema creates the database tables if they don't exist
+func createSchema(db *sql.DB) error {
+	schema := "CREATE TABLE IF NOT EXISTS users (" + usersColumns + ");" + usersIndexes
+
 	if _, err := db.Exec(schema); err != nil {
 		return fmt.Errorf("failed to execute users schema: %w", err)
 	}
@@ -84,19 +90,71 @@ func createSchema(db *sql.DB) error {
 		log.Println("Added password_hash column to users table")
 	}
 
-	// Sessions table for auth
+	// Role-based access control: each role holds a set of permissions, each
+	// granted for all resources or only the user's own (scope 'all' or 'own').
+	// Built-in roles cannot be deleted; admins can add others from the UI.
+	rbacSchema := `
+	CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		built_in INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS permissions (
+		name TEXT PRIMARY KEY,
+		description TEXT NOT NULL DEFAULT '',
+		ownable INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE IF NOT EXISTS role_permissions (
+		role TEXT NOT NULL,
+		permission TEXT NOT NULL,
+		scope TEXT NOT NULL CHECK(scope IN ('all', 'own')),
+		PRIMARY KEY (role, permission),
+		FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE,
+		FOREIGN KEY (permission) REFERENCES permissions(name) ON DELETE CASCADE
+	);
+	INSERT OR IGNORE INTO roles (name, description, built_in) VALUES
+		('admin', 'Full access, including user and role management', 1),
+		('moderator', 'Reviews accounts and risk telemetry', 1),
+		('user', 'Default role for new accounts', 1);
+	`
+	if _, err := db.Exec(rbacSchema); err != nil {
+		return fmt.Errorf("failed to create rbac schema: %w", err)
+	}
+	if err := seedPermissions(db); err != nil {
+		return fmt.Errorf("failed to seed permissions: %w", err)
+	}
+
+	// Migration: older databases limit users.role to three names with a CHECK,
+	// which SQLite can only drop by rebuilding the table
+	var usersSQL string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&usersSQL); err != nil {
+		return fmt.Errorf("failed to read users schema: %w", err)
+	}
+	if strings.Contains(usersSQL, "CHECK(role IN") {
+		if err := rebuildUsersTable(db); err != nil {
+			return fmt.Errorf("failed to remove users role check: %w", err)
+		}
+		log.Println("Replaced users role check with a reference to the roles table")
+	}
+
+	// Sessions table for auth. Only a hash of each session token is stored
+	// (models.HashToken), so a copy of the database cannot hijack sessions.
+	// prev_token_hash keeps the token replaced at rotated_at valid for a short
+	// grace window, so requests already in flight with it do not fail.
 	sessionsSchema := `
 	CREATE TABLE IF NOT EXISTS sessions (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INTEGER NOT NULL,
-		token TEXT NOT NULL UNIQUE,
+		token_hash TEXT NOT NULL UNIQUE,
 		ip_address TEXT NOT NULL,
 		user_agent TEXT NOT NULL DEFAULT '',
 		expires_at DATETIME NOT NULL,
 		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME,
+		prev_token_hash TEXT,
+		rotated_at DATETIME,
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 	);
-	CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 	CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 	CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 	`
@@ -104,12 +162,43 @@ func createSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to create sessions schema: %w", err)
 	}
 
+	// Migration: older databases stored raw session tokens in a token column
+	if _, err := db.Exec("SELECT token FROM sessions LIMIT 1"); err == nil {
+		if err := hashSessionTokens(db); err != nil {
+			return fmt.Errorf("failed to hash session tokens: %w", err)
+		}
+	}
+
+	// Additive migration: add last_seen_at for the devices list if upgrading from old schema.
+	// It stays NULL until the session is next used; readers fall back to created_at.
+	if _, err := db.Exec("SELECT last_seen_at FROM sessions LIMIT 1"); err != nil {
+		if _, err := db.Exec("ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME"); err != nil {
+			return fmt.Errorf("failed to add last_seen_at column: %w", err)
+		}
+		log.Println("Added last_seen_at column to sessions table")
+	}
+
+	// Additive migration: add token rotation columns if upgrading from old schema
+	if _, err := db.Exec("SELECT prev_token_hash FROM sessions LIMIT 1"); err != nil {
+		if _, err := db.Exec("ALTER TABLE sessions ADD COLUMN prev_token_hash TEXT"); err != nil {
+			return fmt.Errorf("failed to add prev_token_hash column: %w", err)
+		}
+		if _, err := db.Exec("ALTER TABLE sessions ADD COLUMN rotated_at DATETIME"); err != nil {
+			return fmt.Errorf("failed to add rotated_at column: %w", err)
+		}
+		log.Println("Added token rotation columns to sessions table")
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_sessions_prev_token_hash ON sessions(prev_token_hash)"); err != nil {
+		return fmt.Errorf("failed to create sessions prev_token_hash index: %w", err)
+	}
+
 	// Login attempts table for account lockout and audit
 	loginAttemptsSchema := `
 	CREATE TABLE IF NOT EXISTS login_attempts (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		email TEXT NOT NULL,
 		ip_address TEXT NOT NULL,
+		ip_bucket TEXT NOT NULL DEFAULT '',
 		user_agent TEXT NOT NULL DEFAULT '',
 		success INTEGER NOT NULL DEFAULT 0,
 		attempted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
@@ -122,20 +211,369 @@ func createSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to create login_attempts schema: %w", err)
 	}
 
+	// Additive migration: add ip_bucket for subnet lockout if upgrading from old schema
+	if _, err := db.Exec("SELECT ip_bucket FROM login_attempts LIMIT 1"); err != nil {
+		if _, err := db.Exec("ALTER TABLE login_attempts ADD COLUMN ip_bucket TEXT NOT NULL DEFAULT ''"); err != nil {
+			return fmt.Errorf("failed to add ip_bucket column: %w", err)
+		}
+		log.Println("Added ip_bucket column to login_attempts table")
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_login_attempts_ip_bucket ON login_attempts(ip_bucket)"); err != nil {
+		return fmt.Errorf("failed to create login_attempts ip_bucket index: %w", err)
+	}
+
+	// Telemetry events table for risk-threshold tuning (IP stored only as a keyed hash)
+	telemetryEventsSchema := `
+	CREATE TABLE IF NOT EXISTS telemetry_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		form_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		risk_score INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		signals TEXT NOT NULL DEFAULT '[]',
+		ip_hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_telemetry_events_created_at ON telemetry_events(created_at);
+	CREATE INDEX IF NOT EXISTS idx_telemetry_events_form_id ON telemetry_events(form_id);
+	`
+	if _, err := db.Exec(telemetryEventsSchema); err != nil {
+		return fmt.Errorf("failed to create telemetry_events schema: %w", err)
+	}
+
+	// CSRF tokens table so tokens survive restarts and are shared between instances
+	csrfTokensSchema := `
+	CREATE TABLE IF NOT EXISTS csrf_tokens (
+		token_hash TEXT PRIMARY KEY,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_csrf_tokens_expires_at ON csrf_tokens(expires_at);
+	`
+	if _, err := db.Exec(csrfTokensSchema); err != nil {
+		return fmt.Errorf("failed to create csrf_tokens schema: %w", err)
+	}
+
+	// Rate limit state shared between instances (one GCRA timestamp per key)
+	rateLimitsSchema := `
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		tat INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_rate_limits_tat ON rate_limits(tat);
+	`
+	if _, err := db.Exec(rateLimitsSchema); err != nil {
+		return fmt.Errorf("failed to create rate_limits schema: %w", err)
+	}
+
+	// TOTP second factor: the secret is stored AES-GCM encrypted, recovery codes
+	// and pending-login challenge tokens only as SHA-256 hashes
+	mfaSchema := `
+	CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id INTEGER PRIMARY KEY,
+		secret BLOB NOT NULL,
+		enabled INTEGER NOT NULL DEFAULT 0,
+		last_step INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+	CREATE TABLE IF NOT EXISTS mfa_challenges (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
+	`
+	if _, err := db.Exec(mfaSchema); err != nil {
+		return fmt.Errorf("failed to create mfa schema: %w", err)
+	}
+
+	// WebAuthn passkeys: public keys are stored as the authenticator's COSE
+	// encoding; webauthn_users holds the random user handle authenticators
+	// store in place of the user ID. Ceremony challenges mirror csrf_tokens.
+	webauthnSchema := `
+	CREATE TABLE IF NOT EXISTS webauthn_users (
+		user_id INTEGER PRIMARY KEY,
+		user_handle BLOB NOT NULL UNIQUE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS webauthn_credentials (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		credential_id BLOB NOT NULL UNIQUE,
+		public_key BLOB NOT NULL,
+		sign_count INTEGER NOT NULL DEFAULT 0,
+		name TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+	CREATE TABLE IF NOT EXISTS webauthn_challenges (
+		token_hash TEXT PRIMARY KEY,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+	`
+	if _, err := db.Exec(webauthnSchema); err != nil {
+		return fmt.Errorf("failed to create webauthn schema: %w", err)
+	}
+
+	// Password reset tokens, stored only as SHA-256 hashes
+	passwordResetSchema := `
+	CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+	CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
+	`
+	if _, err := db.Exec(passwordResetSchema); err != nil {
+		return fmt.Errorf("failed to create password_reset_tokens schema: %w", err)
+	}
+
+	// Passwordless sign-in links. The token and the nonce kept in the
+	// requesting browser's cookie are stored only as SHA-256 hashes.
+	magicLinkSchema := `
+	CREATE TABLE IF NOT EXISTS magic_link_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		nonce_hash TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_user_id ON magic_link_tokens(user_id);
+	CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_expires_at ON magic_link_tokens(expires_at);
+	`
+	if _, err := db.Exec(magicLinkSchema); err != nil {
+		return fmt.Errorf("failed to create magic_link_tokens schema: %w", err)
+	}
+
+	// External OpenID Connect identities linked to users, and sign-ins sent to
+	// the provider but not finished yet (state stored only as a SHA-256 hash)
+	oidcSchema := `
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		issuer TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_login_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (issuer, subject),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+	CREATE TABLE IF NOT EXISTS oidc_login_states (
+		state_hash TEXT PRIMARY KEY,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		expires_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_oidc_login_states_expires_at ON oidc_login_states(expires_at);
+	`
+	if _, err := db.Exec(oidcSchema); err != nil {
+		return fmt.Errorf("failed to create oidc schema: %w", err)
+	}
+
+	// Personal API tokens, stored only as SHA-256 hashes. Every request made
+	// with one is recorded in api_token_uses, which outlives revoked tokens.
+	apiTokensSchema := `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_expires_at ON api_tokens(expires_at);
+	CREATE TABLE IF NOT EXISTS api_token_uses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		ip_address TEXT NOT NULL,
+		used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_token_uses_token_id ON api_token_uses(token_id);
+	CREATE INDEX IF NOT EXISTS idx_api_token_uses_used_at ON api_token_uses(used_at);
+	`
+	if _, err := db.Exec(apiTokensSchema); err != nil {
+		return fmt.Errorf("failed to create api_tokens schema: %w", err)
+	}
+
 	return nil
 }
 
-// hashPassword creates a bcrypt hash for seed data
-func hashPassword(password string) string {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// hashSessionTokens replaces each raw token in the old sessions.token column
+// with its hash and renames the column to token_hash, in one transaction so a
+// crash cannot leave a mix of raw and hashed tokens. Signed-in users stay signed in.
+func hashSessionTokens(db *sql.DB) error {
+	tx, err := db.Begin()
 	if err != nil {
-		log.Fatalf("failed to hash seed password: %v", err)
+		return err
 	}
-	return string(hash)
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, token FROM sessions")
+	if err != nil {
+		return err
+	}
+	hashes := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		hashes[id] = models.HashToken(token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, hash := range hashes {
+		if _, err := tx.Exec("UPDATE sessions SET token = ? WHERE id = ?", hash, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DROP INDEX IF EXISTS idx_sessions_token"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("ALTER TABLE sessions RENAME COLUMN token TO token_hash"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Hashed %d stored session tokens", len(hashes))
+	return nil
+}
+
+// defaultPermissions lists the permissions the application checks, with the
+// built-in roles that get each one when it is first added. Later changes made
+// from the roles page are kept; only new permissions are granted here.
+var defaultPermissions = []struct {
+	name        string
+	description string
+	ownable     bool
+	grants      map[string]string
+}{
+	{models.PermUsersCreate, "Add users", false,
+		map[string]string{"admin": models.ScopeAll, "moderator": models.ScopeAll, "user": models.ScopeAll}},
+	{models.PermUsersUpdate, "Edit names and email addresses", true,
+		map[string]string{"admin": models.ScopeAll, "moderator": models.ScopeOwn, "user": models.ScopeOwn}},
+	{models.PermUsersAssignRole, "Change a user's role and status", false,
+		map[string]string{"admin": models.ScopeAll}},
+	{models.PermUsersDelete, "Delete users", false,
+		map[string]string{"admin": models.ScopeAll}},
+	{models.PermUsersVerify, "Activate accounts waiting for email verification", false,
+		map[string]string{"admin": models.ScopeAll, "moderator": models.ScopeAll}},
+	{models.PermTelemetryView, "View telemetry analytics", false,
+		map[string]string{"admin": models.ScopeAll, "moderator": models.ScopeAll}},
+	{models.PermRolesManage, "Edit roles and their permissions", false,
+		map[string]string{"admin": models.ScopeAll}},
 }
 
-// SeedSampleData inserts sample users if the table is empty
-func SeedSampleData(db *sql.DB) error {
+// seedPermissions adds missing permissions and their default grants
+func seedPermissions(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range defaultPermissions {
+		result, err := tx.Exec(
+			"INSERT OR IGNORE INTO permissions (name, description, ownable) VALUES (?, ?, ?)",
+			p.name, p.description, p.ownable)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		for role, scope := range p.grants {
+			if _, err := tx.Exec(
+				"INSERT OR IGNORE INTO role_permissions (role, permission, scope) VALUES (?, ?, ?)",
+				role, p.name, scope); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// rebuildUsersTable recreates the users table from usersColumns, copying every
+// row, following SQLite's procedure for changes ALTER TABLE cannot make.
+// Foreign keys are off meanwhile so dropping the old table does not cascade
+// to sessions and the other tables that reference users.
+func rebuildUsersTable(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA foreign_keys=OFF"); err != nil {
+		return err
+	}
+	defer db.Exec("PRAGMA foreign_keys=ON")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const columns = "id, first_name, last_name, email, password_hash, role, status, created_at"
+	for _, stmt := range []string{
+		"CREATE TABLE users_new (" + usersColumns + ")",
+		"INSERT INTO users_new (" + columns + ") SELECT " + columns + " FROM users",
+		"DROP TABLE users",
+		"ALTER TABLE users_new RENAME TO users",
+		usersIndexes,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// Every user's role must exist in roles before the new reference is relied on
+	var violations int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check('users')").Scan(&violations); err != nil {
+		return err
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d users have a role missing from the roles table", violations)
+	}
+	return tx.Commit()
+}
+
+// SeedSampleData inserts sample users if the table is empty. hashPassword is
+// the application's password hasher, so seeded hashes match the ones written
+// at registration.
+func SeedSampleData(db *sql.DB, hashPassword func(password string) (string, error)) error {
 	// Check if data already exists
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
@@ -156,7 +594,10 @@ func SeedSampleData(db *sql.DB) error {
 		log.Println("Warning: SEED_PASSWORD not set; using insecure default — set SEED_PASSWORD in production")
 		seedPassword = "password123"
 	}
-	defaultHash := hashPassword(seedPassword)
+	defaultHash, err := hashPassword(seedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash seed password: %w", err)
+	}
 
 	sampleUsers := []struct {
 		firstName    string
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/templates/pages"
+)
+
+const (
+	defaultTelemetryDays = 7
+	maxTelemetryDays     = 90
+	topTelemetrySignals  = 10
+)
+
+// AdminTelemetry renders the telemetry analytics dashboard
+// (GET /admin/telemetry, requires telemetry.view, enforced on the route).
+// The optional ?days= query parameter selects the reporting window (1–90, default 7).
+func (h *Handlers) AdminTelemetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.RenderErrorPage(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultTelemetryDays
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d >= 1 && d <= maxTelemetryDays {
+		days = d
+	}
+
+	stats, err := h.TelemetryDB.Stats(time.Duration(days)*24*time.Hour, topTelemetrySignals)
+	if err != nil {
+		log.Printf("failed to load telemetry stats: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	pages.AdminTelemetry(stats, days, h.Risk.Rules()).Render(r.Context(), w)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+)
+
+// ProfileAPITokens manages personal API tokens from the profile page
+// (POST /profile/tokens). op=create issues a token limited to the chosen
+// scopes, each of which the user's role must hold, and shows it once;
+// op=revoke deletes the token with the given id.
+func (h *Handlers) ProfileAPITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	switch r.FormValue("op") {
+	case "create":
+		var view pages.ProfileAPITokens
+		scopes := r.Form["scope"]
+		for _, scope := range scopes {
+			if !h.Authz.Has(user, scope) {
+				http.Error(w, "Invalid scope", http.StatusBadRequest)
+				return
+			}
+		}
+		days, err := strconv.Atoi(r.FormValue("lifetime"))
+		if err != nil || !slices.Contains(services.APITokenLifetimes, days) {
+			http.Error(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+
+		view.NewToken, _, err = h.AuthService.CreateAPIToken(user, r.FormValue("name"), scopes, time.Duration(days)*24*time.Hour)
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrAPITokenInvalid):
+			view.Message = "Choose at least one scope."
+		case errors.Is(err, services.ErrAPITokenLimit):
+			view.Message = "You have too many API tokens. Revoke one you no longer use first."
+		default:
+			log.Printf("failed to create api token for user %d: %v", user.ID, err)
+			view.Message = "Unable to create the token. Please try again."
+		}
+		// Rendered rather than redirected: the token exists nowhere else
+		h.renderProfile(w, r, user, pages.ProfileMFA{}, view, pages.ProfilePassword{})
+		return
+	case "revoke":
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+		// A token that is already gone needs no message; the list shows the result
+		if err := h.AuthService.RevokeAPIToken(user.ID, id); err != nil && !errors.Is(err, models.ErrNotFound) {
+			log.Printf("failed to revoke api token %d for user %d: %v", id, user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Unknown operation", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// apiTokenScopes returns the permissions user could put on a token
+func (h *Handlers) apiTokenScopes(user *models.User) ([]*models.Permission, error) {
+	perms, err := h.Authz.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]*models.Permission, 0, len(perms))
+	for _, p := range perms {
+		if h.Authz.Has(user, p.Name) {
+			scopes = append(scopes, p)
+		}
+	}
+	return scopes, nil
+}
@@ -1,18 +1,21 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
 	"secure-ui-showcase-go/internal/services"
 	"secure-ui-showcase-go/internal/templates/pages"
 	"secure-ui-showcase-go/internal/validation"
 )
 
-const sessionCookieMaxAge = 86400 // 24 hours
-
 func (h *Handlers) cookieName() string {
 	return middleware.SessionCookieName(h.SecureCookie)
 }
@@ -23,7 +26,7 @@ func (h *Handlers) setSessionCookie(w http.ResponseWriter, token string) {
 		Name:     h.cookieName(),
 		Value:    token,
 		Path:     "/",
-		MaxAge:   sessionCookieMaxAge,
+		MaxAge:   int(h.AuthService.SessionCookieMaxAge().Seconds()),
 		HttpOnly: true,
 		Secure:   h.SecureCookie,
 		SameSite: http.SameSiteStrictMode,
@@ -43,13 +46,10 @@ func (h *Handlers) clearSessionCookie(w http.ResponseWriter) {
 	})
 }
 
-// clientIPFromRequest extracts the client IP from the request.
-// Uses RemoteAddr directly (no proxy header trust from handlers).
+// clientIPFromRequest returns the client IP resolved by middleware.ResolveClientIP,
+// so login audits see the same address as the rate limiter.
 func clientIPFromRequest(r *http.Request) string {
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		return host
-	}
-	return r.RemoteAddr
+	return middleware.ClientIP(r)
 }
 
 // LoginPage renders the login form (GET /login)
@@ -60,14 +60,35 @@ func (h *Handlers) LoginPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	csrfToken, err := h.generateCSRFToken()
+	h.renderLogin(w, r, "")
+}
+
+// renderLogin renders the login form with fresh CSRF tokens for the password
+// form and, when passkeys are configured, the passkey sign-in button. The
+// single sign-on link is shown when an OpenID provider is configured.
+func (h *Handlers) renderLogin(w http.ResponseWriter, r *http.Request, errMsg string) {
+	csrfToken, err := h.generateCSRFToken(w, r, "/login")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	pages.Login(csrfToken, "").Render(r.Context(), w)
+	var passkeyToken string
+	if h.AuthService.PasskeysAvailable() {
+		if passkeyToken, err = h.generateCSRFToken(w, r, passkeyLoginBeginPath); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var ssoName string
+	if h.AuthService.OIDCAvailable() {
+		ssoName = h.AuthService.OIDCProviderName()
+	}
+
+	pages.Login(csrfToken, errMsg, passkeyToken, ssoName, h.AuthService.MagicLinksAvailable()).Render(r.Context(), w)
 }
 
 // LoginSubmit handles login form submission (POST /login)
@@ -80,49 +101,65 @@ func (h *Handlers) LoginSubmit(w http.ResponseWriter, r *http.Request) {
 	email := validation.Sanitize(r.FormValue("email"))
 	password := r.FormValue("password") // never sanitize passwords
 
-	// Basic input validation — MaxLength on password prevents bcrypt DoS (72-byte truncation)
+	// Basic input validation — MaxLength on password bounds the hashing work per request
 	v := validation.New()
 	v.Required("email", email, "Email").
 		Email("email", email, "Email").
 		MaxLength("email", email, 254, "Email")
 	v.Required("password", password, "Password").
-		MaxLength("password", password, 72, "Password")
+		MaxLength("password", password, services.MaxPasswordLength, "Password")
 	if !v.Result().IsValid() {
-		csrfToken, err := h.generateCSRFToken()
-		if err != nil {
-			log.Printf("failed to generate CSRF token: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		pages.Login(csrfToken, "Please fill in all fields correctly.").Render(r.Context(), w)
+		h.renderLogin(w, r, "Please fill in all fields correctly.")
 		return
 	}
 
 	ip := clientIPFromRequest(r)
 	userAgent := r.UserAgent()
 
-	token, err := h.AuthService.Login(email, password, ip, userAgent)
+	// Score behavioral telemetry when <secure-telemetry-provider> attached it to the form.
+	// Plain form posts without telemetry are scored as missing (low-trust, not blocked).
+	_, risk := h.scoreTelemetry(r, json.RawMessage(r.FormValue("_telemetry")))
+
+	result, err := h.AuthService.LoginWithRisk(email, password, ip, userAgent, risk)
+	if errors.Is(err, services.ErrEmailNotVerified) {
+		h.renderVerifyEmailPending(w, r, email, false)
+		return
+	}
 	if err != nil {
-		// Generic error message regardless of the actual failure reason
+		// Generic error message regardless of the actual failure reason.
+		// Lockouts share one message whether the account, IP or subnet tripped it.
 		errMsg := "Invalid email or password."
-		if err == services.ErrAccountLocked {
-			errMsg = "Account temporarily locked due to too many failed attempts. Please try again later."
+		var lockout *services.LockoutError
+		if errors.As(err, &lockout) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+			errMsg = "Too many failed sign-in attempts. Please try again in " + retryIn(lockout.RetryAfter) + "."
+		} else if err == services.ErrRiskRefused || err == services.ErrRiskBlocked || err == services.ErrClientDenied {
+			errMsg = "We couldn't verify this sign-in. Please try again."
 		}
 
-		csrfToken, csrfErr := h.generateCSRFToken()
-		if csrfErr != nil {
-			log.Printf("failed to generate CSRF token: %v", csrfErr)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		pages.Login(csrfToken, errMsg).Render(r.Context(), w)
+		h.renderLogin(w, r, errMsg)
+		return
+	}
+
+	if result.MFAToken != "" {
+		h.setMFACookie(w, result.MFAToken)
+		http.Redirect(w, r, "/login/mfa", http.StatusSeeOther)
 		return
 	}
 
-	h.setSessionCookie(w, token)
+	h.setSessionCookie(w, result.SessionToken)
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
+// retryIn formats a lockout duration for display, rounded up to whole minutes
+func retryIn(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	if minutes <= 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
 // LogoutSubmit handles logout (POST /logout)
 func (h *Handlers) LogoutSubmit(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie(h.cookieName())
@@ -143,7 +180,7 @@ func (h *Handlers) RegisterPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	csrfToken, err := h.generateCSRFToken()
+	csrfToken, err := h.generateCSRFToken(w, r, "/register")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -196,9 +233,8 @@ func (h *Handlers) RegisterSubmit(w http.ResponseWriter, r *http.Request) {
 	v.Required("email", email, "Email").
 		Email("email", email, "Email").
 		MaxLength("email", email, 254, "Email")
-	v.Required("password", password, "Password").
-		MinLength("password", password, 8, "Password").
-		MaxLength("password", password, 72, "Password")
+	v.Required("password", password, "Password")
+	h.checkPasswordPolicy(r.Context(), v.Result(), "password", password, firstName, lastName, email)
 	// confirm_password is only present on the no-JS path (native <noscript> inputs).
 	// When secure-password-confirm is active (JS enabled), only password is submitted
 	// and the component has already enforced match client-side.
@@ -207,13 +243,7 @@ func (h *Handlers) RegisterSubmit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !v.Result().IsValid() {
-		// Build per-field error map (first error per field only)
-		fieldErrors := make(map[string]string)
-		for _, e := range v.Result().Errors {
-			if _, exists := fieldErrors[e.Field]; !exists {
-				fieldErrors[e.Field] = e.Message
-			}
-		}
+		fieldErrors := firstFieldErrors(v.Result().Errors)
 
 		// Threat banner if injection was detected on any name field
 		threatMsg := ""
@@ -222,7 +252,7 @@ func (h *Handlers) RegisterSubmit(w http.ResponseWriter, r *http.Request) {
 			threatMsg = "Script injection detected. The submission was rejected and this event has been logged."
 		}
 
-		csrfToken, csrfErr := h.generateCSRFToken()
+		csrfToken, csrfErr := h.generateCSRFToken(w, r, "/register")
 		if csrfErr != nil {
 			log.Printf("failed to generate CSRF token: %v", csrfErr)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -232,7 +262,7 @@ func (h *Handlers) RegisterSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.AuthService.RegisterUser(firstName, lastName, email, password)
+	user, err := h.AuthService.RegisterUser(firstName, lastName, email, password)
 	if err != nil {
 		// Generic error to prevent email enumeration
 		renderErrorPage(w, r, "Registration Error", []validation.ValidationError{
@@ -241,17 +271,23 @@ func (h *Handlers) RegisterSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// With email verification on, no session until the emailed link is opened
+	if user.Status == "pending" {
+		h.renderVerifyEmailPending(w, r, email, false)
+		return
+	}
+
 	// Auto-login after successful registration
 	userAgent := r.UserAgent()
-	token, err := h.AuthService.Login(email, password, ip, userAgent)
-	if err != nil {
+	result, err := h.AuthService.Login(email, password, ip, userAgent)
+	if err != nil || result.SessionToken == "" {
 		// Registration succeeded but auto-login failed; redirect to login
 		log.Printf("Auto-login failed after registration: %v", err)
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	h.setSessionCookie(w, token)
+	h.setSessionCookie(w, result.SessionToken)
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
@@ -279,10 +315,9 @@ func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	v := validation.New()
 	v.Required("current_password", currentPassword, "Current Password").
-		MaxLength("current_password", currentPassword, 72, "Current Password")
-	v.Required("new_password", newPassword, "New Password").
-		MinLength("new_password", newPassword, 8, "New Password").
-		MaxLength("new_password", newPassword, 72, "New Password")
+		MaxLength("current_password", currentPassword, services.MaxPasswordLength, "Current Password")
+	v.Required("new_password", newPassword, "New Password")
+	h.checkPasswordPolicy(r.Context(), v.Result(), "new_password", newPassword, user.FirstName, user.LastName, user.Email)
 	v.Required("confirm_password", confirmPassword, "Confirm Password")
 
 	if newPassword != confirmPassword {
@@ -290,13 +325,10 @@ func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !v.Result().IsValid() {
-		csrfToken, err := h.generateCSRFToken()
-		if err != nil {
-			log.Printf("failed to generate CSRF token: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		pages.Profile(user, csrfToken, "Please correct the errors below.").Render(r.Context(), w)
+		h.renderProfile(w, r, user, pages.ProfileMFA{}, pages.ProfileAPITokens{}, pages.ProfilePassword{
+			Message:     "Please correct the errors below.",
+			FieldErrors: firstFieldErrors(v.Result().Errors),
+		})
 		return
 	}
 
@@ -307,13 +339,7 @@ func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		if err == services.ErrInvalidCredentials {
 			errMsg = "Current password is incorrect."
 		}
-		csrfToken, csrfErr := h.generateCSRFToken()
-		if csrfErr != nil {
-			log.Printf("failed to generate CSRF token: %v", csrfErr)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		pages.Profile(user, csrfToken, errMsg).Render(r.Context(), w)
+		h.renderProfile(w, r, user, pages.ProfileMFA{}, pages.ProfileAPITokens{}, pages.ProfilePassword{Message: errMsg})
 		return
 	}
 
@@ -330,12 +356,83 @@ func (h *Handlers) ProfilePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	csrfToken, err := h.generateCSRFToken()
+	h.renderProfile(w, r, user, pages.ProfileMFA{}, pages.ProfileAPITokens{}, pages.ProfilePassword{})
+}
+
+// renderProfile renders the profile page with fresh CSRF tokens for its forms.
+// mfa carries any two-factor message or new recovery codes; its status is filled in here,
+// as are the passkey, device and API token lists. tokens carries a newly created
+// API token or error. password carries change-password errors.
+func (h *Handlers) renderProfile(w http.ResponseWriter, r *http.Request, user *models.User, mfa pages.ProfileMFA, tokens pages.ProfileAPITokens, password pages.ProfilePassword) {
+	csrfToken, err := h.generateCSRFToken(w, r, "/profile/password")
+	if err != nil {
+		log.Printf("failed to generate CSRF token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	mfa.Status, err = h.AuthService.MFAStatus(user)
 	if err != nil {
+		log.Printf("failed to load two-factor status for user %d: %v", user.ID, err)
+		mfa.Message = "Two-factor settings are unavailable right now."
+	}
+	if mfa.Status.Available {
+		if mfa.CSRFToken, err = h.generateCSRFToken(w, r, "/profile/mfa"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var passkeys pages.ProfilePasskeys
+	if h.AuthService.PasskeysAvailable() {
+		passkeys.Available = true
+		if passkeys.Passkeys, err = h.AuthService.Passkeys(user.ID); err != nil {
+			log.Printf("failed to load passkeys for user %d: %v", user.ID, err)
+		}
+		if passkeys.RegisterToken, err = h.generateCSRFToken(w, r, passkeyRegisterBeginPath); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if len(passkeys.Passkeys) > 0 {
+			if passkeys.DeleteToken, err = h.generateCSRFToken(w, r, "/profile/passkeys"); err != nil {
+				log.Printf("failed to generate CSRF token: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	var devices pages.ProfileDevices
+	var currentToken string
+	if cookie, err := r.Cookie(h.cookieName()); err == nil {
+		currentToken = cookie.Value
+	}
+	if devices.Devices, err = h.AuthService.Devices(user.ID, currentToken); err != nil {
+		log.Printf("failed to load sessions for user %d: %v", user.ID, err)
+	}
+	if devices.CSRFToken, err = h.generateCSRFToken(w, r, "/profile/sessions"); err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	pages.Profile(user, csrfToken).Render(r.Context(), w)
+	if h.AuthService.APITokensAvailable() {
+		tokens.Available = true
+		tokens.Lifetimes = services.APITokenLifetimes
+		if tokens.Tokens, err = h.AuthService.APITokens(user.ID); err != nil {
+			log.Printf("failed to load api tokens for user %d: %v", user.ID, err)
+		}
+		if tokens.Scopes, err = h.apiTokenScopes(user); err != nil {
+			log.Printf("failed to load permissions for user %d: %v", user.ID, err)
+		}
+		if tokens.CSRFToken, err = h.generateCSRFToken(w, r, "/profile/tokens"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pages.Profile(user, csrfToken, mfa, passkeys, devices, tokens, password).Render(r.Context(), w)
 }
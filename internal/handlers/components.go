@@ -32,17 +32,15 @@ func (h *Handlers) Components(w http.ResponseWriter, r *http.Request) {
 	case "secure-textarea":
 		pages.ComponentSecureTextarea().Render(r.Context(), w)
 	case "secure-form":
-		t1, err1 := h.generateCSRFToken()
-		t2, err2 := h.generateCSRFToken()
-		t3, err3 := h.generateCSRFToken()
-		t4, err4 := h.generateCSRFToken()
-		t5, err5 := h.generateCSRFToken()
-		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
-			log.Printf("failed to generate CSRF tokens for secure-form page: %v %v %v %v %v", err1, err2, err3, err4, err5)
+		// Every form on the page posts to the same action, so they share one token;
+		// component-csrf.js replaces it in all of them once it has been spent.
+		token, err := h.generateCSRFToken(w, r, demoComponentAction)
+		if err != nil {
+			log.Printf("failed to generate CSRF token for secure-form page: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
-		pages.ComponentSecureForm(t1, t2, t3, t4, t5).Render(r.Context(), w)
+		pages.ComponentSecureForm(token).Render(r.Context(), w)
 	case "secure-file-upload":
 		pages.ComponentSecureFileUpload().Render(r.Context(), w)
 	case "secure-datetime":
@@ -50,7 +48,7 @@ func (h *Handlers) Components(w http.ResponseWriter, r *http.Request) {
 	case "secure-table":
 		pages.ComponentSecureTable().Render(r.Context(), w)
 	case "secure-card":
-		t1, err := h.generateCSRFToken()
+		t1, err := h.generateCSRFToken(w, r, demoComponentAction)
 		if err != nil {
 			log.Printf("failed to generate CSRF token for secure-card page: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -58,17 +56,16 @@ func (h *Handlers) Components(w http.ResponseWriter, r *http.Request) {
 		}
 		pages.ComponentSecureCard(t1).Render(r.Context(), w)
 	case "secure-telemetry-provider":
-		t1, err1 := h.generateCSRFToken()
-		t2, err2 := h.generateCSRFToken()
-		signingKey, err3 := generateSigningKey()
-		if err1 != nil || err2 != nil || err3 != nil {
-			log.Printf("failed to generate tokens for secure-telemetry-provider page: %v %v %v", err1, err2, err3)
+		token, err1 := h.generateCSRFToken(w, r, demoComponentAction)
+		signingKey, err2 := h.issueTelemetryKey(w, r)
+		if err1 != nil || err2 != nil {
+			log.Printf("failed to generate tokens for secure-telemetry-provider page: %v %v", err1, err2)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
-		pages.ComponentSecureTelemetryProvider(t1, t2, signingKey).Render(r.Context(), w)
+		pages.ComponentSecureTelemetryProvider(token, signingKey).Render(r.Context(), w)
 	case "secure-password-confirm":
-		t1, err := h.generateCSRFToken()
+		t1, err := h.generateCSRFToken(w, r, demoComponentAction)
 		if err != nil {
 			log.Printf("failed to generate CSRF token for secure-password-confirm page: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
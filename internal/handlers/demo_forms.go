@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"secure-ui-showcase-go/internal/validation"
 )
 
+// demoComponentAction is the shared submission target for the component showcase pages
+const demoComponentAction = "/api/demo/component-submit"
+
 // DemoLoginHandler handles POST /api/demo/login.
 func (h *Handlers) DemoLoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -22,12 +26,18 @@ func (h *Handlers) DemoLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tel, risk := h.checkDemoTelemetry(w, r, body)
+	if tel == nil {
+		return
+	}
+
 	email := validation.Sanitize(demoJSONString(body["email"]))
 	password := demoJSONString(body["password"]) // passwords are not sanitized
 
 	v := validation.New()
 	v.Required("email", email, "Email").Email("email", email, "Email")
-	v.Required("password", password, "Password").MinLength("password", password, 8, "Password")
+	v.Required("password", password, "Password")
+	h.checkPasswordPolicy(r.Context(), v.Result(), "password", password, email)
 	if result := v.Result(); !result.IsValid() {
 		writeValidationErrors(w, result.Errors)
 		return
@@ -39,6 +49,8 @@ func (h *Handlers) DemoLoginHandler(w http.ResponseWriter, r *http.Request) {
 		"session_id": fmt.Sprintf("sess_%d", time.Now().UnixMilli()),
 		"expires_in": 3600,
 		"token_type": "Bearer",
+		"telemetry":  tel.Status,
+		"risk":       risk,
 	})
 }
 
@@ -54,6 +66,11 @@ func (h *Handlers) DemoSubscribeHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	tel, risk := h.checkDemoTelemetry(w, r, body)
+	if tel == nil {
+		return
+	}
+
 	name := validation.Sanitize(demoJSONString(body["name"]))
 	email := validation.Sanitize(demoJSONString(body["email"]))
 	plan := validation.Sanitize(demoJSONString(body["plan"]))
@@ -75,6 +92,8 @@ func (h *Handlers) DemoSubscribeHandler(w http.ResponseWriter, r *http.Request)
 		"subscription_id": fmt.Sprintf("sub_%d", time.Now().UnixMilli()),
 		"status":          "active",
 		"trial_ends":      time.Now().AddDate(0, 0, 14).Format("2006-01-02"),
+		"telemetry":       tel.Status,
+		"risk":            risk,
 	})
 }
 
@@ -93,6 +112,11 @@ func (h *Handlers) DemoPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tel, risk := h.checkDemoTelemetry(w, r, body)
+	if tel == nil {
+		return
+	}
+
 	cardholderName := validation.Sanitize(demoJSONString(body["cardholder_name"]))
 	billingAddress := validation.Sanitize(demoJSONString(body["billing_address"]))
 	billingCity := validation.Sanitize(demoJSONString(body["billing_city"]))
@@ -121,6 +145,8 @@ func (h *Handlers) DemoPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		"amount":          "0.00",
 		"currency":        "GBP",
 		"note":            "Full PAN never received — tokenise via payment SDK in production",
+		"telemetry":       tel.Status,
+		"risk":            risk,
 	})
 }
 
@@ -137,14 +163,23 @@ func (h *Handlers) DemoComponentSubmitHandler(w http.ResponseWriter, r *http.Req
 
 // GetDemoCSRFToken issues a fresh CSRF token for re-use after a demo form submission.
 // The CSRF store uses ConsumeToken (single-use), so the demo forms need to refresh
-// their token after each successful submission.
-// GET /api/demo/csrf-token
+// their token after each successful submission. ?action= names the form's target;
+// only demo endpoints are accepted so this cannot mint tokens for real forms.
+// GET /api/demo/csrf-token?action=/api/demo/login
 func (h *Handlers) GetDemoCSRFToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	token, err := h.generateCSRFToken()
+	action := r.URL.Query().Get("action")
+	if action == "" {
+		action = demoComponentAction
+	}
+	if !strings.HasPrefix(action, "/api/demo/") || strings.Contains(action, "..") {
+		writeError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+	token, err := h.generateCSRFToken(w, r, action)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+	"secure-ui-showcase-go/internal/validation"
+)
+
+const invalidVerifyLinkMessage = "This verification link is invalid or has expired."
+
+// VerifyEmailPage asks the user to confirm an emailed verification link
+// (GET /verify-email?token=...). The account is only activated by the POST,
+// so mail scanners that prefetch links cannot verify on the user's behalf.
+func (h *Handlers) VerifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if err := h.AuthService.CheckEmailVerificationToken(token); err != nil {
+		if !errors.Is(err, services.ErrVerificationInvalid) {
+			log.Printf("failed to check email verification token: %v", err)
+		}
+		h.renderVerifyEmail(w, r, "", invalidVerifyLinkMessage)
+		return
+	}
+	h.renderVerifyEmail(w, r, token, "")
+}
+
+// VerifyEmailSubmit activates the account (POST /verify-email)
+func (h *Handlers) VerifyEmailSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.VerifyEmail(r.FormValue("token")); err != nil {
+		if !errors.Is(err, services.ErrVerificationInvalid) {
+			log.Printf("failed to verify email: %v", err)
+		}
+		h.renderVerifyEmail(w, r, "", invalidVerifyLinkMessage)
+		return
+	}
+	pages.VerifyEmailDone().Render(r.Context(), w)
+}
+
+// renderVerifyEmail renders the confirmation form with a fresh CSRF token.
+// An empty token renders the invalid-link state.
+func (h *Handlers) renderVerifyEmail(w http.ResponseWriter, r *http.Request, token, errMsg string) {
+	var csrfToken string
+	if token != "" {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/verify-email"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.VerifyEmail(csrfToken, token, errMsg).Render(r.Context(), w)
+}
+
+// ResendVerificationSubmit emails a new verification link (POST /verify-email/resend).
+// The confirmation is the same whether or not the account exists or is pending.
+func (h *Handlers) ResendVerificationSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	email := validation.Sanitize(r.FormValue("email"))
+	v := validation.New()
+	v.Required("email", email, "Email").
+		Email("email", email, "Email").
+		MaxLength("email", email, 254, "Email")
+	if !v.Result().IsValid() {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.AuthService.ResendVerification(email, clientIPFromRequest(r)); err != nil {
+		log.Printf("failed to resend verification email: %v", err)
+	}
+	h.renderVerifyEmailPending(w, r, email, true)
+}
+
+// renderVerifyEmailPending tells the user to check their inbox, with a button
+// to send the link again unless it was just resent
+func (h *Handlers) renderVerifyEmailPending(w http.ResponseWriter, r *http.Request, email string, resent bool) {
+	var csrfToken string
+	if !resent {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/verify-email/resend"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.VerifyEmailPending(csrfToken, email, resent).Render(r.Context(), w)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"html/template"
 	"log"
 	"net/http"
@@ -35,8 +36,9 @@ type FormSubmission struct {
 	// Files are handled separately via multipart form
 }
 
-// ValidateFormSubmission validates all form fields server-side
-func (h *Handlers) ValidateFormSubmission(data *FormSubmission) *validation.ValidationResult {
+// ValidateFormSubmission validates all form fields server-side. ctx selects
+// the language of password policy errors.
+func (h *Handlers) ValidateFormSubmission(ctx context.Context, data *FormSubmission) *validation.ValidationResult {
 	v := validation.New()
 
 	// Required text fields
@@ -70,8 +72,8 @@ func (h *Handlers) ValidateFormSubmission(data *FormSubmission) *validation.Vali
 		Phone("phone", data.Phone, "Phone")
 
 	// Password validation
-	v.Required("password", data.Password, "Password").
-		MinLength("password", data.Password, 8, "Password")
+	v.Required("password", data.Password, "Password")
+	h.checkPasswordPolicy(ctx, v.Result(), "password", data.Password, data.Email)
 
 	return v.Result()
 }
@@ -107,7 +109,7 @@ func (h *Handlers) SubmitFormHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate form data
-	validationResult := h.ValidateFormSubmission(submission)
+	validationResult := h.ValidateFormSubmission(r.Context(), submission)
 
 	// Handle file uploads if present
 	if file, header, err := r.FormFile("profile_picture"); err == nil {
@@ -1,8 +1,7 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,9 +11,11 @@ import (
 	"strconv"
 	"strings"
 
+	"secure-ui-showcase-go/internal/i18n"
 	"secure-ui-showcase-go/internal/middleware"
 	"secure-ui-showcase-go/internal/models"
 	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/telemetry"
 	"secure-ui-showcase-go/internal/validation"
 )
 
@@ -27,25 +28,40 @@ const CSRFTokenKey contextKey = "csrfToken"
 // Handlers holds all dependencies for HTTP handlers
 type Handlers struct {
 	UserDB         *models.UserDatabase
-	CSRFStore      *middleware.CSRFTokenStore
+	CSRF           middleware.CSRFProtector
 	CountryService *services.CountryService
 	AuthService    *services.AuthService
+	Authz          *services.Authorizer
+	Telemetry      *telemetry.Verifier
+	TelemetryKeys  *telemetry.KeyManager
+	Risk           *telemetry.RiskEngine
+	TelemetryDB    *models.TelemetryEventDatabase
 	SecureCookie   bool // true in production (HTTPS) for __Host- cookie prefix
 }
 
 // NewHandlers creates a new Handlers instance with the given dependencies
 func NewHandlers(
 	userDB *models.UserDatabase,
-	csrfStore *middleware.CSRFTokenStore,
+	csrf middleware.CSRFProtector,
 	countryService *services.CountryService,
 	authService *services.AuthService,
+	authz *services.Authorizer,
+	telemetryVerifier *telemetry.Verifier,
+	telemetryKeys *telemetry.KeyManager,
+	riskEngine *telemetry.RiskEngine,
+	telemetryDB *models.TelemetryEventDatabase,
 	secureCookie bool,
 ) *Handlers {
 	return &Handlers{
 		UserDB:         userDB,
-		CSRFStore:      csrfStore,
+		CSRF:           csrf,
 		CountryService: countryService,
 		AuthService:    authService,
+		Authz:          authz,
+		Telemetry:      telemetryVerifier,
+		TelemetryKeys:  telemetryKeys,
+		Risk:           riskEngine,
+		TelemetryDB:    telemetryDB,
 		SecureCookie:   secureCookie,
 	}
 }
@@ -206,22 +222,46 @@ func extractUserID(path string) (int, error) {
 }
 
 // ----------------------------------------------------------------------------
-// CSRF Helpers
+// Validation Helpers
 // ----------------------------------------------------------------------------
 
-// generateCSRFToken generates a single-use CSRF token from the store.
-func (h *Handlers) generateCSRFToken() (string, error) {
-	return h.CSRFStore.GenerateToken()
+// checkPasswordPolicy adds a localized error on field for each password policy
+// rule that password breaks. personal holds the user's names and email
+// address, which the password must not contain.
+func (h *Handlers) checkPasswordPolicy(ctx context.Context, result *validation.ValidationResult, field, password string, personal ...string) {
+	for _, violation := range h.AuthService.PasswordPolicy().Check(password, personal...) {
+		msg := i18n.T(ctx, violation.Key)
+		if violation.Arg != 0 {
+			msg = fmt.Sprintf(msg, violation.Arg)
+		}
+		if violation.Hint != "" {
+			msg += " " + i18n.T(ctx, violation.Hint)
+		}
+		result.AddError(field, msg)
+	}
 }
 
-// generateSigningKey returns a cryptographically random 32-byte hex string
-// suitable for use as an HMAC signing key.
-func generateSigningKey() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", fmt.Errorf("failed to generate signing key: %w", err)
+// firstFieldErrors maps each field to its first validation error, for forms
+// that show one message under each input
+func firstFieldErrors(errs []validation.ValidationError) map[string]string {
+	fieldErrors := make(map[string]string)
+	for _, e := range errs {
+		if _, exists := fieldErrors[e.Field]; !exists {
+			fieldErrors[e.Field] = e.Message
+		}
 	}
-	return hex.EncodeToString(b), nil
+	return fieldErrors
+}
+
+// ----------------------------------------------------------------------------
+// CSRF Helpers
+// ----------------------------------------------------------------------------
+
+// generateCSRFToken issues a single-use CSRF token for a form that submits to action.
+// In signed mode the token is only accepted on that path, so pages with several
+// forms need one token per action.
+func (h *Handlers) generateCSRFToken(w http.ResponseWriter, r *http.Request, action string) (string, error) {
+	return h.CSRF.IssueToken(w, r, action)
 }
 
 // ----------------------------------------------------------------------------
@@ -239,16 +279,13 @@ func requireAuth(w http.ResponseWriter, r *http.Request) *models.User {
 	return user
 }
 
-// requireAdmin checks that the authenticated user has the "admin" role.
-// Returns the user if admin, or writes a 403 JSON response and returns nil.
-func requireAdmin(w http.ResponseWriter, r *http.Request) *models.User {
-	user := requireAuth(w, r)
-	if user == nil {
+// requireSession is requireAuth for account changes an API token must not
+// make, such as adding sign-in credentials: it refuses requests authenticated
+// with a token rather than a browser session.
+func requireSession(w http.ResponseWriter, r *http.Request) *models.User {
+	if middleware.APITokenFromContext(r.Context()) != nil {
+		writeError(w, http.StatusForbidden, "Not available with an API token")
 		return nil
 	}
-	if user.Role != "admin" {
-		writeError(w, http.StatusForbidden, "Admin access required")
-		return nil
-	}
-	return user
+	return requireAuth(w, r)
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
 	"secure-ui-showcase-go/internal/templates/pages"
 )
 
@@ -15,9 +16,9 @@ func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	signingKey, err := generateSigningKey()
+	signingKey, err := h.issueTelemetryKey(w, r)
 	if err != nil {
-		log.Printf("failed to generate home signing key: %v", err)
+		log.Printf("failed to issue home signing key: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -30,52 +31,55 @@ func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 // uses ConsumeToken (atomic validate+delete), so a single shared token would
 // be exhausted by the first submission.
 func (h *Handlers) Forms(w http.ResponseWriter, r *http.Request) {
-	loginToken, err := h.generateCSRFToken()
+	loginToken, err := h.generateCSRFToken(w, r, "/api/demo/login")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	subscribeToken, err := h.generateCSRFToken()
+	subscribeToken, err := h.generateCSRFToken(w, r, "/api/demo/subscribe")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
-	paymentToken, err := h.generateCSRFToken()
+	paymentToken, err := h.generateCSRFToken(w, r, "/api/demo/payment")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	signingKey, err := generateSigningKey()
+	signingKey, err := h.issueTelemetryKey(w, r)
 	if err != nil {
-		log.Printf("failed to generate signing key: %v", err)
+		log.Printf("failed to issue signing key: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "forms_signing_key",
-		Value:    signingKey,
-		Path:     "/",
-		MaxAge:   3600,
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   r.TLS != nil,
-	})
-
 	pages.FormsPage(loginToken, subscribeToken, paymentToken, signingKey).Render(r.Context(), w)
 }
 
-// Dashboard renders the dashboard page
+// Dashboard renders the dashboard page. The add and delete forms are only
+// shown (and their CSRF tokens only issued) to users whose role allows them.
 func (h *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
-	csrfToken, err := h.generateCSRFToken()
-	if err != nil {
-		log.Printf("failed to generate CSRF token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	caller := middleware.UserFromContext(r.Context())
+
+	var csrfToken, deleteToken string
+	var err error
+	if h.Authz.Can(caller, models.PermUsersCreate, nil) {
+		if csrfToken, err = h.generateCSRFToken(w, r, "/users"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if h.Authz.Can(caller, models.PermUsersDelete, nil) {
+		if deleteToken, err = h.generateCSRFToken(w, r, "/users/delete"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	users, err := h.UserDB.GetAll()
@@ -85,18 +89,11 @@ func (h *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pages.Dashboard(users, csrfToken).Render(r.Context(), w)
+	pages.Dashboard(users, csrfToken, deleteToken).Render(r.Context(), w)
 }
 
 // Table renders the data table demo page
 func (h *Handlers) Table(w http.ResponseWriter, r *http.Request) {
-	csrfToken, err := h.generateCSRFToken()
-	if err != nil {
-		log.Printf("failed to generate CSRF token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
 	users, err := h.UserDB.GetAll()
 	if err != nil {
 		log.Printf("failed to get users for table: %v", err)
@@ -104,12 +101,30 @@ func (h *Handlers) Table(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pages.Table(users, csrfToken, middleware.UserFromContext(r.Context())).Render(r.Context(), w)
+	// Delete buttons and the pending-verification list depend on the caller's role
+	caller := middleware.UserFromContext(r.Context())
+	var deleteToken, verifyToken string
+	if h.Authz.Can(caller, models.PermUsersDelete, nil) {
+		if deleteToken, err = h.generateCSRFToken(w, r, "/users/delete"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if h.Authz.Can(caller, models.PermUsersVerify, nil) {
+		if verifyToken, err = h.generateCSRFToken(w, r, "/users/verify"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pages.Table(users, deleteToken, verifyToken).Render(r.Context(), w)
 }
 
 // Registration renders the registration form page
 func (h *Handlers) Registration(w http.ResponseWriter, r *http.Request) {
-	csrfToken, err := h.generateCSRFToken()
+	csrfToken, err := h.generateCSRFToken(w, r, "/register")
 	if err != nil {
 		log.Printf("failed to generate CSRF token: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
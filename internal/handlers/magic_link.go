@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+	"secure-ui-showcase-go/internal/validation"
+)
+
+// magicLinkNonceMaxAge matches the lifetime of an emailed sign-in link (15 minutes)
+const magicLinkNonceMaxAge = 900
+
+const invalidMagicLinkMessage = "This sign-in link is invalid, has expired, or was opened in a different browser from the one that asked for it."
+
+// magicLinkCookieName returns the sign-in link nonce cookie name; __Host- when secure
+func (h *Handlers) magicLinkCookieName() string {
+	if h.SecureCookie {
+		return "__Host-magic_link"
+	}
+	return "magic_link"
+}
+
+// setMagicLinkCookie binds an emailed sign-in link to this browser. Strict is
+// enough because the link only opens a confirmation page, whose same-site
+// form submission is what carries the cookie.
+func (h *Handlers) setMagicLinkCookie(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.magicLinkCookieName(),
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// MagicLinkPage renders the sign-in link request form (GET /login/magic-link)
+func (h *Handlers) MagicLinkPage(w http.ResponseWriter, r *http.Request) {
+	if middleware.UserFromContext(r.Context()) != nil {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+	if !h.AuthService.MagicLinksAvailable() {
+		http.NotFound(w, r)
+		return
+	}
+	h.renderMagicLink(w, r, "", false)
+}
+
+// MagicLinkSubmit emails a sign-in link (POST /login/magic-link). The
+// confirmation is the same whether or not the email is registered, and the
+// browser gets a nonce cookie either way.
+func (h *Handlers) MagicLinkSubmit(w http.ResponseWriter, r *http.Request) {
+	if !h.AuthService.MagicLinksAvailable() {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	email := validation.Sanitize(r.FormValue("email"))
+	v := validation.New()
+	v.Required("email", email, "Email").
+		Email("email", email, "Email").
+		MaxLength("email", email, 254, "Email")
+	if !v.Result().IsValid() {
+		h.renderMagicLink(w, r, "Please enter a valid email address.", false)
+		return
+	}
+
+	nonce, err := h.AuthService.RequestMagicLink(email, clientIPFromRequest(r), r.UserAgent())
+	var lockout *services.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+		h.renderMagicLink(w, r, "Too many failed sign-in attempts. Please try again in "+retryIn(lockout.RetryAfter)+".", false)
+		return
+	case errors.Is(err, services.ErrClientDenied):
+		// The service has logged the request
+	case err != nil:
+		// Still show the confirmation so failures can't be told apart from unknown emails
+		log.Printf("failed to request magic link: %v", err)
+	default:
+		h.setMagicLinkCookie(w, nonce, magicLinkNonceMaxAge)
+	}
+	h.renderMagicLink(w, r, "", true)
+}
+
+// renderMagicLink renders the request form with a fresh CSRF token
+func (h *Handlers) renderMagicLink(w http.ResponseWriter, r *http.Request, errMsg string, sent bool) {
+	var csrfToken string
+	if !sent {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/login/magic-link"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.MagicLink(csrfToken, errMsg, sent).Render(r.Context(), w)
+}
+
+// MagicLinkVerifyPage asks the user to confirm an emailed sign-in link
+// (GET /login/magic-link/verify?token=...). Only the POST signs in, so mail
+// scanners that prefetch links cannot use them up.
+func (h *Handlers) MagicLinkVerifyPage(w http.ResponseWriter, r *http.Request) {
+	if middleware.UserFromContext(r.Context()) != nil {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.renderMagicLinkVerify(w, r, "", invalidMagicLinkMessage)
+		return
+	}
+	h.renderMagicLinkVerify(w, r, token, "")
+}
+
+// MagicLinkVerifySubmit signs in with the link (POST /login/magic-link/verify)
+func (h *Handlers) MagicLinkVerifySubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	var nonce string
+	if cookie, err := r.Cookie(h.magicLinkCookieName()); err == nil {
+		nonce = cookie.Value
+	}
+
+	result, err := h.AuthService.LoginWithMagicLink(r.FormValue("token"), nonce, clientIPFromRequest(r), r.UserAgent())
+	if err != nil {
+		errMsg := invalidMagicLinkMessage
+		var lockout *services.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+			errMsg = "Too many failed sign-in attempts. Please try again in " + retryIn(lockout.RetryAfter) + "."
+		case errors.Is(err, services.ErrMagicLinkInvalid), errors.Is(err, services.ErrClientDenied):
+			// The service has logged the reason
+		default:
+			log.Printf("magic link login failed: %v", err)
+			errMsg = "Unable to sign in. Please try again."
+		}
+		h.renderMagicLinkVerify(w, r, "", errMsg)
+		return
+	}
+
+	h.setMagicLinkCookie(w, "", -1)
+	if result.MFAToken != "" {
+		h.setMFACookie(w, result.MFAToken)
+		http.Redirect(w, r, "/login/mfa", http.StatusSeeOther)
+		return
+	}
+	h.setSessionCookie(w, result.SessionToken)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// renderMagicLinkVerify renders the confirmation form with a fresh CSRF token.
+// An empty token renders the invalid-link state.
+func (h *Handlers) renderMagicLinkVerify(w http.ResponseWriter, r *http.Request, token, errMsg string) {
+	var csrfToken string
+	if token != "" {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/login/magic-link/verify"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.MagicLinkVerify(csrfToken, token, errMsg).Render(r.Context(), w)
+}
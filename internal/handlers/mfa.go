@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+)
+
+// mfaChallengeMaxAge matches the server-side challenge lifetime (5 minutes)
+const mfaChallengeMaxAge = 300
+
+// mfaCookieName returns the pending second-factor cookie name; __Host- when secure
+func (h *Handlers) mfaCookieName() string {
+	if h.SecureCookie {
+		return "__Host-mfa_challenge"
+	}
+	return "mfa_challenge"
+}
+
+// setMFACookie stores the second-factor challenge token between the two login steps
+func (h *Handlers) setMFACookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.mfaCookieName(),
+		Value:    token,
+		Path:     "/",
+		MaxAge:   mfaChallengeMaxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearMFACookie removes the second-factor challenge cookie
+func (h *Handlers) clearMFACookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.mfaCookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// LoginMFAPage renders the second-factor form (GET /login/mfa)
+func (h *Handlers) LoginMFAPage(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(h.mfaCookieName()); err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	h.renderLoginMFA(w, r, "")
+}
+
+// LoginMFASubmit checks the second factor and creates the session (POST /login/mfa)
+func (h *Handlers) LoginMFASubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(h.mfaCookieName())
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	token, err := h.AuthService.VerifyMFA(cookie.Value, r.FormValue("code"), clientIPFromRequest(r), r.UserAgent())
+	if err != nil {
+		var lockout *services.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+			h.renderLoginMFA(w, r, "Too many failed sign-in attempts. Please try again in "+retryIn(lockout.RetryAfter)+".")
+		case errors.Is(err, services.ErrInvalidMFACode):
+			h.renderLoginMFA(w, r, "Invalid authentication code.")
+		case errors.Is(err, services.ErrMFAChallengeExpired):
+			h.clearMFACookie(w)
+			h.renderLogin(w, r, "Your sign-in expired. Please sign in again.")
+		default:
+			log.Printf("second-factor verification failed: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.clearMFACookie(w)
+	h.setSessionCookie(w, token)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// renderLoginMFA renders the second-factor form with a fresh CSRF token
+func (h *Handlers) renderLoginMFA(w http.ResponseWriter, r *http.Request, errMsg string) {
+	csrfToken, err := h.generateCSRFToken(w, r, "/login/mfa")
+	if err != nil {
+		log.Printf("failed to generate CSRF token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	pages.LoginMFA(csrfToken, errMsg).Render(r.Context(), w)
+}
+
+// ProfileMFA handles two-factor enrolment from the profile page (POST /profile/mfa).
+// The op field selects setup, confirm, recovery-codes or disable; the last two
+// require the current password.
+func (h *Handlers) ProfileMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var view pages.ProfileMFA
+	var err error
+	switch r.FormValue("op") {
+	case "setup":
+		_, err = h.AuthService.BeginTOTPEnrollment(user)
+	case "confirm":
+		view.RecoveryCodes, err = h.AuthService.ConfirmTOTPEnrollment(user.ID, r.FormValue("code"))
+	case "recovery-codes":
+		view.RecoveryCodes, err = h.AuthService.RegenerateRecoveryCodes(user.ID, r.FormValue("password"))
+	case "disable":
+		err = h.AuthService.DisableTOTP(user.ID, r.FormValue("password"))
+	default:
+		http.Error(w, "Unknown operation", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrInvalidMFACode):
+		view.Message = "That code didn't match. Check your authenticator app's clock and try again."
+	case errors.Is(err, services.ErrInvalidCredentials):
+		view.Message = "Current password is incorrect."
+	default:
+		log.Printf("two-factor update failed for user %d: %v", user.ID, err)
+		view.Message = "Unable to update two-factor authentication. Please try again."
+	}
+
+	h.renderProfile(w, r, user, view, pages.ProfileAPITokens{}, pages.ProfilePassword{})
+}
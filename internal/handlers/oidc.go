@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/services"
+)
+
+// oidcStateMaxAge matches the server-side sign-in lifetime (10 minutes)
+const oidcStateMaxAge = 600
+
+// oidcStateCookieName returns the sign-in state cookie name; __Host- when secure
+func (h *Handlers) oidcStateCookieName() string {
+	if h.SecureCookie {
+		return "__Host-oidc_state"
+	}
+	return "oidc_state"
+}
+
+// setOIDCStateCookie keeps the state of a sign-in sent to the provider.
+// It is SameSite=Lax because the provider's redirect back is a cross-site
+// navigation, on which Strict cookies are not sent.
+func (h *Handlers) setOIDCStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.oidcStateCookieName(),
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OIDCLogin sends the browser to the OpenID provider to sign in (GET /login/oidc)
+func (h *Handlers) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if middleware.UserFromContext(r.Context()) != nil {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	authURL, state, err := h.AuthService.BeginOIDCLogin(r.Context())
+	if errors.Is(err, services.ErrOIDCUnavailable) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to start oidc login: %v", err)
+		h.renderLogin(w, r, "Single sign-on is unavailable right now. Please try again later.")
+		return
+	}
+
+	h.setOIDCStateCookie(w, state, oidcStateMaxAge)
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
+
+// OIDCCallback finishes a sign-in when the provider redirects back
+// (GET /login/oidc/callback)
+func (h *Handlers) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var browserState string
+	if cookie, err := r.Cookie(h.oidcStateCookieName()); err == nil {
+		browserState = cookie.Value
+	}
+	h.setOIDCStateCookie(w, "", -1)
+
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		log.Printf("oidc provider returned error: %.100s %.200s", q.Get("error"), q.Get("error_description"))
+		h.renderLogin(w, r, "Single sign-on was cancelled or failed. Please try again.")
+		return
+	}
+
+	result, err := h.AuthService.FinishOIDCLogin(r.Context(), browserState, q.Get("state"), q.Get("code"),
+		clientIPFromRequest(r), r.UserAgent())
+	if err != nil {
+		errMsg := "We couldn't sign you in with single sign-on. Please try again."
+		var lockout *services.LockoutError
+		switch {
+		case errors.As(err, &lockout):
+			w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+			errMsg = "Too many failed sign-in attempts. Please try again in " + retryIn(lockout.RetryAfter) + "."
+		case errors.Is(err, services.ErrOIDCRejected), errors.Is(err, services.ErrClientDenied):
+			// The service has logged the reason
+		default:
+			log.Printf("oidc login failed: %v", err)
+		}
+		h.renderLogin(w, r, errMsg)
+		return
+	}
+
+	target := "/dashboard"
+	if result.MFAToken != "" {
+		h.setMFACookie(w, result.MFAToken)
+		target = "/login/mfa"
+	} else {
+		h.setSessionCookie(w, result.SessionToken)
+	}
+	continueSameSite(w, target)
+}
+
+// continueSameSiteTmpl sends the browser on from a page of ours. The callback
+// request was started by the provider's site, and an HTTP redirect would stay
+// part of that cross-site navigation, so the SameSite=Strict cookies just set
+// would not be sent with it.
+var continueSameSiteTmpl = template.Must(template.New("continue").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta http-equiv="refresh" content="0; url={{.}}">
+    <title>Signing in - Secure-UI</title>
+</head>
+<body>
+    <p><a href="{{.}}">Continue</a></p>
+</body>
+</html>`))
+
+// continueSameSite renders continueSameSiteTmpl for target, a local path
+func continueSameSite(w http.ResponseWriter, target string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := continueSameSiteTmpl.Execute(w, target); err != nil {
+		log.Printf("failed to render continue page: %v", err)
+	}
+}
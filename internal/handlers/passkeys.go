@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/webauthn"
+)
+
+// Passkey ceremony endpoints. Each begin call returns the options for the
+// browser plus a CSRF token bound to the matching finish path.
+const (
+	passkeyRegisterBeginPath  = "/api/webauthn/register/begin"
+	passkeyRegisterFinishPath = "/api/webauthn/register/finish"
+	passkeyLoginBeginPath     = "/api/webauthn/login/begin"
+	passkeyLoginFinishPath    = "/api/webauthn/login/finish"
+
+	// maxPasskeyBody caps ceremony responses; real ones are a few kilobytes
+	maxPasskeyBody = 64 << 10
+)
+
+// passkeyLoginCookieName returns the sign-in challenge nonce cookie name; __Host- when secure
+func (h *Handlers) passkeyLoginCookieName() string {
+	if h.SecureCookie {
+		return "__Host-passkey_login"
+	}
+	return "passkey_login"
+}
+
+// setPasskeyLoginCookie binds a sign-in challenge to this browser for as long
+// as the ceremony may take; maxAge -1 clears it.
+func (h *Handlers) setPasskeyLoginCookie(w http.ResponseWriter, nonce string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.passkeyLoginCookieName(),
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.SecureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// PasskeyRegisterBegin returns creation options for a new passkey (POST /api/webauthn/register/begin)
+func (h *Handlers) PasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := requireSession(w, r)
+	if user == nil {
+		return
+	}
+
+	options, err := h.AuthService.BeginPasskeyRegistration(user)
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+	h.writePasskeyOptions(w, r, options, passkeyRegisterFinishPath)
+}
+
+// PasskeyRegisterFinish verifies and stores a new passkey (POST /api/webauthn/register/finish)
+func (h *Handlers) PasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := requireSession(w, r)
+	if user == nil {
+		return
+	}
+
+	var req struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasskeyBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	cred, err := h.AuthService.FinishPasskeyRegistration(user, req.Name, &req.Credential)
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+	writeSuccess(w, http.StatusCreated, "Passkey added", map[string]any{"id": cred.ID, "name": cred.Name})
+}
+
+// PasskeyLoginBegin returns request options for passwordless sign-in (POST /api/webauthn/login/begin)
+func (h *Handlers) PasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	options, nonce, err := h.AuthService.BeginPasskeyLogin()
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+	h.setPasskeyLoginCookie(w, nonce, int(webauthn.DefaultTimeout.Seconds()))
+	h.writePasskeyOptions(w, r, options, passkeyLoginFinishPath)
+}
+
+// PasskeyLoginFinish verifies an assertion and signs the user in (POST /api/webauthn/login/finish)
+func (h *Handlers) PasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var assertion webauthn.AssertionResponse
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasskeyBody)
+	if err := json.NewDecoder(r.Body).Decode(&assertion); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var nonce string
+	if cookie, err := r.Cookie(h.passkeyLoginCookieName()); err == nil {
+		nonce = cookie.Value
+	}
+	// A nonce serves one attempt; trying again starts a new ceremony
+	h.setPasskeyLoginCookie(w, "", -1)
+
+	token, err := h.AuthService.LoginWithPasskey(&assertion, nonce, clientIPFromRequest(r), r.UserAgent())
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+
+	h.setSessionCookie(w, token)
+	writeSuccess(w, http.StatusOK, "", map[string]any{"redirect": "/dashboard"})
+}
+
+// ProfilePasskeys removes a passkey from the profile page (POST /profile/passkeys)
+func (h *Handlers) ProfilePasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || r.FormValue("op") != "delete" {
+		http.Error(w, "Unknown operation", http.StatusBadRequest)
+		return
+	}
+
+	// A passkey that is already gone needs no message; the list shows the result
+	if err := h.AuthService.DeletePasskey(user.ID, id); err != nil && !errors.Is(err, models.ErrNotFound) {
+		log.Printf("failed to remove passkey %d for user %d: %v", id, user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
+// writePasskeyOptions sends ceremony options with a CSRF token for the finish step
+func (h *Handlers) writePasskeyOptions(w http.ResponseWriter, r *http.Request, options any, finishPath string) {
+	csrfToken, err := h.generateCSRFToken(w, r, finishPath)
+	if err != nil {
+		log.Printf("failed to generate CSRF token: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeSuccess(w, http.StatusOK, "", map[string]any{"options": options, "csrfToken": csrfToken})
+}
+
+// writePasskeyError maps passkey service errors to JSON responses without
+// revealing why verification failed
+func (h *Handlers) writePasskeyError(w http.ResponseWriter, err error) {
+	var lockout *services.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		w.Header().Set("Retry-After", strconv.Itoa(int(lockout.RetryAfter.Round(time.Second).Seconds())))
+		writeError(w, http.StatusTooManyRequests, "Too many failed sign-in attempts. Please try again in "+retryIn(lockout.RetryAfter)+".")
+	case errors.Is(err, services.ErrPasskeyRejected), errors.Is(err, services.ErrClientDenied):
+		writeError(w, http.StatusUnauthorized, "We couldn't verify this passkey. Please try again.")
+	case errors.Is(err, services.ErrPasskeyLimit):
+		writeError(w, http.StatusConflict, "You have reached the maximum number of passkeys. Remove one to add another.")
+	case errors.Is(err, services.ErrPasskeysUnavailable):
+		writeError(w, http.StatusNotFound, "Passkeys are not enabled")
+	default:
+		log.Printf("passkey ceremony failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
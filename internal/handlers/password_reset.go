@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+	"secure-ui-showcase-go/internal/validation"
+)
+
+const invalidResetLinkMessage = "This reset link is invalid or has expired."
+
+// ForgotPasswordPage renders the reset request form (GET /forgot-password)
+func (h *Handlers) ForgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	if middleware.UserFromContext(r.Context()) != nil {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+	h.renderForgotPassword(w, r, "", false)
+}
+
+// ForgotPasswordSubmit emails a reset link (POST /forgot-password). The
+// confirmation is the same whether or not the email is registered.
+func (h *Handlers) ForgotPasswordSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	email := validation.Sanitize(r.FormValue("email"))
+	v := validation.New()
+	v.Required("email", email, "Email").
+		Email("email", email, "Email").
+		MaxLength("email", email, 254, "Email")
+	if !v.Result().IsValid() {
+		h.renderForgotPassword(w, r, "Please enter a valid email address.", false)
+		return
+	}
+
+	if err := h.AuthService.RequestPasswordReset(email, clientIPFromRequest(r)); err != nil {
+		// Still show the confirmation so failures can't be told apart from unknown emails
+		log.Printf("failed to request password reset: %v", err)
+	}
+	h.renderForgotPassword(w, r, "", true)
+}
+
+// renderForgotPassword renders the reset request form with a fresh CSRF token
+func (h *Handlers) renderForgotPassword(w http.ResponseWriter, r *http.Request, errMsg string, sent bool) {
+	var csrfToken string
+	if !sent {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/forgot-password"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.ForgotPassword(csrfToken, errMsg, sent).Render(r.Context(), w)
+}
+
+// ResetPasswordPage renders the new password form for an emailed link
+// (GET /reset-password?token=...). The token is checked but not used up.
+func (h *Handlers) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := h.AuthService.CheckPasswordResetToken(token); err != nil {
+		if !errors.Is(err, services.ErrResetTokenInvalid) {
+			log.Printf("failed to check password reset token: %v", err)
+		}
+		h.renderResetPassword(w, r, "", invalidResetLinkMessage, nil)
+		return
+	}
+	h.renderResetPassword(w, r, token, "", nil)
+}
+
+// ResetPasswordSubmit sets the new password (POST /reset-password). Every
+// session of the account is revoked, including the caller's if signed in.
+func (h *Handlers) ResetPasswordSubmit(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	newPassword := r.FormValue("new_password")
+	confirmPassword := r.FormValue("confirm_password")
+
+	// The user's details are only needed for the policy; an unusable link is
+	// reported by ResetPassword below
+	var personal []string
+	if user, err := h.AuthService.CheckPasswordResetToken(token); err == nil {
+		personal = []string{user.FirstName, user.LastName, user.Email}
+	}
+
+	v := validation.New()
+	v.Required("new_password", newPassword, "New Password")
+	h.checkPasswordPolicy(r.Context(), v.Result(), "new_password", newPassword, personal...)
+	v.Required("confirm_password", confirmPassword, "Confirm Password")
+	if newPassword != confirmPassword {
+		v.Result().AddError("confirm_password", "Passwords do not match")
+	}
+	if !v.Result().IsValid() {
+		h.renderResetPassword(w, r, token, "", firstFieldErrors(v.Result().Errors))
+		return
+	}
+
+	if err := h.AuthService.ResetPassword(token, newPassword); err != nil {
+		if !errors.Is(err, services.ErrResetTokenInvalid) {
+			log.Printf("failed to reset password: %v", err)
+			h.renderResetPassword(w, r, token, "Unable to reset password. Please try again.", nil)
+			return
+		}
+		h.renderResetPassword(w, r, "", invalidResetLinkMessage, nil)
+		return
+	}
+
+	h.clearSessionCookie(w)
+	pages.ResetPasswordDone().Render(r.Context(), w)
+}
+
+// renderResetPassword renders the new password form with a fresh CSRF token.
+// An empty token renders the invalid-link state. fieldErrors are shown under their inputs.
+func (h *Handlers) renderResetPassword(w http.ResponseWriter, r *http.Request, token, errMsg string, fieldErrors map[string]string) {
+	var csrfToken string
+	if token != "" {
+		var err error
+		if csrfToken, err = h.generateCSRFToken(w, r, "/reset-password"); err != nil {
+			log.Printf("failed to generate CSRF token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	pages.ResetPassword(csrfToken, token, errMsg, fieldErrors).Render(r.Context(), w)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/services"
+	"secure-ui-showcase-go/internal/templates/pages"
+	"secure-ui-showcase-go/internal/validation"
+)
+
+// maxRoleDescriptionLength bounds the description of a new role
+const maxRoleDescriptionLength = 200
+
+// AdminRoles shows every role with its permissions and applies changes to them
+// (GET/POST /admin/roles, requires roles.manage, enforced on the route).
+// The op form field selects the change: update, create or delete.
+func (h *Handlers) AdminRoles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderAdminRoles(w, r, http.StatusOK, "")
+		return
+	case http.MethodPost:
+	default:
+		h.RenderErrorPage(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	caller := middleware.UserFromContext(r.Context())
+	if err := r.ParseForm(); err != nil {
+		h.RenderErrorPage(w, r, http.StatusBadRequest)
+		return
+	}
+	role := validation.Sanitize(r.FormValue("role"))
+
+	var err error
+	switch r.FormValue("op") {
+	case "update":
+		perms, listErr := h.Authz.Permissions()
+		if listErr != nil {
+			log.Printf("failed to list permissions: %v", listErr)
+			h.RenderErrorPage(w, r, http.StatusInternalServerError)
+			return
+		}
+		grants := make(map[string]string)
+		for _, p := range perms {
+			if scope := r.FormValue("perm." + p.Name); scope != "" {
+				grants[p.Name] = scope
+			}
+		}
+		err = h.Authz.SetRolePermissions(caller, role, grants)
+	case "create":
+		description := validation.Sanitize(r.FormValue("description"))
+		v := validation.New()
+		v.MaxLength("description", description, maxRoleDescriptionLength, "Description").
+			NoHTML("description", description, "Description")
+		if result := v.Result(); !result.IsValid() {
+			h.renderAdminRoles(w, r, http.StatusBadRequest, result.Errors[0].Message)
+			return
+		}
+		err = h.Authz.CreateRole(caller, role, description)
+	case "delete":
+		err = h.Authz.DeleteRole(caller, role)
+	default:
+		h.RenderErrorPage(w, r, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case err == nil:
+		http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+	case errors.Is(err, models.ErrNotFound):
+		h.RenderErrorPage(w, r, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidRoleName), errors.Is(err, services.ErrInvalidGrant):
+		h.renderAdminRoles(w, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrRoleLockout):
+		h.renderAdminRoles(w, r, http.StatusConflict, "You cannot remove role management from your own role.")
+	case errors.Is(err, models.ErrRoleExists):
+		h.renderAdminRoles(w, r, http.StatusConflict, "A role called "+role+" already exists.")
+	case errors.Is(err, models.ErrRoleInUse):
+		h.renderAdminRoles(w, r, http.StatusConflict, "Built-in roles and roles that users still have cannot be deleted.")
+	default:
+		log.Printf("failed to change role %q: %v", role, err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+	}
+}
+
+// renderAdminRoles renders the roles page with status and an optional error message
+func (h *Handlers) renderAdminRoles(w http.ResponseWriter, r *http.Request, status int, message string) {
+	roles, err := h.Authz.Roles()
+	if err != nil {
+		log.Printf("failed to list roles: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+	perms, err := h.Authz.Permissions()
+	if err != nil {
+		log.Printf("failed to list permissions: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+	grants, err := h.Authz.Grants()
+	if err != nil {
+		log.Printf("failed to list role permissions: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+	csrfToken, err := h.generateCSRFToken(w, r, "/admin/roles")
+	if err != nil {
+		log.Printf("failed to generate CSRF token: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	pages.AdminRoles(pages.AdminRolesPage{
+		Roles:       roles,
+		Permissions: perms,
+		Grants:      grants,
+		CSRFToken:   csrfToken,
+		Message:     message,
+	}).Render(r.Context(), w)
+}
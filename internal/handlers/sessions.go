@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"secure-ui-showcase-go/internal/middleware"
+	"secure-ui-showcase-go/internal/models"
+)
+
+// ProfileSessions signs out devices from the profile page (POST /profile/sessions).
+// op=revoke signs out the session with the given id; revoking the current
+// one is the same as signing out. op=revoke_others keeps only this session.
+func (h *Handlers) ProfileSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := middleware.UserFromContext(r.Context())
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	var currentToken string
+	if cookie, err := r.Cookie(h.cookieName()); err == nil {
+		currentToken = cookie.Value
+	}
+
+	switch r.FormValue("op") {
+	case "revoke":
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		devices, err := h.AuthService.Devices(user.ID, currentToken)
+		if err != nil {
+			log.Printf("failed to list sessions for user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// A session that is already gone needs no message; the list shows the result
+		if err := h.AuthService.RevokeSession(user.ID, id); err != nil && !errors.Is(err, models.ErrNotFound) {
+			log.Printf("failed to revoke session %d for user %d: %v", id, user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, d := range devices {
+			if d.SessionID == id && d.Current {
+				h.clearSessionCookie(w)
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+		}
+	case "revoke_others":
+		if _, err := h.AuthService.RevokeOtherSessions(user.ID, currentToken); err != nil {
+			log.Printf("failed to revoke other sessions for user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Unknown operation", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
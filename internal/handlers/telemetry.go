@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/telemetry"
+)
+
+// telemetryVisitorMaxAge is how long a browser keeps its telemetry visitor ID
+const telemetryVisitorMaxAge = 365 * 24 * 60 * 60 // 1 year
+
+// telemetryVisitorCookieName returns the visitor cookie name, __Host- prefixed in secure mode.
+func (h *Handlers) telemetryVisitorCookieName() string {
+	if h.SecureCookie {
+		return "__Host-telemetry_vid"
+	}
+	return "telemetry_vid"
+}
+
+// telemetryVisitorID returns the visitor ID bound to this browser, or "" if none was issued
+func (h *Handlers) telemetryVisitorID(r *http.Request) string {
+	if cookie, err := r.Cookie(h.telemetryVisitorCookieName()); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// issueTelemetryKey returns the current signing key for this browser, setting the
+// visitor ID cookie on first use. Only the random visitor ID is stored client-side;
+// the key itself is re-derived from the server master secret on every request.
+func (h *Handlers) issueTelemetryKey(w http.ResponseWriter, r *http.Request) (telemetry.SigningKey, error) {
+	visitorID := h.telemetryVisitorID(r)
+	if visitorID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return telemetry.SigningKey{}, fmt.Errorf("failed to generate visitor id: %w", err)
+		}
+		visitorID = base64.RawURLEncoding.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.telemetryVisitorCookieName(),
+			Value:    visitorID,
+			Path:     "/",
+			MaxAge:   telemetryVisitorMaxAge,
+			HttpOnly: true,
+			Secure:   h.SecureCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return h.TelemetryKeys.Current(visitorID)
+}
+
+// scoreTelemetry verifies a raw _telemetry value against this browser's current and
+// previous signing keys, scores it with the risk engine, and persists the outcome.
+// Submissions without telemetry are scored but not stored.
+func (h *Handlers) scoreTelemetry(r *http.Request, raw json.RawMessage) (*telemetry.Result, *telemetry.Assessment) {
+	ip := clientIPFromRequest(r)
+	keys := h.TelemetryKeys.Candidates(h.telemetryVisitorID(r))
+	res := h.Telemetry.Verify(raw, keys...)
+	risk := h.Risk.Assess(res)
+	telemetry.LogAssessment(r.URL.Path, ip, res, risk)
+
+	if res.Status != telemetry.StatusMissing {
+		if err := h.TelemetryDB.Record(&models.TelemetryEvent{
+			FormID:    r.URL.Path,
+			Status:    string(res.Status),
+			RiskScore: risk.Score,
+			Action:    string(risk.Action),
+			Signals:   risk.Reasons,
+		}, ip); err != nil {
+			log.Printf("failed to record telemetry event: %v", err)
+		}
+	}
+	return res, risk
+}
+
+// checkDemoTelemetry scores the _telemetry envelope on a demo submission.
+// Unsigned or missing telemetry is accepted as low-trust. Tampered, stale or replayed
+// envelopes are rejected with 400, and submissions the risk engine blocks are rejected
+// with 403; in both cases nil is returned and the response has been written.
+func (h *Handlers) checkDemoTelemetry(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) (*telemetry.Result, *telemetry.Assessment) {
+	res, risk := h.scoreTelemetry(r, body["_telemetry"])
+	if res.Rejected() {
+		log.Printf("[SECURITY] telemetry rejected on %s: status=%s err=%v ip=%s",
+			r.URL.Path, res.Status, res.Err, clientIPFromRequest(r))
+		writeError(w, http.StatusBadRequest, "Telemetry verification failed")
+		return nil, nil
+	}
+	if risk.Action == telemetry.ActionBlock {
+		writeJSON(w, http.StatusForbidden, map[string]any{
+			"success": false,
+			"error":   "Submission blocked by risk policy",
+			"risk":    risk,
+		})
+		return nil, nil
+	}
+	return res, risk
+}
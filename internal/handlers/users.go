@@ -21,8 +21,9 @@ type UserRequest struct {
 	Status    string `json:"status"`
 }
 
-// ValidateUserRequest validates user creation/update request
-func ValidateUserRequest(req *UserRequest) *validation.ValidationResult {
+// ValidateUserRequest validates user creation/update request.
+// roles lists the role names that can be assigned.
+func ValidateUserRequest(req *UserRequest, roles []string) *validation.ValidationResult {
 	v := validation.New()
 
 	v.Required("firstName", req.FirstName, "First Name").
@@ -35,7 +36,7 @@ func ValidateUserRequest(req *UserRequest) *validation.ValidationResult {
 		Email("email", req.Email, "Email")
 
 	v.Required("role", req.Role, "Role").
-		OneOf("role", req.Role, []string{"admin", "moderator", "user"}, "Role")
+		OneOf("role", req.Role, roles, "Role")
 
 	v.Required("status", req.Status, "Status").
 		OneOf("status", req.Status, []string{"active", "inactive", "pending"}, "Status")
@@ -77,9 +78,10 @@ func (h *Handlers) GetUser(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, http.StatusOK, "", user)
 }
 
-// CreateUser creates a new user (requires authentication)
+// CreateUser creates a new user (requires users.create, enforced on the route)
 func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
-	if requireAuth(w, r) == nil {
+	caller := requireAuth(w, r)
+	if caller == nil {
 		return
 	}
 
@@ -99,8 +101,22 @@ func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 	req.Role = validation.Sanitize(req.Role)
 	req.Status = validation.Sanitize(req.Status)
 
+	// Without users.assign_role new users get the same defaults as from the
+	// dashboard form (prevent creating accounts more privileged than the caller)
+	if !h.Authz.Can(caller, models.PermUsersAssignRole, nil) {
+		req.Role = "user"
+		req.Status = "active"
+	}
+
+	roles, err := h.Authz.RoleNames()
+	if err != nil {
+		log.Printf("failed to list roles: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
 	// Validate request
-	validationResult := ValidateUserRequest(&req)
+	validationResult := ValidateUserRequest(&req, roles)
 	if !validationResult.IsValid() {
 		writeValidationErrors(w, validationResult.Errors)
 		return
@@ -127,8 +143,9 @@ func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, http.StatusCreated, "User created successfully", createdUser)
 }
 
-// UpdateUser updates an existing user.
-// Users can only update their own profile. Admins can update any user.
+// UpdateUser updates an existing user. users.update granted for the user's own
+// resources allows editing one's own profile; granted for all, any user.
+// Role and status only change with users.assign_role.
 func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	caller := requireAuth(w, r)
 	if caller == nil {
@@ -141,9 +158,19 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authorization: self-only unless admin
-	if caller.Role != "admin" && caller.ID != id {
-		writeError(w, http.StatusForbidden, "You can only edit your own profile")
+	target, err := h.UserDB.GetByID(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		log.Printf("failed to get user %d: %v", id, err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if !h.Authz.Can(caller, models.PermUsersUpdate, target) {
+		writeError(w, http.StatusForbidden, "You do not have permission to edit this user")
 		return
 	}
 
@@ -163,14 +190,21 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	req.Role = validation.Sanitize(req.Role)
 	req.Status = validation.Sanitize(req.Status)
 
-	// Non-admins cannot change their own role or status (prevent privilege escalation)
-	if caller.Role != "admin" {
-		req.Role = caller.Role
-		req.Status = caller.Status
+	// Without users.assign_role the role and status stay as they are (prevent privilege escalation)
+	if !h.Authz.Can(caller, models.PermUsersAssignRole, target) {
+		req.Role = target.Role
+		req.Status = target.Status
+	}
+
+	roles, err := h.Authz.RoleNames()
+	if err != nil {
+		log.Printf("failed to list roles: %v", err)
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
 	}
 
 	// Validate request
-	validationResult := ValidateUserRequest(&req)
+	validationResult := ValidateUserRequest(&req, roles)
 	if !validationResult.IsValid() {
 		writeValidationErrors(w, validationResult.Errors)
 		return
@@ -201,9 +235,10 @@ func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, http.StatusOK, "User updated successfully", updatedUser)
 }
 
-// DeleteUser deletes a user (admin only)
+// DeleteUser deletes a user (requires users.delete, enforced on the route)
 func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	if requireAdmin(w, r) == nil {
+	caller := requireAuth(w, r)
+	if caller == nil {
 		return
 	}
 
@@ -224,14 +259,16 @@ func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("User deleted: ID=%d", id)
+	log.Printf("User deleted: ID=%d by=%d", id, caller.ID)
 
 	writeSuccess(w, http.StatusOK, "User deleted successfully", nil)
 }
 
-// CreateUserFromForm handles HTML form submission to create a user (requires authentication)
+// CreateUserFromForm handles HTML form submission to create a user
+// (requires users.create, enforced on the route)
 func (h *Handlers) CreateUserFromForm(w http.ResponseWriter, r *http.Request) {
-	if requireAuth(w, r) == nil {
+	if r.Method != http.MethodPost {
+		h.RenderErrorPage(w, r, http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -255,8 +292,15 @@ func (h *Handlers) CreateUserFromForm(w http.ResponseWriter, r *http.Request) {
 		Status:    "active", // Default status for form submissions
 	}
 
+	roles, err := h.Authz.RoleNames()
+	if err != nil {
+		log.Printf("failed to list roles: %v", err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+
 	// Validate request
-	validationResult := ValidateUserRequest(req)
+	validationResult := ValidateUserRequest(req, roles)
 	if !validationResult.IsValid() {
 		renderErrorPage(w, r, "Validation Errors", validationResult.Errors, "/dashboard")
 		return
@@ -286,20 +330,14 @@ func (h *Handlers) CreateUserFromForm(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
-// DeleteUserFromForm handles HTML form submission to delete a user (admin only)
+// DeleteUserFromForm handles HTML form submission to delete a user
+// (requires users.delete, enforced on the route)
 func (h *Handlers) DeleteUserFromForm(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.RenderErrorPage(w, r, http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Admin-only: check the user from context (set by RequireAuth middleware on this route)
-	caller := middleware.UserFromContext(r.Context())
-	if caller == nil || caller.Role != "admin" {
-		h.RenderErrorPage(w, r, http.StatusForbidden)
-		return
-	}
-
 	if err := r.ParseForm(); err != nil {
 		h.RenderErrorPage(w, r, http.StatusBadRequest)
 		return
@@ -337,3 +375,37 @@ func (h *Handlers) DeleteUserFromForm(w http.ResponseWriter, r *http.Request) {
 	}
 	http.Redirect(w, r, referer, http.StatusSeeOther)
 }
+
+// VerifyUserFromForm activates a pending account without the email link
+// (POST /users/verify, requires users.verify, enforced on the route)
+func (h *Handlers) VerifyUserFromForm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.RenderErrorPage(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	caller := middleware.UserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		h.RenderErrorPage(w, r, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		h.RenderErrorPage(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.AuthService.ForceVerifyEmail(caller, id); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			h.RenderErrorPage(w, r, http.StatusNotFound)
+			return
+		}
+		log.Printf("failed to verify user %d: %v", id, err)
+		h.RenderErrorPage(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/table", http.StatusSeeOther)
+}
@@ -222,13 +222,62 @@ var translations = map[string]map[Locale]string{
 	"login.csrf":          {EN: "CSRF Protected", ES: "Protegido CSRF", FR: "Protégé CSRF", DE: "CSRF-geschützt"},
 	"login.ratelimit":     {EN: "Rate Limited", ES: "Límite de velocidad", FR: "Débit limité", DE: "Ratenbegrenzt"},
 	"login.audit":         {EN: "Audit Logged", ES: "Auditoría registrada", FR: "Journalisé", DE: "Audit-protokolliert"},
+	"login.passkey":       {EN: "Sign in with a passkey", ES: "Iniciar sesión con una llave de acceso", FR: "Se connecter avec une clé d'accès", DE: "Mit einem Passkey anmelden"},
+	"login.sso":           {EN: "Sign in with", ES: "Iniciar sesión con", FR: "Se connecter avec", DE: "Anmelden mit"},
+	"login.magic_link":    {EN: "Email me a sign-in link", ES: "Envíame un enlace de acceso", FR: "M'envoyer un lien de connexion", DE: "Anmeldelink per E-Mail senden"},
+	"login.forgot":        {EN: "Forgot your password?", ES: "¿Olvidaste tu contraseña?", FR: "Mot de passe oublié ?", DE: "Passwort vergessen?"},
+
+	// ── Password reset ─────────────────────────────────────────────────────
+	"forgot.title":      {EN: "Reset your password", ES: "Restablece tu contraseña", FR: "Réinitialiser votre mot de passe", DE: "Passwort zurücksetzen"},
+	"forgot.subtitle":   {EN: "Enter your account email and we'll send you a link to choose a new password.", ES: "Introduce el correo de tu cuenta y te enviaremos un enlace para elegir una nueva contraseña.", FR: "Saisissez l'e-mail de votre compte et nous vous enverrons un lien pour choisir un nouveau mot de passe.", DE: "Geben Sie die E-Mail-Adresse Ihres Kontos ein und wir senden Ihnen einen Link zum Festlegen eines neuen Passworts."},
+	"forgot.submit":     {EN: "Send reset link", ES: "Enviar enlace", FR: "Envoyer le lien", DE: "Link senden"},
+	"forgot.sent":       {EN: "If an account exists for that email, a reset link is on its way. It expires in 30 minutes.", ES: "Si existe una cuenta con ese correo, recibirás un enlace. Caduca en 30 minutos.", FR: "Si un compte existe pour cet e-mail, un lien de réinitialisation vous a été envoyé. Il expire dans 30 minutes.", DE: "Falls ein Konto mit dieser E-Mail-Adresse existiert, ist ein Link unterwegs. Er läuft in 30 Minuten ab."},
+	"forgot.back":       {EN: "Back to sign in", ES: "Volver a iniciar sesión", FR: "Retour à la connexion", DE: "Zurück zur Anmeldung"},
+	"reset.title":       {EN: "Choose a new password", ES: "Elige una nueva contraseña", FR: "Choisissez un nouveau mot de passe", DE: "Neues Passwort wählen"},
+	"reset.subtitle":    {EN: "You'll be signed out everywhere else once it's changed.", ES: "Se cerrarán tus demás sesiones cuando la cambies.", FR: "Vos autres sessions seront fermées une fois le mot de passe changé.", DE: "Nach der Änderung werden Sie überall sonst abgemeldet."},
+	"reset.password":    {EN: "New password", ES: "Nueva contraseña", FR: "Nouveau mot de passe", DE: "Neues Passwort"},
+	"reset.confirm":     {EN: "Confirm new password", ES: "Confirmar nueva contraseña", FR: "Confirmer le nouveau mot de passe", DE: "Neues Passwort bestätigen"},
+	"reset.submit":      {EN: "Change password", ES: "Cambiar contraseña", FR: "Changer le mot de passe", DE: "Passwort ändern"},
+	"reset.request_new": {EN: "Request a new reset link", ES: "Solicitar un nuevo enlace", FR: "Demander un nouveau lien", DE: "Neuen Link anfordern"},
+	"reset.done_title":  {EN: "Password changed", ES: "Contraseña cambiada", FR: "Mot de passe changé", DE: "Passwort geändert"},
+	"reset.done":        {EN: "Your password has been changed and all other sessions were signed out.", ES: "Tu contraseña se ha cambiado y se cerraron todas las demás sesiones.", FR: "Votre mot de passe a été changé et toutes les autres sessions ont été fermées.", DE: "Ihr Passwort wurde geändert und alle anderen Sitzungen wurden abgemeldet."},
+
+	// ── Magic link sign-in ──────────────────────────────────
+	"magic.title":           {EN: "Sign in by email", ES: "Inicia sesión por correo", FR: "Connexion par e-mail", DE: "Per E-Mail anmelden"},
+	"magic.subtitle":        {EN: "Enter your account email and we'll send you a link that signs you in without a password.", ES: "Introduce el correo de tu cuenta y te enviaremos un enlace para iniciar sesión sin contraseña.", FR: "Saisissez l'e-mail de votre compte et nous vous enverrons un lien pour vous connecter sans mot de passe.", DE: "Geben Sie die E-Mail-Adresse Ihres Kontos ein und wir senden Ihnen einen Link, mit dem Sie sich ohne Passwort anmelden."},
+	"magic.submit":          {EN: "Send sign-in link", ES: "Enviar enlace de acceso", FR: "Envoyer le lien de connexion", DE: "Anmeldelink senden"},
+	"magic.sent":            {EN: "If an account exists for that email, a sign-in link is on its way. Open it in this browser within 15 minutes.", ES: "Si existe una cuenta con ese correo, recibirás un enlace de acceso. Ábrelo en este navegador en un plazo de 15 minutos.", FR: "Si un compte existe pour cet e-mail, un lien de connexion vous a été envoyé. Ouvrez-le dans ce navigateur dans les 15 minutes.", DE: "Falls ein Konto mit dieser E-Mail-Adresse existiert, ist ein Anmeldelink unterwegs. Öffnen Sie ihn innerhalb von 15 Minuten in diesem Browser."},
+	"magic.verify_title":    {EN: "Sign in to Secure-UI", ES: "Inicia sesión en Secure-UI", FR: "Connexion à Secure-UI", DE: "Bei Secure-UI anmelden"},
+	"magic.verify_subtitle": {EN: "Confirm to finish signing in with the link from your email.", ES: "Confirma para terminar de iniciar sesión con el enlace de tu correo.", FR: "Confirmez pour terminer la connexion avec le lien reçu par e-mail.", DE: "Bestätigen Sie, um die Anmeldung mit dem Link aus Ihrer E-Mail abzuschließen."},
+	"magic.verify_submit":   {EN: "Sign in", ES: "Iniciar sesión", FR: "Se connecter", DE: "Anmelden"},
+	"magic.request_new":     {EN: "Request a new sign-in link", ES: "Solicitar un nuevo enlace de acceso", FR: "Demander un nouveau lien de connexion", DE: "Neuen Anmeldelink anfordern"},
+
+	// ── Email verification ─────────────────────────────────────────────────
+	"verify.pending_title": {EN: "Check your email", ES: "Revisa tu correo", FR: "Vérifiez vos e-mails", DE: "Prüfen Sie Ihre E-Mails"},
+	"verify.pending":       {EN: "Open the link we sent to this address to activate your account. It works for 24 hours.", ES: "Abre el enlace que enviamos a esta dirección para activar tu cuenta. Es válido durante 24 horas.", FR: "Ouvrez le lien envoyé à cette adresse pour activer votre compte. Il est valable 24 heures.", DE: "Öffnen Sie den Link, den wir an diese Adresse gesendet haben, um Ihr Konto zu aktivieren. Er ist 24 Stunden gültig."},
+	"verify.resend":        {EN: "Send the link again", ES: "Enviar el enlace de nuevo", FR: "Renvoyer le lien", DE: "Link erneut senden"},
+	"verify.resent":        {EN: "If this address belongs to an account waiting for verification, a new link is on its way.", ES: "Si esta dirección pertenece a una cuenta pendiente de verificación, recibirás un nuevo enlace.", FR: "Si cette adresse correspond à un compte en attente de vérification, un nouveau lien est en route.", DE: "Falls diese Adresse zu einem noch nicht bestätigten Konto gehört, ist ein neuer Link unterwegs."},
+	"verify.title":         {EN: "Verify your email", ES: "Verifica tu correo", FR: "Vérifiez votre e-mail", DE: "E-Mail-Adresse bestätigen"},
+	"verify.subtitle":      {EN: "Confirm this is your email address to activate your account.", ES: "Confirma que esta es tu dirección de correo para activar tu cuenta.", FR: "Confirmez qu'il s'agit bien de votre adresse e-mail pour activer votre compte.", DE: "Bestätigen Sie, dass dies Ihre E-Mail-Adresse ist, um Ihr Konto zu aktivieren."},
+	"verify.submit":        {EN: "Verify email address", ES: "Verificar correo", FR: "Vérifier l'adresse e-mail", DE: "E-Mail-Adresse bestätigen"},
+	"verify.invalid_hint":  {EN: "Sign in to get a new verification link.", ES: "Inicia sesión para recibir un nuevo enlace de verificación.", FR: "Connectez-vous pour recevoir un nouveau lien de vérification.", DE: "Melden Sie sich an, um einen neuen Bestätigungslink zu erhalten."},
+	"verify.done_title":    {EN: "Email verified", ES: "Correo verificado", FR: "E-mail vérifié", DE: "E-Mail-Adresse bestätigt"},
+	"verify.done":          {EN: "Your account is active. You can now sign in.", ES: "Tu cuenta está activa. Ya puedes iniciar sesión.", FR: "Votre compte est actif. Vous pouvez maintenant vous connecter.", DE: "Ihr Konto ist aktiv. Sie können sich jetzt anmelden."},
+
+	// ── Two-factor sign-in ─────────────────────────────────────────────────
+	"mfa.title":         {EN: "Two-factor authentication", ES: "Autenticación de dos factores", FR: "Authentification à deux facteurs", DE: "Zwei-Faktor-Authentifizierung"},
+	"mfa.subtitle":      {EN: "Enter the 6-digit code from your authenticator app.", ES: "Introduce el código de 6 dígitos de tu app de autenticación.", FR: "Saisissez le code à 6 chiffres de votre application d'authentification.", DE: "Geben Sie den 6-stelligen Code aus Ihrer Authenticator-App ein."},
+	"mfa.code":          {EN: "Authentication code", ES: "Código de autenticación", FR: "Code d'authentification", DE: "Authentifizierungscode"},
+	"mfa.submit":        {EN: "Verify", ES: "Verificar", FR: "Vérifier", DE: "Bestätigen"},
+	"mfa.recovery_hint": {EN: "Lost your device? Enter one of your recovery codes instead.", ES: "¿Perdiste tu dispositivo? Introduce uno de tus códigos de recuperación.", FR: "Appareil perdu ? Saisissez plutôt l'un de vos codes de récupération.", DE: "Gerät verloren? Geben Sie stattdessen einen Ihrer Wiederherstellungscodes ein."},
+	"mfa.restart":       {EN: "Start over", ES: "Empezar de nuevo", FR: "Recommencer", DE: "Neu beginnen"},
 
 	// ── Registration ───────────────────────────────────────────────────────
 	"reg.eyebrow":       {EN: "Secure Registration", ES: "Registro seguro", FR: "Inscription sécurisée", DE: "Sichere Registrierung"},
 	"reg.brand_heading": {EN: "Built for developers who care about security.", ES: "Construido para desarrolladores que se preocupan por la seguridad.", FR: "Conçu pour les développeurs soucieux de la sécurité.", DE: "Für Entwickler, die Sicherheit schätzen."},
 	"reg.brand_desc":    {EN: "Registration demonstrates server-side input validation, constraint enforcement, and secure credential storage with no client-side secrets.", ES: "El registro demuestra la validación de entradas del lado del servidor, el cumplimiento de restricciones y el almacenamiento seguro de credenciales sin secretos del lado del cliente.", FR: "L'inscription démontre la validation des entrées côté serveur, l'application des contraintes et le stockage sécurisé des identifiants sans secrets côté client.", DE: "Die Registrierung demonstriert server-seitige Eingabevalidierung, Constraint-Durchsetzung und sichere Anmeldedaten-Speicherung ohne client-seitige Geheimnisse."},
 	"reg.feat1":         {EN: "Server-side validation on every field", ES: "Validación del lado del servidor en cada campo", FR: "Validation côté serveur sur chaque champ", DE: "Server-seitige Validierung bei jedem Feld"},
-	"reg.feat2":         {EN: "Password hashed with bcrypt — never stored in plain text", ES: "Contraseña hasheada con bcrypt — nunca almacenada en texto plano", FR: "Mot de passe haché avec bcrypt — jamais stocké en texte clair", DE: "Passwort mit bcrypt gehasht — niemals im Klartext gespeichert"},
+	"reg.feat2":         {EN: "Password hashed with argon2id — never stored in plain text", ES: "Contraseña hasheada con argon2id — nunca almacenada en texto plano", FR: "Mot de passe haché avec argon2id — jamais stocké en texte clair", DE: "Passwort mit argon2id gehasht — niemals im Klartext gespeichert"},
 	"reg.feat3":         {EN: "Input sanitised with bluemonday strict policy", ES: "Entradas sanitizadas con la política estricta de bluemonday", FR: "Entrées désinfectées avec la politique stricte de bluemonday", DE: "Eingaben mit bluemonday-Striktrichtlinie sanitiert"},
 	"reg.feat4":         {EN: "CSRF token required on every form submission", ES: "Token CSRF requerido en cada envío de formulario", FR: "Jeton CSRF requis à chaque soumission de formulaire", DE: "CSRF-Token bei jeder Formularübermittlung erforderlich"},
 	"reg.feat5":         {EN: "Duplicate email detection without timing attacks", ES: "Detección de email duplicado sin ataques de tiempo", FR: "Détection des emails en double sans attaques temporelles", DE: "Duplikat-E-Mail-Erkennung ohne Timing-Angriffe"},
@@ -245,5 +294,17 @@ var translations = map[string]map[Locale]string{
 	"reg.signin":        {EN: "Sign in", ES: "Iniciar sesión", FR: "Se connecter", DE: "Anmelden"},
 	"reg.csrf":          {EN: "CSRF Protected", ES: "Protegido CSRF", FR: "Protégé CSRF", DE: "CSRF-geschützt"},
 	"reg.validated":     {EN: "Validated", ES: "Validado", FR: "Validé", DE: "Validiert"},
-	"reg.hashed":        {EN: "bcrypt Hashed", ES: "Hash bcrypt", FR: "Haché bcrypt", DE: "bcrypt-gehasht"},
+	"reg.hashed":        {EN: "argon2id Hashed", ES: "Hash argon2id", FR: "Haché argon2id", DE: "argon2id-gehasht"},
+
+	// ── Password policy ─────────────────────────────────────────────────────
+	"password.too_short":     {EN: "Use at least %d characters.", ES: "Usa al menos %d caracteres.", FR: "Utilisez au moins %d caractères.", DE: "Verwenden Sie mindestens %d Zeichen."},
+	"password.too_long":      {EN: "Use at most %d characters.", ES: "Usa como máximo %d caracteres.", FR: "Utilisez au plus %d caractères.", DE: "Verwenden Sie höchstens %d Zeichen."},
+	"password.too_weak":      {EN: "This password is too easy to guess.", ES: "Esta contraseña es demasiado fácil de adivinar.", FR: "Ce mot de passe est trop facile à deviner.", DE: "Dieses Passwort ist zu leicht zu erraten."},
+	"password.personal":      {EN: "Don't use your name or email address in your password.", ES: "No uses tu nombre ni tu correo en la contraseña.", FR: "N'utilisez pas votre nom ni votre adresse e-mail dans le mot de passe.", DE: "Verwenden Sie weder Ihren Namen noch Ihre E-Mail-Adresse im Passwort."},
+	"password.breached":      {EN: "This password has appeared in a data breach. Choose a different one.", ES: "Esta contraseña ha aparecido en una filtración de datos. Elige otra.", FR: "Ce mot de passe figure dans une fuite de données. Choisissez-en un autre.", DE: "Dieses Passwort ist in einem Datenleck aufgetaucht. Wählen Sie ein anderes."},
+	"password.warn_common":   {EN: "It is close to a commonly used password or word.", ES: "Se parece a una contraseña o palabra muy común.", FR: "Il ressemble à un mot de passe ou un mot très courant.", DE: "Es ähnelt einem häufig verwendeten Passwort oder Wort."},
+	"password.warn_sequence": {EN: "Sequences like abc or 6543 are easy to guess.", ES: "Las secuencias como abc o 6543 son fáciles de adivinar.", FR: "Les suites comme abc ou 6543 sont faciles à deviner.", DE: "Folgen wie abc oder 6543 sind leicht zu erraten."},
+	"password.warn_repeat":   {EN: "Repeats like aaa or abcabc are easy to guess.", ES: "Las repeticiones como aaa o abcabc son fáciles de adivinar.", FR: "Les répétitions comme aaa ou abcabc sont faciles à deviner.", DE: "Wiederholungen wie aaa oder abcabc sind leicht zu erraten."},
+	"password.warn_keyboard": {EN: "Keyboard rows like qwerty are easy to guess.", ES: "Las filas del teclado como qwerty son fáciles de adivinar.", FR: "Les rangées du clavier comme qwerty sont faciles à deviner.", DE: "Tastaturreihen wie qwerty sind leicht zu erraten."},
+	"password.warn_date":     {EN: "Dates and years are easy to guess.", ES: "Las fechas y los años son fáciles de adivinar.", FR: "Les dates et les années sont faciles à deviner.", DE: "Daten und Jahreszahlen sind leicht zu erraten."},
 }
@@ -0,0 +1,118 @@
+// Package ipfilter normalizes client addresses into rate-limit buckets and
+// checks them against static allow and deny lists.
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// DefaultIPv4Prefix buckets IPv4 clients by full address
+	DefaultIPv4Prefix = 32
+	// DefaultIPv6Prefix buckets IPv6 clients by /64, the smallest block an ISP
+	// normally assigns to one subscriber, so a host cannot dodge limits by
+	// rotating addresses inside its own network
+	DefaultIPv6Prefix = 64
+)
+
+// ParsePrefixes parses a comma-separated list of CIDRs or bare IPs
+func ParsePrefixes(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", part, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", part, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Bucketer maps client IPs to the key used for rate limiting and lockout
+type Bucketer struct {
+	IPv4Bits int
+	IPv6Bits int
+}
+
+// DefaultBucketer keys IPv4 clients by address and IPv6 clients by /64
+func DefaultBucketer() Bucketer {
+	return Bucketer{IPv4Bits: DefaultIPv4Prefix, IPv6Bits: DefaultIPv6Prefix}
+}
+
+// Key returns the bucket for ip: the address itself for full-length prefixes,
+// otherwise the masked network in CIDR form ("2001:db8:1:2::/64").
+// Unparseable input is returned unchanged so it still gets a bucket of its own.
+func (b Bucketer) Key(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := b.IPv6Bits
+	if addr.Is4() {
+		bits = b.IPv4Bits
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// List is a static allowlist and denylist of client networks.
+// A nil *List allows everything and denies nothing.
+type List struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewList creates a new access list
+func NewList(allow, deny []netip.Prefix) *List {
+	return &List{allow: allow, deny: deny}
+}
+
+// Allowed reports whether ip is on the allowlist (exempt from throttling)
+func (l *List) Allowed(ip string) bool {
+	return l != nil && contains(l.allow, ip)
+}
+
+// Denied reports whether ip is on the denylist. The allowlist wins when both match.
+func (l *List) Denied(ip string) bool {
+	return l != nil && contains(l.deny, ip) && !contains(l.allow, ip)
+}
+
+// contains reports whether ip falls in any of the prefixes
+func contains(prefixes []netip.Prefix, ip string) bool {
+	if len(prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+// Package mail sends transactional email (password resets, verification links)
+// through a pluggable transport: SMTP in production, a drop directory or
+// memory when developing and testing without a mail server.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidMessage is returned for messages whose headers could be used for
+// header injection or whose address does not parse
+var ErrInvalidMessage = errors.New("invalid mail message")
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers a message
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Compile-time checks that the transports satisfy Mailer
+var (
+	_ Mailer = (*SMTPMailer)(nil)
+	_ Mailer = (*FileMailer)(nil)
+	_ Mailer = (*MemoryMailer)(nil)
+)
+
+// SMTPMailer delivers through an SMTP relay. STARTTLS is used whenever the
+// server offers it, and credentials are only ever sent over TLS (or to localhost).
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates an SMTP transport. username may be empty for relays
+// that do not require authentication.
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	m := &SMTPMailer{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+// Send delivers msg. net/smtp has no context support, so ctx is only checked
+// before connecting.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	raw, to, err := compose(m.from, msg)
+	if err != nil {
+		return err
+	}
+	envelopeFrom, _ := mail.ParseAddress(m.from)
+	if err := smtp.SendMail(m.addr, m.auth, envelopeFrom.Address, []string{to}, raw); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// FileMailer writes each message as an .eml file in a directory, so links can
+// be opened locally without a mail server
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates the drop directory if needed. Files are readable only
+// by the server user because they contain live tokens.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes msg to a new file named after the time and a random suffix
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	raw, _, err := compose(m.from, msg)
+	if err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	if err := os.WriteFile(filepath.Join(m.dir, name), raw, 0o600); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
+
+// MemoryMailer keeps sent messages in memory, for tests and local runs
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemoryMailer creates an empty in-memory transport
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+// Send validates and records msg
+func (m *MemoryMailer) Send(_ context.Context, msg Message) error {
+	if _, _, err := compose("memory@localhost", msg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of every message sent so far
+func (m *MemoryMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// compose renders msg as an RFC 5322 message and returns it with the bare
+// recipient address. Headers containing line breaks are rejected outright.
+func compose(from string, msg Message) ([]byte, string, error) {
+	for _, v := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, "", fmt.Errorf("%w: line break in header", ErrInvalidMessage)
+		}
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: recipient: %v", ErrInvalidMessage, err)
+	}
+
+	msgID := make([]byte, 16)
+	if _, err := rand.Read(msgID); err != nil {
+		return nil, "", err
+	}
+	domain := "localhost"
+	if fromAddr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndexByte(fromAddr.Address, '@'); at >= 0 {
+			domain = fromAddr.Address[at+1:]
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(msgID), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, "", err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), to.Address, nil
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/services"
+)
+
+func TestAPITokenAuthRejections(t *testing.T) {
+	db := newTestDB(t)
+	authService := services.NewAuthService(models.NewUserDatabase(db), models.NewSessionDatabase(db),
+		models.NewLoginAttemptDatabase(db), services.LockoutConfig{})
+	h := APITokenAuth(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("rejected request reached the handler")
+	}))
+
+	tests := []struct {
+		name      string
+		header    string
+		wantError string
+	}{
+		{"unsupported scheme", "Basic dXNlcjpwYXNz", "Unsupported authorization scheme"},
+		{"unknown token", "Bearer not-a-token", "Invalid or expired API token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/users", nil)
+			r.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+			var body struct {
+				Success bool   `json:"success"`
+				Error   string `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || body.Success || body.Error != tt.wantError {
+				t.Errorf("body = %+v, %v; want error %q", body, err, tt.wantError)
+			}
+		})
+	}
+}
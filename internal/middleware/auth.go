@@ -28,8 +28,26 @@ func SessionCookieName(secure bool) string {
 	return "session_token"
 }
 
+// setRotatedSessionCookie sends the session's new token after a rotation; it
+// does nothing when rotated is nil
+func setRotatedSessionCookie(w http.ResponseWriter, cookieName string, secureCookie bool, rotated *services.RotatedSession) {
+	if rotated == nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    rotated.Token,
+		Path:     "/",
+		MaxAge:   int(rotated.MaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secureCookie,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
 // RequireAuth middleware validates the session cookie and injects the user
-// into the request context. Redirects to /login if not authenticated.
+// into the request context, sending a new cookie when the session token is
+// rotated. Redirects to /login if not authenticated.
 func RequireAuth(authService *services.AuthService, secureCookie bool) func(http.Handler) http.Handler {
 	cookieName := SessionCookieName(secureCookie)
 
@@ -41,7 +59,7 @@ func RequireAuth(authService *services.AuthService, secureCookie bool) func(http
 				return
 			}
 
-			user, err := authService.ValidateSession(cookie.Value)
+			user, rotated, err := authService.AuthenticateSession(cookie.Value)
 			if err != nil || user == nil {
 				// Clear the invalid cookie
 				http.SetCookie(w, &http.Cookie{
@@ -57,6 +75,8 @@ func RequireAuth(authService *services.AuthService, secureCookie bool) func(http
 				return
 			}
 
+			setRotatedSessionCookie(w, cookieName, secureCookie, rotated)
+
 			// Prevent search engines from indexing auth-required pages.
 			w.Header().Set("X-Robots-Tag", "noindex, follow")
 			ctx := context.WithValue(r.Context(), userContextKey{}, user)
@@ -78,7 +98,7 @@ func RequireAuthAPI(authService *services.AuthService, secureCookie bool) func(h
 				return
 			}
 
-			user, err := authService.ValidateSession(cookie.Value)
+			user, rotated, err := authService.AuthenticateSession(cookie.Value)
 			if err != nil || user == nil {
 				http.SetCookie(w, &http.Cookie{
 					Name:     cookieName,
@@ -93,22 +113,46 @@ func RequireAuthAPI(authService *services.AuthService, secureCookie bool) func(h
 				return
 			}
 
+			setRotatedSessionCookie(w, cookieName, secureCookie, rotated)
 			ctx := context.WithValue(r.Context(), userContextKey{}, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// RequireAdmin middleware checks that the authenticated user has the "admin" role.
-// Must be used after RequireAuth or RequireAuthAPI — the user must already be in context.
-// Returns 403 JSON for API routes.
-func RequireAdmin() func(http.Handler) http.Handler {
+// RequirePermission middleware declares the permission a route needs: users
+// whose role does not hold it (at any scope) get a 403 from onError, or a
+// plain-text 403 if onError is nil. Handlers of permissions that can be
+// granted for the user's own resources still check the resource itself.
+// Must be used after RequireAuth — the user must already be in context.
+func RequirePermission(authz *services.Authorizer, permission string, onError ErrorRenderer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authz.Has(UserFromContext(r.Context()), permission) {
+				if onError != nil {
+					onError(w, r, http.StatusForbidden)
+				} else {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermissionAPI is like RequirePermission but returns 401 or 403 JSON.
+// It can follow OptionalAuth, since a missing user gets the 401.
+func RequirePermissionAPI(authz *services.Authorizer, permission string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user := UserFromContext(r.Context())
-			if user == nil || user.Role != "admin" {
-				w.Header().Set("Content-Type", "application/json")
-				http.Error(w, `{"success":false,"error":"Admin access required"}`, http.StatusForbidden)
+			if user == nil {
+				http.Error(w, `{"success":false,"error":"Authentication required"}`, http.StatusUnauthorized)
+				return
+			}
+			if !authz.Has(user, permission) {
+				http.Error(w, `{"success":false,"error":"Permission denied"}`, http.StatusForbidden)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -119,15 +163,17 @@ func RequireAdmin() func(http.Handler) http.Handler {
 // OptionalAuth middleware reads the session cookie and populates the user
 // in context if authenticated, but does NOT block unauthenticated requests.
 // Used for pages that show different content based on auth state (e.g., sidebar).
+// A user already in context (from APITokenAuth) is kept and the cookie ignored.
 func OptionalAuth(authService *services.AuthService, secureCookie bool) func(http.Handler) http.Handler {
 	cookieName := SessionCookieName(secureCookie)
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			cookie, err := r.Cookie(cookieName)
-			if err == nil && cookie.Value != "" {
-				user, _ := authService.ValidateSession(cookie.Value)
+			if err == nil && cookie.Value != "" && UserFromContext(r.Context()) == nil {
+				user, rotated, _ := authService.AuthenticateSession(cookie.Value)
 				if user != nil {
+					setRotatedSessionCookie(w, cookieName, secureCookie, rotated)
 					ctx := context.WithValue(r.Context(), userContextKey{}, user)
 					r = r.WithContext(ctx)
 				}
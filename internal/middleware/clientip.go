@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"secure-ui-showcase-go/internal/ipfilter"
+)
+
+// PrivateProxyRanges are trusted when BEHIND_PROXY is set without an explicit
+// proxy list: loopback plus the private ranges reverse proxies and platform
+// edges (Fly's 6PN, Docker, Kubernetes) connect from.
+var PrivateProxyRanges = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or bare IPs
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	return ipfilter.ParsePrefixes(spec)
+}
+
+// ForwardedHeader names the header the trusted proxy sets with the client address
+type ForwardedHeader string
+
+const (
+	// HeaderXForwardedFor is the de facto X-Forwarded-For list (the default)
+	HeaderXForwardedFor ForwardedHeader = "X-Forwarded-For"
+	// HeaderForwarded is the RFC 7239 Forwarded header
+	HeaderForwarded ForwardedHeader = "Forwarded"
+	// HeaderXRealIP is a single address set by the proxy, as nginx's real_ip does
+	HeaderXRealIP ForwardedHeader = "X-Real-IP"
+)
+
+// ParseForwardedHeader parses a header name, case-insensitively.
+// An empty name selects HeaderXForwardedFor.
+func ParseForwardedHeader(name string) (ForwardedHeader, error) {
+	for _, h := range []ForwardedHeader{HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP} {
+		if strings.EqualFold(name, string(h)) {
+			return h, nil
+		}
+	}
+	if name == "" {
+		return HeaderXForwardedFor, nil
+	}
+	return "", fmt.Errorf("unsupported forwarding header %q", name)
+}
+
+// IPResolver determines the real client IP from the connection and proxy headers.
+// Forwarding headers are only read when the connecting peer is a trusted proxy, and
+// are walked right-to-left: each trusted hop vouches for the address to its left,
+// so the first untrusted address is the client. Anything further left was supplied
+// by the client itself and is ignored.
+//
+// Only the one header the proxy is configured to set is read. A proxy that
+// appends to X-Forwarded-For passes any Forwarded header the client sent
+// through untouched, so reading both would let the client pick its address.
+type IPResolver struct {
+	trusted []netip.Prefix
+	header  ForwardedHeader
+}
+
+// NewIPResolver creates a resolver that trusts the given proxy ranges and reads
+// the client address from header; an empty header means HeaderXForwardedFor.
+// With no trusted ranges, forwarding headers are never read.
+func NewIPResolver(trusted []netip.Prefix, header ForwardedHeader) *IPResolver {
+	if header == "" {
+		header = HeaderXForwardedFor
+	}
+	return &IPResolver{trusted: trusted, header: header}
+}
+
+// ClientIP returns the client IP for r
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	remote := remoteAddr(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !res.isTrusted(addr) {
+		return remote
+	}
+
+	hops := forwardedFor(r, res.header)
+	if len(hops) == 0 {
+		return remote
+	}
+
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			// Obfuscated or garbled hop: stop at the last address we could trust
+			break
+		}
+		client = hop
+		if !res.isTrusted(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// isTrusted reports whether addr falls in a trusted proxy range
+func (res *IPResolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the hop addresses from header, ordered client first.
+// Multiple header lines are combined in order, as both specs require.
+func forwardedFor(r *http.Request, header ForwardedHeader) []string {
+	var hops []string
+	switch header {
+	case HeaderForwarded:
+		for _, v := range r.Header.Values("Forwarded") {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					k, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(k, "for") {
+						hops = append(hops, val)
+					}
+				}
+			}
+		}
+	case HeaderXRealIP:
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+			hops = append(hops, xri)
+		}
+	default:
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop parses one forwarding hop: a bare IP, or a Forwarded node such as
+// 192.0.2.60, "192.0.2.60:4711" or "[2001:db8::1]:4711"
+func parseHop(hop string) (netip.Addr, error) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), nil
+	}
+	if ap, err := netip.ParseAddrPort(hop); err == nil {
+		return ap.Addr().Unmap(), nil
+	}
+	if strings.HasPrefix(hop, "[") {
+		if end := strings.IndexByte(hop, ']'); end > 0 {
+			if addr, err := netip.ParseAddr(hop[1:end]); err == nil {
+				return addr.Unmap(), nil
+			}
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("invalid forwarding hop %q", hop)
+}
+
+// remoteAddr returns the connecting peer's IP with the port stripped
+func remoteAddr(r *http.Request) string {
+	// RemoteAddr is "host:port"; strip the port
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// clientIPKey is a private type for the resolved client IP context key
+type clientIPKey struct{}
+
+// ResolveClientIP stores the resolved client IP in the request context so the
+// rate limiter, handlers and audit logs all agree on who the client is.
+func ResolveClientIP(res *IPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, res.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the client IP resolved by ResolveClientIP, or the connecting
+// peer's address when the request did not pass through that middleware.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteAddr(r)
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIPResolverClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name    string
+		header  ForwardedHeader
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:   "untrusted peer ignores headers",
+			remote: "203.0.113.9:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "203.0.113.9",
+		},
+		{
+			name:   "xff last untrusted hop is the client",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.2",
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:   "spoofed Forwarded behind an xff-only proxy is ignored",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=1.2.3.4",
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:   "spoofed Forwarded without xff falls back to the peer",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded": "for=1.2.3.4",
+			},
+			want: "10.0.0.1",
+		},
+		{
+			name:   "spoofed X-Real-IP behind an xff-only proxy is ignored",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Real-IP": "1.2.3.4",
+			},
+			want: "10.0.0.1",
+		},
+		{
+			name:   "Forwarded proxy ignores a spoofed xff",
+			header: HeaderForwarded,
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:4711"`,
+				"X-Forwarded-For": "1.2.3.4",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:   "Forwarded proxy without the header falls back to the peer",
+			header: HeaderForwarded,
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4",
+			},
+			want: "10.0.0.1",
+		},
+		{
+			name:   "X-Real-IP proxy",
+			header: HeaderXRealIP,
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Real-IP":       "198.51.100.7",
+				"X-Forwarded-For": "1.2.3.4",
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:   "garbled hop stops at the last trusted address",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1, unknown",
+			},
+			want: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := NewIPResolver(trusted, tt.header).ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForwardedHeader(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ForwardedHeader
+		wantErr bool
+	}{
+		{"", HeaderXForwardedFor, false},
+		{"x-forwarded-for", HeaderXForwardedFor, false},
+		{"Forwarded", HeaderForwarded, false},
+		{"X-REAL-IP", HeaderXRealIP, false},
+		{"CF-Connecting-IP", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseForwardedHeader(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseForwardedHeader(%q) = %q, %v; want %q, err=%t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
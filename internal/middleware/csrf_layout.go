@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// layoutCSRFAction is the only layout-level form action (navbar logout)
+	layoutCSRFAction = "/logout"
+	// maxLayoutSessions caps how many per-session layout tokens are cached
+	maxLayoutSessions = 10000
+)
+
+// layoutCSRFKey is a private type for the layout-level CSRF token context key.
+type layoutCSRFKey struct{}
+
+// layoutCSRF mints the layout token at most once per request, and only if a
+// template actually asks for it.
+type layoutCSRF struct {
+	once  sync.Once
+	mint  func() (string, error)
+	token string
+}
+
+// LayoutCSRFFromContext returns the layout CSRF token, minting it on first use.
+// This token is used by the navbar logout form and other layout-level forms.
+// Requests that never render such a form (API calls, static files, 404s,
+// anonymous page views) never create a token.
+func LayoutCSRFFromContext(ctx context.Context) string {
+	lc, ok := ctx.Value(layoutCSRFKey{}).(*layoutCSRF)
+	if !ok {
+		return ""
+	}
+	lc.once.Do(func() {
+		token, err := lc.mint()
+		if err != nil {
+			log.Printf("failed to generate layout CSRF token: %v", err)
+			return
+		}
+		lc.token = token
+	})
+	return lc.token
+}
+
+// layoutTokenEntry is a cached layout token and when it stops being reused
+type layoutTokenEntry struct {
+	token   string
+	reuseBy time.Time
+}
+
+// InjectLayoutCSRF stores a lazy layout CSRF token in the request context.
+// The token is bound to /logout and reused for every page a session renders
+// within reuseFor, so browsing does not create one token per request. reuseFor
+// should be well under the token TTL so a cached token never expires on the page.
+// The layout form is only rendered for signed-in users, so the session cookie is
+// always present to key the cache (and, in signed mode, to bind the token) before
+// the template starts writing the response.
+// The cache cleanup goroutine stops when ctx is cancelled.
+func InjectLayoutCSRF(ctx context.Context, csrf CSRFProtector, reuseFor time.Duration, secureCookie bool) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	cache := make(map[string]layoutTokenEntry)
+	cookieName := SessionCookieName(secureCookie)
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				now := time.Now()
+				mu.Lock()
+				for key, e := range cache {
+					if now.After(e.reuseBy) {
+						delete(cache, key)
+					}
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lc := &layoutCSRF{}
+			lc.mint = func() (string, error) {
+				cookie, err := r.Cookie(cookieName)
+				if err != nil || cookie.Value == "" {
+					return csrf.IssueToken(w, r, layoutCSRFAction)
+				}
+				key := hashBinding(cookie.Value)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if e, ok := cache[key]; ok && time.Now().Before(e.reuseBy) {
+					return e.token, nil
+				}
+				token, err := csrf.IssueToken(w, r, layoutCSRFAction)
+				if err != nil {
+					return "", err
+				}
+				// When full, stop caching new sessions rather than evicting
+				// live ones; those sessions just get a fresh token per page.
+				if _, ok := cache[key]; ok || len(cache) < maxLayoutSessions {
+					cache[key] = layoutTokenEntry{token: token, reuseBy: time.Now().Add(reuseFor)}
+				}
+				return token, nil
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), layoutCSRFKey{}, lc)))
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signed CSRF token errors, returned by SignedCSRF.CheckToken
+var (
+	ErrCSRFMissing   = errors.New("csrf token missing")
+	ErrCSRFMalformed = errors.New("csrf token malformed")
+	ErrCSRFSignature = errors.New("csrf token signature invalid")
+	ErrCSRFAction    = errors.New("csrf token issued for a different action")
+	ErrCSRFBinding   = errors.New("csrf token issued for a different session")
+	ErrCSRFExpired   = errors.New("csrf token expired")
+	ErrCSRFReplayed  = errors.New("csrf token already used")
+)
+
+const (
+	// signedCSRFVersion prefixes every token so the format can change later
+	signedCSRFVersion = "v1"
+	// csrfVisitorMaxAge is how long the anonymous CSRF visitor cookie lives
+	csrfVisitorMaxAge = 365 * 24 * 60 * 60 // 1 year
+	// Binding kinds: a token is bound either to the session cookie or, for
+	// anonymous visitors, to a random visitor cookie.
+	bindSession = "s"
+	bindVisitor = "v"
+)
+
+// SignedCSRF issues stateless HMAC-signed CSRF tokens. Each token encodes a hash of
+// the session (or anonymous visitor) it was issued to, the path it may be submitted
+// to, its issue time and a random nonce, so verification needs no token storage.
+// Single use is enforced by a replay cache of spent nonces; the cache is per process,
+// so instances behind a load balancer each reject replays they have seen themselves.
+type SignedCSRF struct {
+	key          []byte
+	ttl          time.Duration
+	secureCookie bool
+	// sessionKey maps a session cookie to an identifier that survives token
+	// rotation; nil binds tokens to the cookie value itself
+	sessionKey func(sessionToken string) string
+
+	spent map[string]time.Time
+	mu    sync.Mutex
+}
+
+// NewSignedCSRF creates a new signed CSRF token issuer.
+// The cleanup goroutine stops when ctx is cancelled.
+func NewSignedCSRF(ctx context.Context, key []byte, ttl time.Duration, secureCookie bool) *SignedCSRF {
+	s := &SignedCSRF{
+		key:          key,
+		ttl:          ttl,
+		secureCookie: secureCookie,
+		spent:        make(map[string]time.Time),
+	}
+
+	// Forget spent nonces once their tokens have expired anyway
+	go s.cleanupSpentNonces(ctx)
+
+	return s
+}
+
+// SetSessionKey binds session tokens to the identifier fn returns for the session
+// cookie instead of the cookie value, so forms stay valid when the session token
+// is rotated. fn returns "" for cookies with no session behind them, which stay
+// bound to the cookie value.
+func (s *SignedCSRF) SetSessionKey(fn func(sessionToken string) string) {
+	s.sessionKey = fn
+}
+
+// IssueToken returns a token that may only be submitted to action by the current
+// session or visitor. Anonymous visitors get a visitor cookie on first use.
+func (s *SignedCSRF) IssueToken(w http.ResponseWriter, r *http.Request, action string) (string, error) {
+	kind, value := s.binding(r)
+	if value == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to generate csrf visitor id: %w", err)
+		}
+		kind, value = bindVisitor, base64.RawURLEncoding.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.visitorCookieName(),
+			Value:    value,
+			Path:     "/",
+			MaxAge:   csrfVisitorMaxAge,
+			HttpOnly: true,
+			Secure:   s.secureCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// Action goes last so a path containing "|" cannot shift the other fields
+	claims := strings.Join([]string{
+		signedCSRFVersion,
+		kind,
+		hashBinding(value),
+		strconv.FormatInt(time.Now().Unix(), 10),
+		base64.RawURLEncoding.EncodeToString(nonce),
+		action,
+	}, "|")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+// CheckToken verifies the signature, action, binding and freshness of a token
+// and then spends its nonce, so each token is accepted at most once.
+func (s *SignedCSRF) CheckToken(r *http.Request, token string) error {
+	if token == "" {
+		return ErrCSRFMissing
+	}
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrCSRFMalformed
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return ErrCSRFMalformed
+	}
+	if !hmac.Equal(mac, s.sign(payload)) {
+		return ErrCSRFSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrCSRFMalformed
+	}
+	fields := strings.SplitN(string(raw), "|", 6)
+	if len(fields) != 6 || fields[0] != signedCSRFVersion {
+		return ErrCSRFMalformed
+	}
+	kind, bound, issued, nonce, action := fields[1], fields[2], fields[3], fields[4], fields[5]
+
+	if action != r.URL.Path {
+		return ErrCSRFAction
+	}
+
+	value := s.bindingValue(r, kind)
+	if value == "" || !hmac.Equal([]byte(hashBinding(value)), []byte(bound)) {
+		return ErrCSRFBinding
+	}
+
+	issuedUnix, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return ErrCSRFMalformed
+	}
+	issuedAt := time.Unix(issuedUnix, 0)
+	if time.Since(issuedAt) > s.ttl || time.Until(issuedAt) > time.Minute {
+		return ErrCSRFExpired
+	}
+
+	if !s.spend(nonce, issuedAt.Add(s.ttl)) {
+		return ErrCSRFReplayed
+	}
+	return nil
+}
+
+// binding returns what a newly issued token should be bound to:
+// the session cookie when present, otherwise the visitor cookie.
+func (s *SignedCSRF) binding(r *http.Request) (kind, value string) {
+	if v := s.bindingValue(r, bindSession); v != "" {
+		return bindSession, v
+	}
+	return bindVisitor, s.bindingValue(r, bindVisitor)
+}
+
+// bindingValue returns the cookie value for a binding kind, or "" if absent
+func (s *SignedCSRF) bindingValue(r *http.Request, kind string) string {
+	var name string
+	switch kind {
+	case bindSession:
+		name = SessionCookieName(s.secureCookie)
+	case bindVisitor:
+		name = s.visitorCookieName()
+	default:
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	if kind == bindSession && cookie.Value != "" && s.sessionKey != nil {
+		// The ":" cannot occur in a base64url cookie, so a forged cookie can
+		// never produce the same binding as a real session key
+		if key := s.sessionKey(cookie.Value); key != "" {
+			return "session:" + key
+		}
+	}
+	return cookie.Value
+}
+
+// visitorCookieName returns the anonymous visitor cookie name, __Host- prefixed in secure mode
+func (s *SignedCSRF) visitorCookieName() string {
+	if s.secureCookie {
+		return "__Host-csrf_vid"
+	}
+	return "csrf_vid"
+}
+
+// sign returns the HMAC-SHA-256 of the encoded claims
+func (s *SignedCSRF) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// spend records a nonce as used; returns false if it was already spent
+func (s *SignedCSRF) spend(nonce string, expiry time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, seen := s.spent[nonce]; seen {
+		return false
+	}
+	s.spent[nonce] = expiry
+	return true
+}
+
+// cleanupSpentNonces removes nonces whose tokens have expired until ctx is cancelled
+func (s *SignedCSRF) cleanupSpentNonces(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			s.mu.Lock()
+			for nonce, expiry := range s.spent {
+				if now.After(expiry) {
+					delete(s.spent, nonce)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// hashBinding hashes a session or visitor cookie so the token, which is
+// embedded in HTML, never reveals the cookie value itself
+func hashBinding(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
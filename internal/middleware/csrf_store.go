@@ -0,0 +1,303 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// TokenStore issues and checks single-use CSRF tokens.
+// CSRFTokenStore keeps tokens in process memory; SQLiteCSRFTokenStore shares
+// them through the database so tokens survive restarts and work across instances.
+type TokenStore interface {
+	// GenerateToken creates and records a new token
+	GenerateToken() (string, error)
+	// ValidateToken reports whether a token is valid without consuming it
+	ValidateToken(token string) bool
+	// ConsumeToken atomically validates and deletes a token
+	ConsumeToken(token string) bool
+	// DeleteToken removes a token after use
+	DeleteToken(token string)
+	// Stats reports the store size and eviction counters
+	Stats() TokenStoreStats
+}
+
+// DefaultMaxCSRFTokens caps a token store when no explicit limit is given
+const DefaultMaxCSRFTokens = 100000
+
+// TokenStoreStats reports how full a token store is and how tokens have left it.
+// A rising Evicted count means tokens are being dropped before they expire,
+// typically because crawlers or scripted clients are requesting pages in bulk.
+type TokenStoreStats struct {
+	Size    int
+	MaxSize int
+	Evicted int64 // removed early because the store was full
+	Expired int64 // removed by the cleanup job after their TTL
+}
+
+// logTokenStoreStats writes one line per cleanup pass, so eviction pressure shows up in logs
+func logTokenStoreStats(backend string, st TokenStoreStats) {
+	log.Printf("[CSRF] store=%s size=%d max=%d evicted=%d expired=%d",
+		backend, st.Size, st.MaxSize, st.Evicted, st.Expired)
+}
+
+// CSRFProtector issues and checks CSRF tokens for handlers and the CSRF middleware.
+// StoreProtector wraps a stateful TokenStore; SignedCSRF needs no token storage.
+type CSRFProtector interface {
+	// IssueToken returns a token for a form that submits to action
+	IssueToken(w http.ResponseWriter, r *http.Request, action string) (string, error)
+	// CheckToken returns nil if token may be spent on r, consuming it
+	CheckToken(r *http.Request, token string) error
+}
+
+// ErrCSRFInvalid is returned by StoreProtector for unknown, expired or spent tokens
+var ErrCSRFInvalid = errors.New("csrf token invalid")
+
+// Compile-time checks that the stores and protectors satisfy their interfaces
+var (
+	_ TokenStore    = (*CSRFTokenStore)(nil)
+	_ TokenStore    = (*SQLiteCSRFTokenStore)(nil)
+	_ CSRFProtector = StoreProtector{}
+	_ CSRFProtector = (*SignedCSRF)(nil)
+)
+
+// StoreProtector adapts a TokenStore to CSRFProtector.
+// Stored tokens are single-use but not bound to an action or session.
+type StoreProtector struct {
+	Store TokenStore
+}
+
+// IssueToken generates a token from the store; the action is not recorded
+func (p StoreProtector) IssueToken(_ http.ResponseWriter, _ *http.Request, _ string) (string, error) {
+	return p.Store.GenerateToken()
+}
+
+// CheckToken consumes the token from the store
+func (p StoreProtector) CheckToken(_ *http.Request, token string) error {
+	if token == "" {
+		return ErrCSRFMissing
+	}
+	if !p.Store.ConsumeToken(token) {
+		return ErrCSRFInvalid
+	}
+	return nil
+}
+
+// sqliteTimeFormat matches the DATETIME format written by CURRENT_TIMESTAMP
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// SQLiteCSRFTokenStore persists CSRF tokens in the csrf_tokens table
+// (or ceremony challenges in webauthn_challenges, see NewSQLiteChallengeStore).
+// Only a SHA-256 hash of each token is stored, so a copy of the database
+// cannot be used to forge requests. The size cap is enforced on every insert,
+// in the same transaction, so the table never exceeds it.
+type SQLiteCSRFTokenStore struct {
+	db        *sql.DB
+	table     string
+	ttl       time.Duration
+	maxTokens int
+	evicted   atomic.Int64
+	expired   atomic.Int64
+}
+
+// NewSQLiteCSRFTokenStore creates a new database-backed CSRF token store.
+// maxTokens caps the table size; pass 0 to use DefaultMaxCSRFTokens.
+// The cleanup goroutine stops when ctx is cancelled.
+func NewSQLiteCSRFTokenStore(ctx context.Context, db *sql.DB, ttl time.Duration, maxTokens int) *SQLiteCSRFTokenStore {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxCSRFTokens
+	}
+	store := &SQLiteCSRFTokenStore{db: db, table: "csrf_tokens", ttl: ttl, maxTokens: maxTokens}
+
+	// Clean up expired tokens every 5 minutes
+	go store.cleanupExpiredTokens(ctx)
+
+	return store
+}
+
+// NewSQLiteChallengeStore creates a store for WebAuthn ceremony challenges.
+// It shares the CSRF store's semantics (hashed, single-use, expiring) but
+// keeps its tokens in webauthn_challenges, so a challenge can never be spent
+// as a CSRF token or the other way round.
+func NewSQLiteChallengeStore(ctx context.Context, db *sql.DB, ttl time.Duration, maxTokens int) *SQLiteCSRFTokenStore {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxCSRFTokens
+	}
+	store := &SQLiteCSRFTokenStore{db: db, table: "webauthn_challenges", ttl: ttl, maxTokens: maxTokens}
+	go store.cleanupExpiredTokens(ctx)
+	return store
+}
+
+// GenerateToken creates a new CSRF token
+func (s *SQLiteCSRFTokenStore) GenerateToken() (string, error) {
+	return s.GenerateBoundToken("")
+}
+
+// GenerateBoundToken creates a token that can only be consumed together with
+// binding (a user ID, or a hash of a browser cookie). The binding is folded
+// into the stored hash rather than kept alongside it.
+func (s *SQLiteCSRFTokenStore) GenerateBoundToken(binding string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	token := base64.URLEncoding.EncodeToString(b)
+	expiresAt := time.Now().Add(s.ttl).UTC().Format(sqliteTimeFormat)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to store CSRF token: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO "+s.table+" (token_hash, expires_at) VALUES (?, ?)",
+		boundTokenHash(token, binding), expiresAt,
+	); err != nil {
+		return "", fmt.Errorf("failed to store CSRF token: %w", err)
+	}
+	evicted, err := s.evictOldest(tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to evict CSRF tokens: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to store CSRF token: %w", err)
+	}
+	s.evicted.Add(evicted)
+
+	return token, nil
+}
+
+// evictOldest deletes the tokens that expire soonest until at most maxTokens
+// remain. Ties fall to the earliest insert, so a token just issued is kept.
+func (s *SQLiteCSRFTokenStore) evictOldest(tx *sql.Tx) (int64, error) {
+	result, err := tx.Exec(`
+		DELETE FROM `+s.table+` WHERE rowid IN (
+			SELECT rowid FROM `+s.table+`
+			ORDER BY expires_at, rowid
+			LIMIT max((SELECT COUNT(*) FROM `+s.table+`) - ?, 0)
+		)
+	`, s.maxTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ValidateToken checks if a token is valid and not expired without consuming it.
+// Prefer ConsumeToken for form/API validation to prevent replay attacks.
+func (s *SQLiteCSRFTokenStore) ValidateToken(token string) bool {
+	var n int
+	err := s.db.QueryRow(
+		"SELECT COUNT(*) FROM "+s.table+" WHERE token_hash = ? AND expires_at > ?",
+		hashCSRFToken(token), time.Now().UTC().Format(sqliteTimeFormat),
+	).Scan(&n)
+	if err != nil {
+		log.Printf("Failed to validate CSRF token: %v", err)
+		return false
+	}
+	return n > 0
+}
+
+// ConsumeToken atomically validates and deletes a token.
+// The single DELETE ensures that when several instances share the database,
+// only one of them can accept a given token.
+func (s *SQLiteCSRFTokenStore) ConsumeToken(token string) bool {
+	return s.ConsumeBoundToken(token, "")
+}
+
+// ConsumeBoundToken is ConsumeToken for a token issued by GenerateBoundToken;
+// it fails, leaving the token in place, when binding differs from the issued one.
+func (s *SQLiteCSRFTokenStore) ConsumeBoundToken(token, binding string) bool {
+	result, err := s.db.Exec(
+		"DELETE FROM "+s.table+" WHERE token_hash = ? AND expires_at > ?",
+		boundTokenHash(token, binding), time.Now().UTC().Format(sqliteTimeFormat),
+	)
+	if err != nil {
+		log.Printf("Failed to consume CSRF token: %v", err)
+		return false
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		log.Printf("Failed to consume CSRF token: %v", err)
+		return false
+	}
+	return n > 0
+}
+
+// DeleteToken removes a token after use
+func (s *SQLiteCSRFTokenStore) DeleteToken(token string) {
+	if _, err := s.db.Exec("DELETE FROM "+s.table+" WHERE token_hash = ?", hashCSRFToken(token)); err != nil {
+		log.Printf("Failed to delete CSRF token: %v", err)
+	}
+}
+
+// cleanupExpiredTokens removes expired tokens periodically until ctx is cancelled
+func (s *SQLiteCSRFTokenStore) cleanupExpiredTokens(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.cleanup()
+			logTokenStoreStats("sqlite:"+s.table, s.Stats())
+		}
+	}
+}
+
+// cleanup deletes expired tokens; the size cap is already held by GenerateToken
+func (s *SQLiteCSRFTokenStore) cleanup() {
+	result, err := s.db.Exec(
+		"DELETE FROM "+s.table+" WHERE expires_at <= ?",
+		time.Now().UTC().Format(sqliteTimeFormat),
+	)
+	if err != nil {
+		log.Printf("Failed to clean up expired CSRF tokens: %v", err)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		s.expired.Add(n)
+	}
+}
+
+// Stats reports the store size and how many tokens have been evicted or expired
+func (s *SQLiteCSRFTokenStore) Stats() TokenStoreStats {
+	st := TokenStoreStats{
+		MaxSize: s.maxTokens,
+		Evicted: s.evicted.Load(),
+		Expired: s.expired.Load(),
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM " + s.table).Scan(&st.Size); err != nil {
+		log.Printf("Failed to count CSRF tokens: %v", err)
+	}
+	return st
+}
+
+// hashCSRFToken returns the value stored in place of a raw token
+func hashCSRFToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// boundTokenHash returns the value stored for a token issued to binding; an
+// unbound token hashes as itself. Tokens have a fixed length, so the binding
+// cannot be shifted into the token part.
+func boundTokenHash(token, binding string) string {
+	if binding == "" {
+		return hashCSRFToken(token)
+	}
+	return hashCSRFToken(token + "\x00" + binding)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSQLiteCSRFTokenStoreCapOnInsert(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const max = 3
+	store := NewSQLiteCSRFTokenStore(ctx, db, time.Hour, max)
+	tokens := make([]string, 5)
+	for i := range tokens {
+		var err error
+		if tokens[i], err = store.GenerateToken(); err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		if st := store.Stats(); st.Size > max {
+			t.Fatalf("after %d inserts size = %d, want at most %d", i+1, st.Size, max)
+		}
+	}
+
+	st := store.Stats()
+	if st.Size != max || st.Evicted != 2 || st.Expired != 0 {
+		t.Errorf("Stats() = %+v, want size %d, evicted 2, expired 0", st, max)
+	}
+	for i, tok := range tokens {
+		if want := i >= len(tokens)-max; store.ValidateToken(tok) != want {
+			t.Errorf("token %d valid = %t, want %t", i, !want, want)
+		}
+	}
+}
+
+func TestSQLiteChallengeStoreBinding(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := NewSQLiteChallengeStore(ctx, db, time.Hour, 0)
+	token, err := store.GenerateBoundToken("user:1")
+	if err != nil {
+		t.Fatalf("GenerateBoundToken: %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		binding string
+		want    bool
+	}{
+		{"other binding", "user:2", false},
+		{"no binding", "", false},
+		{"issued binding", "user:1", true},
+		{"spent", "user:1", false},
+	}
+	for _, st := range steps {
+		if got := store.ConsumeBoundToken(token, st.binding); got != st.want {
+			t.Errorf("%s: ConsumeBoundToken = %t, want %t", st.name, got, st.want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"secure-ui-showcase-go/internal/database"
+)
+
+// newTestDB returns a fresh database that is closed when the test ends
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	return db
+}
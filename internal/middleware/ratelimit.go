@@ -0,0 +1,312 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"secure-ui-showcase-go/internal/ipfilter"
+)
+
+// Rate is a request quota: at most Limit requests per Period, with bursts of up to Limit.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// interval is the GCRA emission interval: the time one request "costs"
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Decision is the outcome of a Limiter check
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // requests still allowed right now
+	ResetAfter time.Duration // until the quota is fully replenished
+	RetryAfter time.Duration // until the next request will be allowed; 0 when Allowed
+}
+
+// Limit is one quota a request is checked against: a key and the Rate it is held to
+type Limit struct {
+	Key  string
+	Rate Rate
+}
+
+// Limiter applies a Rate to requests grouped by key.
+// Implementations use GCRA (the generic cell rate algorithm), which stores a single
+// timestamp per key instead of a log of recent requests.
+type Limiter interface {
+	// Allow checks a request against every limit and records it against all of
+	// them only if each one allows it, so a request refused by one limit spends
+	// no quota on the others. Decisions are returned in the order of limits,
+	// whose keys must be distinct.
+	Allow(ctx context.Context, limits ...Limit) ([]Decision, error)
+}
+
+// gcra applies the generic cell rate algorithm. tat is the key's theoretical
+// arrival time (zero if unseen); it returns the decision and the new tat to store.
+// A key is allowed while its tat stays within one Period of now, which permits
+// bursts of up to Limit requests and then one request every Period/Limit.
+func gcra(now, tat time.Time, rate Rate) (Decision, time.Time) {
+	d := Decision{Limit: rate.Limit}
+	if rate.Limit <= 0 || rate.Period <= 0 {
+		d.Allowed, d.Remaining = true, 0
+		return d, tat
+	}
+
+	interval := rate.interval()
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-rate.Period)
+
+	if now.Before(allowAt) {
+		d.RetryAfter = allowAt.Sub(now)
+		d.ResetAfter = tat.Sub(now)
+		return d, tat
+	}
+
+	d.Allowed = true
+	d.ResetAfter = newTAT.Sub(now)
+	d.Remaining = int((rate.Period - d.ResetAfter) / interval)
+	return d, newTAT
+}
+
+// limiterShards is the number of independently locked shards in MemoryLimiter
+const limiterShards = 64
+
+// limiterShard is one lock-protected slice of the MemoryLimiter key space
+type limiterShard struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+// MemoryLimiter is an in-process Limiter. Keys are spread over independently
+// locked shards so concurrent requests from different clients rarely contend,
+// and each key costs one timestamp regardless of its limit.
+type MemoryLimiter struct {
+	shards [limiterShards]limiterShard
+}
+
+// NewMemoryLimiter creates a new in-memory limiter.
+// The cleanup goroutine (every 1 minute) evicts keys whose quota has fully
+// replenished, bounding memory to O(recently active keys).
+// The cleanup goroutine stops when ctx is cancelled.
+func NewMemoryLimiter(ctx context.Context) *MemoryLimiter {
+	l := &MemoryLimiter{}
+	for i := range l.shards {
+		l.shards[i].tats = make(map[string]time.Time)
+	}
+
+	go l.cleanupOldEntries(ctx)
+
+	return l
+}
+
+// Allow checks whether a request fits within every limit and records it
+// against all of them if so. The shards involved are locked in index order,
+// so concurrent calls cannot deadlock.
+func (l *MemoryLimiter) Allow(_ context.Context, limits ...Limit) ([]Decision, error) {
+	shards := make([]int, len(limits))
+	for i, lim := range limits {
+		shards[i] = shardIndex(lim.Key)
+	}
+	locked := slices.Compact(slices.Sorted(slices.Values(shards)))
+	for _, i := range locked {
+		l.shards[i].mu.Lock()
+	}
+	defer func() {
+		for _, i := range locked {
+			l.shards[i].mu.Unlock()
+		}
+	}()
+
+	now := time.Now()
+	decisions := make([]Decision, len(limits))
+	tats := make([]time.Time, len(limits))
+	allowed := true
+	for i, lim := range limits {
+		decisions[i], tats[i] = gcra(now, l.shards[shards[i]].tats[lim.Key], lim.Rate)
+		allowed = allowed && decisions[i].Allowed
+	}
+	if allowed {
+		for i, lim := range limits {
+			l.shards[shards[i]].tats[lim.Key] = tats[i]
+		}
+	}
+	return decisions, nil
+}
+
+// shardIndex returns the index of the shard responsible for key
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % limiterShards)
+}
+
+// cleanupOldEntries removes fully replenished keys until ctx is cancelled
+func (l *MemoryLimiter) cleanupOldEntries(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			for i := range l.shards {
+				s := &l.shards[i]
+				s.mu.Lock()
+				for key, tat := range s.tats {
+					if tat.Before(now) {
+						delete(s.tats, key)
+					}
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// RateLimitConfig configures the RateLimit middleware
+type RateLimitConfig struct {
+	Limiter      Limiter
+	Policies     []RatePolicy
+	Buckets      ipfilter.Bucketer // how client IPs are grouped into rate limit keys
+	Access       *ipfilter.List    // allowlisted clients skip limits; denylisted ones are refused
+	SecureCookie bool              // selects the session cookie name for RateKeyUser
+	// UserKey returns the user signed in with a session token, or "" when the
+	// token has no live session. RateKeyUser policies fall back to the client
+	// IP without it.
+	UserKey func(sessionToken string) string
+}
+
+// RateLimit middleware applies every matching policy to the request; the request
+// is rejected if any of them is exhausted, and then counts against none of them.
+// Client IPs are grouped by cfg.Buckets (an IPv6 /64 by default) so a host cannot
+// rotate addresses to dodge limits. Allowlisted clients bypass the limits entirely;
+// denylisted clients get a 403 and a security log entry instead of a 429.
+// Limited routes get the IETF RateLimit-Policy and RateLimit headers listing each
+// matching policy, and rejections add Retry-After. Rejected /api/ requests get a
+// JSON body so scripted clients can back off; other routes render onError.
+// Static assets (/static/, /components/, /favicon.ico) are exempt so that
+// error pages can load their CSS/JS even when the limit is exceeded.
+// Limiter errors fail closed with a 503 and a security log entry: the limiter
+// guards the login and recovery routes, and the SQLite backend only errors
+// when the database the rest of the site needs is unavailable too.
+// If onError is nil, a plain-text response is returned.
+func RateLimit(cfg RateLimitConfig, onError ErrorRenderer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Allow static assets through without rate limiting
+			path := r.URL.Path
+			if strings.HasPrefix(path, "/static/") ||
+				strings.HasPrefix(path, "/components/") ||
+				path == "/favicon.ico" || path == "/favicon.svg" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := ClientIP(r)
+
+			if cfg.Access.Denied(ip) {
+				log.Printf("[SECURITY] denylisted client refused: ip=%s method=%s path=%s ua=%.200s",
+					ip, r.Method, path, r.UserAgent())
+				writeLimitError(w, r, http.StatusForbidden, "Access denied.", nil, onError)
+				return
+			}
+			if cfg.Access.Allowed(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			bucket := cfg.Buckets.Key(ip)
+
+			var matched []RatePolicy
+			var limits []Limit
+			for _, p := range cfg.Policies {
+				if p.Matches(r) {
+					matched = append(matched, p)
+					limits = append(limits, Limit{Key: rateKey(r, p, bucket, cfg), Rate: p.Rate})
+				}
+			}
+			if len(matched) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decisions, err := cfg.Limiter.Allow(r.Context(), limits...)
+			if err != nil {
+				log.Printf("[SECURITY] rate limiter error, refusing request: ip=%s method=%s path=%s err=%v",
+					ip, r.Method, path, err)
+				writeLimitError(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable. Please try again later.", nil, onError)
+				return
+			}
+
+			policyHdr := make([]string, len(matched))
+			stateHdr := make([]string, len(matched))
+			var denied *Decision
+			for i, p := range matched {
+				d := decisions[i]
+				policyHdr[i] = fmt.Sprintf("%q;q=%d;w=%d", p.Name, p.Rate.Limit, ceilSeconds(p.Rate.Period))
+				stateHdr[i] = fmt.Sprintf("%q;r=%d;t=%d", p.Name, d.Remaining, ceilSeconds(d.ResetAfter))
+				if !d.Allowed && denied == nil {
+					denied = &d
+				}
+			}
+			w.Header().Set("RateLimit-Policy", strings.Join(policyHdr, ", "))
+			w.Header().Set("RateLimit", strings.Join(stateHdr, ", "))
+
+			if denied != nil {
+				retryAfter := ceilSeconds(denied.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeLimitError(w, r, http.StatusTooManyRequests, "Rate limit exceeded. Please try again later.",
+					map[string]any{"retryAfter": retryAfter}, onError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeLimitError rejects a request: JSON under /api/, otherwise the styled
+// error page (or plain text when onError is nil). extra is merged into the JSON body.
+func writeLimitError(w http.ResponseWriter, r *http.Request, status int, message string, extra map[string]any, onError ErrorRenderer) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		body := map[string]any{"success": false, "error": message}
+		for k, v := range extra {
+			body[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.Printf("failed to encode rate limit response: %v", err)
+		}
+	case onError != nil:
+		onError(w, r, status)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+// ceilSeconds rounds a duration up to whole seconds, as the rate limit headers require
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// RateKey selects what a RatePolicy counts requests against
+type RateKey string
+
+const (
+	// RateKeyIP counts requests per client IP
+	RateKeyIP RateKey = "ip"
+	// RateKeyUser counts requests per signed-in user, falling back to IP when
+	// there is no valid session (see RateLimitConfig.UserKey)
+	RateKeyUser RateKey = "user"
+	// RateKeyEmail counts requests per submitted email address from each client
+	// bucket, falling back to IP. Keying on the email alone would let anyone spend
+	// a named victim's quota; attacks on one account from many IPs are left to
+	// the account lockout.
+	RateKeyEmail RateKey = "email"
+)
+
+// maxKeyBodyBytes bounds how much of a JSON body is buffered to find an email key
+const maxKeyBodyBytes = 64 << 10
+
+// RatePolicy limits requests matching Method and Pattern.
+// Pattern is an exact path, or a prefix when it ends in "*" ("/api/demo/*").
+// An empty Method matches every method.
+type RatePolicy struct {
+	Name    string
+	Method  string
+	Pattern string
+	Rate    Rate
+	KeyBy   RateKey
+}
+
+// Matches reports whether the policy applies to r
+func (p RatePolicy) Matches(r *http.Request) bool {
+	if p.Method != "" && !strings.EqualFold(p.Method, r.Method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(p.Pattern, "*"); ok {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+	return r.URL.Path == p.Pattern
+}
+
+// DefaultRatePolicies is used when no policy file is configured.
+// Every matching policy applies, so the catch-all keeps the global per-IP limit
+// while the route policies add tighter limits on top. Account changes are keyed
+// by user, so one account cannot dodge its limit by switching networks.
+func DefaultRatePolicies() []RatePolicy {
+	return []RatePolicy{
+		{Name: "login", Method: http.MethodPost, Pattern: "/login", Rate: Rate{Limit: 5, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "login-email", Method: http.MethodPost, Pattern: "/login", Rate: Rate{Limit: 10, Period: 15 * time.Minute}, KeyBy: RateKeyEmail},
+		{Name: "login-mfa", Method: http.MethodPost, Pattern: "/login/mfa", Rate: Rate{Limit: 5, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "oidc", Method: http.MethodGet, Pattern: "/login/oidc*", Rate: Rate{Limit: 10, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "magic-link", Method: http.MethodPost, Pattern: "/login/magic-link", Rate: Rate{Limit: 5, Period: time.Hour}, KeyBy: RateKeyIP},
+		{Name: "magic-link-email", Method: http.MethodPost, Pattern: "/login/magic-link", Rate: Rate{Limit: 3, Period: time.Hour}, KeyBy: RateKeyEmail},
+		{Name: "magic-link-verify", Method: http.MethodPost, Pattern: "/login/magic-link/verify", Rate: Rate{Limit: 5, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "webauthn", Method: http.MethodPost, Pattern: "/api/webauthn/*", Rate: Rate{Limit: 10, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "register", Method: http.MethodPost, Pattern: "/register", Rate: Rate{Limit: 5, Period: time.Hour}, KeyBy: RateKeyIP},
+		{Name: "forgot-password", Method: http.MethodPost, Pattern: "/forgot-password", Rate: Rate{Limit: 5, Period: time.Hour}, KeyBy: RateKeyIP},
+		{Name: "forgot-password-email", Method: http.MethodPost, Pattern: "/forgot-password", Rate: Rate{Limit: 3, Period: time.Hour}, KeyBy: RateKeyEmail},
+		{Name: "reset-password", Method: http.MethodPost, Pattern: "/reset-password", Rate: Rate{Limit: 10, Period: time.Hour}, KeyBy: RateKeyIP},
+		{Name: "verify-email-resend", Method: http.MethodPost, Pattern: "/verify-email/resend", Rate: Rate{Limit: 5, Period: time.Hour}, KeyBy: RateKeyIP},
+		{Name: "verify-email-resend-email", Method: http.MethodPost, Pattern: "/verify-email/resend", Rate: Rate{Limit: 3, Period: time.Hour}, KeyBy: RateKeyEmail},
+		{Name: "profile", Method: http.MethodPost, Pattern: "/profile/*", Rate: Rate{Limit: 20, Period: time.Minute}, KeyBy: RateKeyUser},
+		{Name: "demo-submit", Method: http.MethodPost, Pattern: "/api/demo/*", Rate: Rate{Limit: 30, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "api-users-read", Method: http.MethodGet, Pattern: "/api/users*", Rate: Rate{Limit: 60, Period: time.Minute}, KeyBy: RateKeyIP},
+		{Name: "global", Pattern: "/*", Rate: Rate{Limit: 100, Period: time.Minute}, KeyBy: RateKeyIP},
+	}
+}
+
+// ratePolicyFile is the JSON form of a RatePolicy; period is a Go duration ("1m", "15m")
+type ratePolicyFile struct {
+	Name    string  `json:"name"`
+	Method  string  `json:"method"`
+	Pattern string  `json:"pattern"`
+	Limit   int     `json:"limit"`
+	Period  string  `json:"period"`
+	Key     RateKey `json:"key"`
+}
+
+// LoadRatePolicies reads a JSON array of policies from path, for example:
+//
+//	[{"name": "login", "method": "POST", "pattern": "/login", "limit": 5, "period": "1m", "key": "ip"}]
+func LoadRatePolicies(path string) ([]RatePolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit policies: %w", err)
+	}
+	var raw []ratePolicyFile
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limit policies: %w", err)
+	}
+
+	policies := make([]RatePolicy, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for i, p := range raw {
+		if p.Name == "" || seen[p.Name] {
+			return nil, fmt.Errorf("rate limit policy %d: name must be set and unique", i)
+		}
+		seen[p.Name] = true
+		if !strings.HasPrefix(p.Pattern, "/") {
+			return nil, fmt.Errorf("rate limit policy %q: pattern must start with /", p.Name)
+		}
+		period, err := time.ParseDuration(p.Period)
+		if err != nil || period <= 0 || p.Limit <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q: limit and period must be positive", p.Name)
+		}
+		key := p.Key
+		switch key {
+		case "":
+			key = RateKeyIP
+		case RateKeyIP, RateKeyUser, RateKeyEmail:
+		default:
+			return nil, fmt.Errorf("rate limit policy %q: unknown key %q", p.Name, p.Key)
+		}
+		policies = append(policies, RatePolicy{
+			Name:    p.Name,
+			Method:  strings.ToUpper(p.Method),
+			Pattern: p.Pattern,
+			Rate:    Rate{Limit: p.Limit, Period: period},
+			KeyBy:   key,
+		})
+	}
+	return policies, nil
+}
+
+// rateKey returns the limiter key for a request under policy p.
+// Keys are namespaced by policy so each policy keeps its own quota;
+// bucket is the client's normalized IP bucket.
+func rateKey(r *http.Request, p RatePolicy, bucket string, cfg RateLimitConfig) string {
+	switch p.KeyBy {
+	case RateKeyUser:
+		// The cookie is only trusted once it resolves to a user: keying by its
+		// value would give every made-up cookie, and every rotation, a fresh quota
+		if cfg.UserKey != nil {
+			if cookie, err := r.Cookie(SessionCookieName(cfg.SecureCookie)); err == nil && cookie.Value != "" {
+				if user := cfg.UserKey(cookie.Value); user != "" {
+					return p.Name + ":user:" + user
+				}
+			}
+		}
+	case RateKeyEmail:
+		if email := emailFromRequest(r); email != "" {
+			return p.Name + ":email:" + email + ":ip:" + bucket
+		}
+	}
+	return p.Name + ":ip:" + bucket
+}
+
+// emailFromRequest reads the "email" field from a form or JSON body without
+// consuming it: form values are cached by ParseForm, and JSON bodies are
+// buffered and restored for the handler.
+func emailFromRequest(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBodyBytes+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		if err != nil || len(buf) > maxKeyBodyBytes {
+			return ""
+		}
+		var body struct {
+			Email string `json:"email"`
+		}
+		if json.Unmarshal(buf, &body) != nil {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(body.Email))
+	}
+	return strings.ToLower(strings.TrimSpace(r.PostFormValue("email")))
+}
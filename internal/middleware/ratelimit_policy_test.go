@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateKeyUser(t *testing.T) {
+	p := RatePolicy{Name: "p", Rate: Rate{Limit: 1, Period: time.Minute}, KeyBy: RateKeyUser}
+	sessions := map[string]string{"live-token": "42", "rotated-token": "42"}
+	cfg := RateLimitConfig{UserKey: func(token string) string { return sessions[token] }}
+
+	tests := []struct {
+		name   string
+		cookie string
+		cfg    RateLimitConfig
+		want   string
+	}{
+		{"live session keys by user", "live-token", cfg, "p:user:42"},
+		{"rotated token keeps the same key", "rotated-token", cfg, "p:user:42"},
+		{"made-up cookie falls back to IP", "random", cfg, "p:ip:bucket"},
+		{"no cookie falls back to IP", "", cfg, "p:ip:bucket"},
+		{"no resolver falls back to IP", "live-token", RateLimitConfig{}, "p:ip:bucket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: SessionCookieName(false), Value: tt.cookie})
+			}
+			if got := rateKey(r, p, "bucket", tt.cfg); got != tt.want {
+				t.Errorf("rateKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateKeyEmail(t *testing.T) {
+	p := RatePolicy{Name: "p", Rate: Rate{Limit: 1, Period: time.Minute}, KeyBy: RateKeyEmail}
+
+	tests := []struct {
+		name   string
+		email  string
+		bucket string
+		want   string
+	}{
+		{"email from a client", "Victim@Example.com", "bucket", "p:email:victim@example.com:ip:bucket"},
+		{"same email from another client", "victim@example.com", "other", "p:email:victim@example.com:ip:other"},
+		{"no email falls back to IP", "", "bucket", "p:ip:bucket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"email": {tt.email}}
+			r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if got := rateKey(r, p, tt.bucket, RateLimitConfig{}); got != tt.want {
+				t.Errorf("rateKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
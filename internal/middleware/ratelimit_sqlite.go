@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// SQLiteLimiter is a Limiter backed by the rate_limits table, so every instance
+// sharing the database enforces one quota per key. Each key stores only its GCRA
+// theoretical arrival time, in Unix nanoseconds.
+type SQLiteLimiter struct {
+	db *sql.DB
+}
+
+// NewSQLiteLimiter creates a new database-backed limiter.
+// The cleanup goroutine stops when ctx is cancelled.
+func NewSQLiteLimiter(ctx context.Context, db *sql.DB) *SQLiteLimiter {
+	l := &SQLiteLimiter{db: db}
+
+	go l.cleanupOldEntries(ctx)
+
+	return l
+}
+
+// Allow checks whether a request fits within every limit and records it
+// against all of them if so. Each check is a conditional upsert in one
+// transaction, so concurrent requests from any instance cannot both spend the
+// last unit of quota, and the transaction is rolled back when any limit refuses
+// the request. The database's busy_timeout lets a write wait out another instance's.
+func (l *SQLiteLimiter) Allow(ctx context.Context, limits ...Limit) ([]Decision, error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin rate limit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	decisions := make([]Decision, len(limits))
+	allowed := true
+	for i, lim := range limits {
+		if decisions[i], err = allowTx(ctx, tx, now, lim); err != nil {
+			return nil, err
+		}
+		allowed = allowed && decisions[i].Allowed
+	}
+	if !allowed {
+		return decisions, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record rate limit: %w", err)
+	}
+	return decisions, nil
+}
+
+// allowTx records a request against one limit within tx. The update only
+// happens while the key's tat stays within one Period of now, mirroring gcra.
+func allowTx(ctx context.Context, tx *sql.Tx, now time.Time, lim Limit) (Decision, error) {
+	rate := lim.Rate
+	if rate.Limit <= 0 || rate.Period <= 0 {
+		d, _ := gcra(now, time.Time{}, rate)
+		return d, nil
+	}
+	interval := rate.interval()
+
+	var tatNanos int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO rate_limits (key, tat) VALUES (?1, ?2 + ?3)
+		ON CONFLICT(key) DO UPDATE SET tat = max(tat, ?2) + ?3
+			WHERE max(tat, ?2) + ?3 - ?4 <= ?2
+		RETURNING tat
+	`, lim.Key, now.UnixNano(), int64(interval), int64(rate.Period)).Scan(&tatNanos)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// The update was skipped: the key is over its quota
+		return deniedTx(ctx, tx, now, lim)
+	case err != nil:
+		return Decision{}, fmt.Errorf("failed to record rate limit: %w", err)
+	}
+
+	// Replay the accepted request through gcra for the headers
+	d, _ := gcra(now, time.Unix(0, tatNanos).Add(-interval), rate)
+	return d, nil
+}
+
+// deniedTx builds the decision for a request the upsert refused, from the
+// key's current tat. The transaction already holds the write lock, so the
+// tat cannot have moved since the upsert.
+func deniedTx(ctx context.Context, tx *sql.Tx, now time.Time, lim Limit) (Decision, error) {
+	var tatNanos int64
+	if err := tx.QueryRowContext(ctx, "SELECT tat FROM rate_limits WHERE key = ?", lim.Key).Scan(&tatNanos); err != nil {
+		return Decision{}, fmt.Errorf("failed to read rate limit: %w", err)
+	}
+	d, _ := gcra(now, time.Unix(0, tatNanos), lim.Rate)
+	return d, nil
+}
+
+// cleanupOldEntries removes fully replenished keys every minute until ctx is cancelled
+func (l *SQLiteLimiter) cleanupOldEntries(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.db.Exec("DELETE FROM rate_limits WHERE tat < ?", time.Now().UnixNano()); err != nil {
+				log.Printf("Failed to clean up rate limits: %v", err)
+			}
+		}
+	}
+}
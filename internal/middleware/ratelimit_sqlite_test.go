@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSQLiteLimiterAllow(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewSQLiteLimiter(ctx, db)
+	rate := Rate{Limit: 5, Period: time.Hour}
+
+	// Concurrent requests share the quota exactly
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := l.Allow(ctx, Limit{Key: "k", Rate: rate})
+			if err != nil {
+				t.Errorf("Allow: %v", err)
+				return
+			}
+			if d[0].Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != int32(rate.Limit) {
+		t.Errorf("allowed %d of 20 concurrent requests, want %d", n, rate.Limit)
+	}
+
+	d, err := l.Allow(ctx, Limit{Key: "k", Rate: rate})
+	if err != nil || d[0].Allowed || d[0].RetryAfter <= 0 || d[0].Remaining != 0 {
+		t.Errorf("over quota: Allow = %+v, %v; want denied with a retry time", d, err)
+	}
+	d, err = l.Allow(ctx, Limit{Key: "other", Rate: rate})
+	if err != nil || !d[0].Allowed || d[0].Remaining != rate.Limit-1 {
+		t.Errorf("fresh key: Allow = %+v, %v; want allowed with %d remaining", d, err, rate.Limit-1)
+	}
+}
+
+// failingLimiter is a Limiter whose backend is down
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, ...Limit) ([]Decision, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestRateLimitFailsClosed(t *testing.T) {
+	cfg := RateLimitConfig{
+		Limiter:  failingLimiter{},
+		Policies: []RatePolicy{{Name: "global", Pattern: "/*", Rate: Rate{Limit: 10, Period: time.Minute}}},
+	}
+	h := RateLimit(cfg, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the handler despite a limiter error")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/login", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLimiterAllowAll checks that a request refused by one limit spends no
+// quota on the others, for both backends
+func TestLimiterAllowAll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	db := newTestDB(t)
+
+	limiters := []struct {
+		name    string
+		limiter Limiter
+	}{
+		{"memory", NewMemoryLimiter(ctx)},
+		{"sqlite", NewSQLiteLimiter(ctx, db)},
+	}
+	for _, tt := range limiters {
+		t.Run(tt.name, func(t *testing.T) {
+			loose := Limit{Key: tt.name + ":loose", Rate: Rate{Limit: 10, Period: time.Hour}}
+			tight := Limit{Key: tt.name + ":tight", Rate: Rate{Limit: 1, Period: time.Hour}}
+
+			d, err := tt.limiter.Allow(ctx, loose, tight)
+			if err != nil || !d[0].Allowed || !d[1].Allowed {
+				t.Fatalf("first request: Allow = %+v, %v; want both allowed", d, err)
+			}
+			for range 3 {
+				d, err = tt.limiter.Allow(ctx, loose, tight)
+				if err != nil || d[1].Allowed {
+					t.Fatalf("over the tight limit: Allow = %+v, %v; want denied", d, err)
+				}
+			}
+
+			// Only the first request counted against the loose limit
+			d, err = tt.limiter.Allow(ctx, loose)
+			if want := loose.Rate.Limit - 2; err != nil || !d[0].Allowed || d[0].Remaining != want {
+				t.Errorf("loose limit alone: Allow = %+v, %v; want allowed with %d remaining", d, err, want)
+			}
+		})
+	}
+}
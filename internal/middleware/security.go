@@ -2,29 +2,50 @@ package middleware
 
 import (
 	"compress/gzip"
+	"container/list"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// CSRFTokenStore manages CSRF tokens with expiration
+// CSRFTokenStore manages CSRF tokens with expiration in process memory.
+// Tokens are lost on restart and not shared between instances; production
+// deployments use SQLiteCSRFTokenStore instead.
+// Tokens are kept in issue order, which is also expiry order because every
+// token has the same TTL, so the oldest can be evicted in O(1) once the store is full.
 type CSRFTokenStore struct {
-	tokens map[string]time.Time
-	mu     sync.Mutex
-	ttl    time.Duration
+	tokens    map[string]*list.Element
+	order     *list.List // of csrfEntry, oldest first
+	mu        sync.Mutex
+	ttl       time.Duration
+	maxTokens int
+	evicted   atomic.Int64
+	expired   atomic.Int64
+}
+
+// csrfEntry is a token and its expiry, stored in CSRFTokenStore.order
+type csrfEntry struct {
+	token  string
+	expiry time.Time
 }
 
 // NewCSRFTokenStore creates a new CSRF token store.
+// maxTokens caps the store size; pass 0 to use DefaultMaxCSRFTokens.
 // The cleanup goroutine stops when ctx is cancelled.
-func NewCSRFTokenStore(ctx context.Context, ttl time.Duration) *CSRFTokenStore {
+func NewCSRFTokenStore(ctx context.Context, ttl time.Duration, maxTokens int) *CSRFTokenStore {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxCSRFTokens
+	}
 	store := &CSRFTokenStore{
-		tokens: make(map[string]time.Time),
-		ttl:    ttl,
+		tokens:    make(map[string]*list.Element),
+		order:     list.New(),
+		ttl:       ttl,
+		maxTokens: maxTokens,
 	}
 
 	// Clean up expired tokens every 5 minutes
@@ -33,7 +54,7 @@ func NewCSRFTokenStore(ctx context.Context, ttl time.Duration) *CSRFTokenStore {
 	return store
 }
 
-// GenerateToken creates a new CSRF token
+// GenerateToken creates a new CSRF token, evicting the oldest tokens if the store is full
 func (s *CSRFTokenStore) GenerateToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -43,7 +64,11 @@ func (s *CSRFTokenStore) GenerateToken() (string, error) {
 	token := base64.URLEncoding.EncodeToString(b)
 
 	s.mu.Lock()
-	s.tokens[token] = time.Now().Add(s.ttl)
+	for s.order.Len() >= s.maxTokens {
+		s.removeLocked(s.order.Front())
+		s.evicted.Add(1)
+	}
+	s.tokens[token] = s.order.PushBack(csrfEntry{token: token, expiry: time.Now().Add(s.ttl)})
 	s.mu.Unlock()
 
 	return token, nil
@@ -55,13 +80,13 @@ func (s *CSRFTokenStore) ValidateToken(token string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	expiry, exists := s.tokens[token]
+	el, exists := s.tokens[token]
 	if !exists {
 		return false
 	}
 
-	if time.Now().After(expiry) {
-		delete(s.tokens, token)
+	if time.Now().After(el.Value.(csrfEntry).expiry) {
+		s.removeLocked(el)
 		return false
 	}
 
@@ -74,21 +99,42 @@ func (s *CSRFTokenStore) ConsumeToken(token string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	expiry, exists := s.tokens[token]
+	el, exists := s.tokens[token]
 	if !exists {
 		return false
 	}
 
-	delete(s.tokens, token)
+	s.removeLocked(el)
 
-	return !time.Now().After(expiry)
+	return !time.Now().After(el.Value.(csrfEntry).expiry)
 }
 
 // DeleteToken removes a token after use
 func (s *CSRFTokenStore) DeleteToken(token string) {
 	s.mu.Lock()
-	delete(s.tokens, token)
+	if el, exists := s.tokens[token]; exists {
+		s.removeLocked(el)
+	}
+	s.mu.Unlock()
+}
+
+// Stats reports the store size and how many tokens have been evicted or expired
+func (s *CSRFTokenStore) Stats() TokenStoreStats {
+	s.mu.Lock()
+	size := s.order.Len()
 	s.mu.Unlock()
+	return TokenStoreStats{
+		Size:    size,
+		MaxSize: s.maxTokens,
+		Evicted: s.evicted.Load(),
+		Expired: s.expired.Load(),
+	}
+}
+
+// removeLocked deletes a token; s.mu must be held
+func (s *CSRFTokenStore) removeLocked(el *list.Element) {
+	delete(s.tokens, el.Value.(csrfEntry).token)
+	s.order.Remove(el)
 }
 
 // cleanupExpiredTokens removes expired tokens periodically until ctx is cancelled
@@ -101,18 +147,22 @@ func (s *CSRFTokenStore) cleanupExpiredTokens(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			now := time.Now()
-			s.mu.Lock()
-			for token, expiry := range s.tokens {
-				if now.After(expiry) {
-					delete(s.tokens, token)
-				}
-			}
-			s.mu.Unlock()
+			s.cleanup(time.Now())
+			logTokenStoreStats("memory", s.Stats())
 		}
 	}
 }
 
+// cleanup removes tokens that expired before now, oldest first
+func (s *CSRFTokenStore) cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for el := s.order.Front(); el != nil && now.After(el.Value.(csrfEntry).expiry); el = s.order.Front() {
+		s.removeLocked(el)
+		s.expired.Add(1)
+	}
+}
+
 // nonceKey is a private type for the CSP nonce context key.
 type nonceKey struct{}
 
@@ -164,34 +214,6 @@ func NonceFromContext(ctx context.Context) string {
 	return ""
 }
 
-// layoutCSRFKey is a private type for the layout-level CSRF token context key.
-type layoutCSRFKey struct{}
-
-// LayoutCSRFFromContext extracts the layout CSRF token from the request context.
-// This token is used by the navbar logout form and other layout-level forms.
-func LayoutCSRFFromContext(ctx context.Context) string {
-	if token, ok := ctx.Value(layoutCSRFKey{}).(string); ok {
-		return token
-	}
-	return ""
-}
-
-// InjectLayoutCSRF generates a CSRF token per request and stores it in context
-// so layout-level templates (e.g. navbar logout) can include it.
-func InjectLayoutCSRF(store *CSRFTokenStore) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token, err := store.GenerateToken()
-			if err != nil {
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			r = r.WithContext(context.WithValue(r.Context(), layoutCSRFKey{}, token))
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 // mimeTypes maps file extensions to correct MIME types.
 // Go's http.FileServer relies on the OS MIME database which can be
 // incomplete on minimal Linux containers (e.g. Render, Docker Alpine).
@@ -311,175 +333,28 @@ func SecurityHeadersWithHSTS(httpsMode bool) func(http.Handler) http.Handler {
 	}
 }
 
-// RateLimiter implements simple in-memory rate limiting.
-// The requests map grows at most one entry per unique IP per window.
-// The cleanup goroutine (every 1 minute) evicts IPs with no recent requests,
-// bounding memory to O(active unique IPs within the current window).
-type RateLimiter struct {
-	requests     map[string][]time.Time
-	mu           sync.Mutex
-	limit        int
-	window       time.Duration
-	behindProxy  bool
-}
-
-// NewRateLimiter creates a new rate limiter.
-// Set behindProxy to true only when running behind a trusted reverse proxy
-// that sets X-Forwarded-For / X-Real-IP headers.
-// The cleanup goroutine stops when ctx is cancelled.
-func NewRateLimiter(ctx context.Context, limit int, window time.Duration, behindProxy bool) *RateLimiter {
-	limiter := &RateLimiter{
-		requests:    make(map[string][]time.Time),
-		limit:       limit,
-		window:      window,
-		behindProxy: behindProxy,
-	}
-
-	// Clean up old entries every minute
-	go limiter.cleanupOldEntries(ctx)
-
-	return limiter
-}
-
-// Allow checks if a request from the given IP should be allowed
-func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	cutoff := now.Add(-rl.window)
-
-	// Filter in-place — reuse the existing slice
-	requests := rl.requests[ip]
-	n := 0
-	for _, t := range requests {
-		if t.After(cutoff) {
-			requests[n] = t
-			n++
-		}
-	}
-	requests = requests[:n]
-
-	// Check if limit exceeded
-	if len(requests) >= rl.limit {
-		rl.requests[ip] = requests
-		return false
-	}
-
-	// Add current request
-	rl.requests[ip] = append(requests, now)
-
-	return true
-}
-
-// cleanupOldEntries removes old rate limit entries until ctx is cancelled
-func (rl *RateLimiter) cleanupOldEntries(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			now := time.Now()
-			cutoff := now.Add(-rl.window)
-
-			rl.mu.Lock()
-			for ip, requests := range rl.requests {
-				n := 0
-				for _, t := range requests {
-					if t.After(cutoff) {
-						requests[n] = t
-						n++
-					}
-				}
-				if n == 0 {
-					delete(rl.requests, ip)
-				} else {
-					rl.requests[ip] = requests[:n]
-				}
-			}
-			rl.mu.Unlock()
-		}
-	}
-}
-
-// clientIP extracts the client IP from the request.
-// When behindProxy is true, it checks X-Forwarded-For and X-Real-IP
-// headers (only safe when a trusted reverse proxy sets these).
-// When behindProxy is false, it uses RemoteAddr directly to prevent
-// clients from spoofing their IP via headers.
-func ClientIP(r *http.Request, behindProxy bool) string {
-	if behindProxy {
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			// X-Forwarded-For may contain: "client, proxy1, proxy2"
-			if i := strings.IndexByte(xff, ','); i > 0 {
-				return strings.TrimSpace(xff[:i])
-			}
-			return strings.TrimSpace(xff)
-		}
-		if xri := r.Header.Get("X-Real-IP"); xri != "" {
-			return strings.TrimSpace(xri)
-		}
-	}
-	// RemoteAddr is "host:port"; strip the port
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		return host
-	}
-	return r.RemoteAddr
-}
-
 // ErrorRenderer is a function that renders a styled error page.
 // This allows the middleware to render error pages without importing
 // the handlers or templates packages (avoiding circular dependencies).
 type ErrorRenderer func(w http.ResponseWriter, r *http.Request, statusCode int)
 
-// RateLimit middleware applies rate limiting.
-// Static assets (/static/, /components/, /favicon.ico) are exempt so that
-// error pages can load their CSS/JS even when the limit is exceeded.
-// If onLimitExceeded is nil, a plain-text 429 response is returned.
-func RateLimit(limiter *RateLimiter, onLimitExceeded ErrorRenderer) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Allow static assets through without rate limiting
-			path := r.URL.Path
-			if strings.HasPrefix(path, "/static/") ||
-				strings.HasPrefix(path, "/components/") ||
-				path == "/favicon.ico" || path == "/favicon.svg" {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			ip := ClientIP(r, limiter.behindProxy)
-
-			if !limiter.Allow(ip) {
-				if onLimitExceeded != nil {
-					onLimitExceeded(w, r, http.StatusTooManyRequests)
-				} else {
-					http.Error(w, "Rate limit exceeded. Please try again later.", http.StatusTooManyRequests)
-				}
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 // CSRF middleware for protecting forms.
 // If onError is non-nil it is called on token failure; otherwise a plain-text 403 is returned.
-func CSRF(store *CSRFTokenStore, onError ErrorRenderer) func(http.Handler) http.Handler {
+// Requests authenticated by APITokenAuth are exempt: a bearer token is sent
+// explicitly by the client, never attached by the browser, so it cannot be
+// forged cross-site the way a cookie can.
+func CSRF(csrf CSRFProtector, onError ErrorRenderer) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Only check CSRF for state-changing methods
-			if r.Method == "POST" || r.Method == "PUT" || r.Method == "DELETE" || r.Method == "PATCH" {
+			if APITokenFromContext(r.Context()) == nil &&
+				(r.Method == "POST" || r.Method == "PUT" || r.Method == "DELETE" || r.Method == "PATCH") {
 				token := r.Header.Get("X-CSRF-Token")
 				if token == "" {
 					token = r.FormValue("csrf_token")
 				}
 
-				if token == "" || !store.ConsumeToken(token) {
+				if err := csrf.CheckToken(r, token); err != nil {
 					if onError != nil {
 						onError(w, r, http.StatusForbidden)
 					} else {
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCSRFTokenStoreEviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		max         int
+		ops         string // g generates a token, c<n> consumes the nth generated token
+		wantValid   []bool // per generated token, after all ops
+		wantSize    int
+		wantEvicted int64
+	}{
+		{name: "under the cap", max: 3, ops: "gg", wantValid: []bool{true, true}, wantSize: 2},
+		{name: "full store evicts oldest first", max: 3, ops: "ggggg", wantValid: []bool{false, false, true, true, true}, wantSize: 3, wantEvicted: 2},
+		{name: "consumed tokens free space", max: 2, ops: "ggc0g", wantValid: []bool{false, true, true}, wantSize: 2},
+		{name: "eviction skips consumed tokens", max: 2, ops: "ggc1gg", wantValid: []bool{false, false, true, true}, wantSize: 2, wantEvicted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := NewCSRFTokenStore(ctx, time.Hour, tt.max)
+
+			var tokens []string
+			for i := 0; i < len(tt.ops); i++ {
+				switch tt.ops[i] {
+				case 'g':
+					tok, err := s.GenerateToken()
+					if err != nil {
+						t.Fatalf("GenerateToken: %v", err)
+					}
+					tokens = append(tokens, tok)
+				case 'c':
+					i++
+					if !s.ConsumeToken(tokens[tt.ops[i]-'0']) {
+						t.Fatalf("ConsumeToken(%c) = false", tt.ops[i])
+					}
+				}
+			}
+
+			for i, want := range tt.wantValid {
+				if got := s.ValidateToken(tokens[i]); got != want {
+					t.Errorf("token %d valid = %t, want %t", i, got, want)
+				}
+			}
+			st := s.Stats()
+			if st.Size != tt.wantSize || st.MaxSize != tt.max || st.Evicted != tt.wantEvicted || st.Expired != 0 {
+				t.Errorf("Stats() = %+v, want size %d, max %d, evicted %d, expired 0",
+					st, tt.wantSize, tt.max, tt.wantEvicted)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenStoreExpiry(t *testing.T) {
+	const ttl = time.Minute
+
+	tests := []struct {
+		name        string
+		cleanupAt   time.Duration // after the tokens were issued
+		wantSize    int
+		wantExpired int64
+	}{
+		{name: "cleanup before the ttl keeps tokens", cleanupAt: ttl / 2, wantSize: 3},
+		{name: "cleanup after the ttl removes tokens", cleanupAt: 2 * ttl, wantExpired: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s := NewCSRFTokenStore(ctx, ttl, 10)
+			issued := time.Now()
+			for range 3 {
+				if _, err := s.GenerateToken(); err != nil {
+					t.Fatalf("GenerateToken: %v", err)
+				}
+			}
+
+			s.cleanup(issued.Add(tt.cleanupAt))
+			st := s.Stats()
+			if st.Size != tt.wantSize || st.Expired != tt.wantExpired || st.Evicted != 0 {
+				t.Errorf("Stats() = %+v, want size %d, expired %d, evicted 0", st, tt.wantSize, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenStoreExpiredTokenRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewCSRFTokenStore(ctx, time.Millisecond, 10)
+	validated, _ := s.GenerateToken()
+	consumed, _ := s.GenerateToken()
+	time.Sleep(5 * time.Millisecond)
+
+	if s.ValidateToken(validated) {
+		t.Error("ValidateToken accepted an expired token")
+	}
+	if s.ConsumeToken(consumed) {
+		t.Error("ConsumeToken accepted an expired token")
+	}
+	// Both were dropped on sight rather than by the cleanup job
+	if st := s.Stats(); st.Size != 0 || st.Expired != 0 {
+		t.Errorf("Stats() = %+v, want size 0, expired 0", st)
+	}
+}
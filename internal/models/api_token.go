@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIToken is a personal access token for the JSON API. Only a SHA-256 hash
+// of the token is stored (see HashToken); Prefix is kept in the clear so the
+// owner can tell tokens apart.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	TokenHash  string
+	Prefix     string   // first characters of the token, for display
+	Scopes     []string // permissions the token may use
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero if never used
+}
+
+// APITokenDatabase provides database operations for API tokens and their audit trail
+type APITokenDatabase struct {
+	db *sql.DB
+}
+
+// NewAPITokenDatabase creates a new APITokenDatabase
+func NewAPITokenDatabase(db *sql.DB) *APITokenDatabase {
+	return &APITokenDatabase{db: db}
+}
+
+// Create stores a token; token.TokenHash must be set. It sets token.ID.
+func (db *APITokenDatabase) Create(token *APIToken) error {
+	result, err := db.db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, prefix, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token.UserID, token.Name, token.TokenHash, token.Prefix, strings.Join(token.Scopes, " "),
+		token.ExpiresAt.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("failed to create api token: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	token.ID = int(id)
+	token.CreatedAt = time.Now()
+	return nil
+}
+
+// GetByHash returns the token with the given hash, expired or not.
+// Returns nil, nil if not found (not an error condition)
+func (db *APITokenDatabase) GetByHash(tokenHash string) (*APIToken, error) {
+	t, err := scanAPIToken(db.db.QueryRow(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens WHERE token_hash = ?
+	`, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+	return t, nil
+}
+
+// ListByUserID returns the user's unexpired tokens, newest first
+func (db *APITokenDatabase) ListByUserID(userID int) ([]*APIToken, error) {
+	rows, err := db.db.Query(`
+		SELECT `+apiTokenColumns+`
+		FROM api_tokens
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY created_at DESC, id DESC
+	`, userID, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// CountByUserID returns how many unexpired tokens the user has
+func (db *APITokenDatabase) CountByUserID(userID int) (int, error) {
+	var n int
+	err := db.db.QueryRow(
+		"SELECT COUNT(*) FROM api_tokens WHERE user_id = ? AND expires_at > ?",
+		userID, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count api tokens for user %d: %w", userID, err)
+	}
+	return n, nil
+}
+
+// DeleteByID deletes one of the user's tokens.
+// Returns ErrNotFound if there is no such token for this user.
+func (db *APITokenDatabase) DeleteByID(id, userID int) error {
+	result, err := db.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api token %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes expired tokens. Their audit rows are kept.
+func (db *APITokenDatabase) DeleteExpired() (int64, error) {
+	result, err := db.db.Exec("DELETE FROM api_tokens WHERE expires_at <= ?",
+		time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired api tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// RecordUse appends a request made with a token to the audit trail and marks
+// the token as used
+func (db *APITokenDatabase) RecordUse(token *APIToken, method, path, ip string, status int) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin api token use transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO api_token_uses (token_id, user_id, method, path, status, ip_address)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token.ID, token.UserID, method, path, status, ip); err != nil {
+		return fmt.Errorf("failed to record api token use: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", token.ID); err != nil {
+		return fmt.Errorf("failed to update api token last use: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteUsesOlderThan prunes the audit trail
+func (db *APITokenDatabase) DeleteUsesOlderThan(age time.Duration) (int64, error) {
+	result, err := db.db.Exec("DELETE FROM api_token_uses WHERE used_at < ?",
+		time.Now().Add(-age).UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune api token uses: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// apiTokenColumns lists the columns scanAPIToken expects, in order
+const apiTokenColumns = "id, user_id, name, token_hash, prefix, scopes, expires_at, created_at, COALESCE(last_used_at, '')"
+
+// scanAPIToken reads one row selected with apiTokenColumns
+func scanAPIToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	t := &APIToken{}
+	var scopes, expiresAt, createdAt, lastUsedAt string
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.Prefix, &scopes,
+		&expiresAt, &createdAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+
+	var parseErr error
+	t.ExpiresAt, parseErr = parseTime(expiresAt)
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse expires_at: %w", parseErr)
+	}
+	t.CreatedAt, parseErr = parseTime(createdAt)
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", parseErr)
+	}
+	if lastUsedAt != "" {
+		t.LastUsedAt, parseErr = parseTime(lastUsedAt)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to parse last_used_at: %w", parseErr)
+		}
+	}
+	return t, nil
+}
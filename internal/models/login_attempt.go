@@ -6,11 +6,24 @@ import (
 	"time"
 )
 
+// AttemptKey selects the login_attempts column a lockout check groups failures by
+type AttemptKey string
+
+const (
+	// AttemptKeyEmail groups failures by submitted email
+	AttemptKeyEmail AttemptKey = "email"
+	// AttemptKeyIP groups failures by exact client IP
+	AttemptKeyIP AttemptKey = "ip_address"
+	// AttemptKeySubnet groups failures by client IP bucket
+	AttemptKeySubnet AttemptKey = "ip_bucket"
+)
+
 // LoginAttempt represents a login attempt for audit and lockout purposes
 type LoginAttempt struct {
 	ID          int
 	Email       string
 	IPAddress   string
+	IPBucket    string // lockout subnet of the IP, e.g. "192.0.2.0/24" or "2001:db8:1::/48"
 	UserAgent   string
 	Success     bool
 	AttemptedAt time.Time
@@ -33,9 +46,9 @@ func (db *LoginAttemptDatabase) Record(attempt *LoginAttempt) error {
 		successInt = 1
 	}
 	_, err := db.db.Exec(`
-		INSERT INTO login_attempts (email, ip_address, user_agent, success)
-		VALUES (?, ?, ?, ?)
-	`, attempt.Email, attempt.IPAddress, attempt.UserAgent, successInt)
+		INSERT INTO login_attempts (email, ip_address, ip_bucket, user_agent, success)
+		VALUES (?, ?, ?, ?, ?)
+	`, attempt.Email, attempt.IPAddress, attempt.IPBucket, attempt.UserAgent, successInt)
 	if err != nil {
 		return fmt.Errorf("failed to record login attempt: %w", err)
 	}
@@ -69,3 +82,41 @@ func (db *LoginAttemptDatabase) CountRecentFailuresByIP(ip string, window time.D
 	}
 	return count, nil
 }
+
+// CountRecentFailuresBySubnet counts failed login attempts from an IP bucket within a time window
+func (db *LoginAttemptDatabase) CountRecentFailuresBySubnet(bucket string, window time.Duration) (int, error) {
+	var count int
+	cutoff := time.Now().Add(-window).UTC().Format("2006-01-02 15:04:05")
+	err := db.db.QueryRow(`
+		SELECT COUNT(*) FROM login_attempts
+		WHERE ip_bucket = ? AND success = 0 AND attempted_at > ?
+	`, bucket, cutoff).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recent failures by subnet: %w", err)
+	}
+	return count, nil
+}
+
+// LastFailure returns the time of the most recent failed attempt for value,
+// or the zero time if there is none
+func (db *LoginAttemptDatabase) LastFailure(key AttemptKey, value string) (time.Time, error) {
+	switch key {
+	case AttemptKeyEmail, AttemptKeyIP, AttemptKeySubnet:
+	default:
+		return time.Time{}, fmt.Errorf("unknown login attempt key %q", key)
+	}
+
+	var last sql.NullString
+	// key is one of the constants above, never user input
+	err := db.db.QueryRow(`
+		SELECT MAX(attempted_at) FROM login_attempts
+		WHERE `+string(key)+` = ? AND success = 0
+	`, value).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last failure: %w", err)
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return parseTime(last.String)
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MagicLinkDatabase provides database operations for passwordless sign-in
+// links. Tokens and browser nonces are stored only as SHA-256 hashes.
+type MagicLinkDatabase struct {
+	db *sql.DB
+}
+
+// NewMagicLinkDatabase creates a new MagicLinkDatabase
+func NewMagicLinkDatabase(db *sql.DB) *MagicLinkDatabase {
+	return &MagicLinkDatabase{db: db}
+}
+
+// Create stores a sign-in link for the user, bound to the browser holding the
+// nonce, and discards any earlier ones, so only the most recent email's link works
+func (db *MagicLinkDatabase) Create(userID int, tokenHash, nonceHash string, expiresAt time.Time) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin magic link transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM magic_link_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete old magic links: %w", err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO magic_link_tokens (token_hash, user_id, nonce_hash, expires_at) VALUES (?, ?, ?, ?)",
+		tokenHash, userID, nonceHash, expiresAt.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		return fmt.Errorf("failed to create magic link: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Lookup returns the user an unexpired link belongs to without using it up
+// Returns 0, nil if the link is unknown or expired (not an error condition)
+func (db *MagicLinkDatabase) Lookup(tokenHash string) (int, error) {
+	var userID int
+	err := db.db.QueryRow(
+		"SELECT user_id FROM magic_link_tokens WHERE token_hash = ? AND expires_at > ?",
+		tokenHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up magic link: %w", err)
+	}
+	return userID, nil
+}
+
+// Consume deletes an unexpired link requested by the browser holding the
+// nonce and returns its user. A link opened in another browser is left in
+// place for the one that asked for it.
+// Returns 0, nil if the link is unknown, expired, already used or the nonce does not match.
+func (db *MagicLinkDatabase) Consume(tokenHash, nonceHash string) (int, error) {
+	var userID int
+	err := db.db.QueryRow(
+		"DELETE FROM magic_link_tokens WHERE token_hash = ? AND nonce_hash = ? AND expires_at > ? RETURNING user_id",
+		tokenHash, nonceHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteExpired removes expired links and returns the count deleted
+func (db *MagicLinkDatabase) DeleteExpired() (int64, error) {
+	result, err := db.db.Exec(
+		"DELETE FROM magic_link_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired magic links: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UserMFA is a user's TOTP enrolment. Secret is the encrypted TOTP key;
+// it is only usable for login once Enabled is set by a confirmed first code.
+type UserMFA struct {
+	UserID    int
+	Secret    []byte
+	Enabled   bool
+	LastStep  int64 // last accepted TOTP time step, so a code cannot be replayed
+	CreatedAt time.Time
+}
+
+// MFAChallenge is a pending login that passed the password check and is
+// waiting for a second factor
+type MFAChallenge struct {
+	TokenHash string
+	UserID    int
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// MFADatabase provides database operations for TOTP enrolments,
+// recovery codes and pending login challenges
+type MFADatabase struct {
+	db *sql.DB
+}
+
+// NewMFADatabase creates a new MFADatabase
+func NewMFADatabase(db *sql.DB) *MFADatabase {
+	return &MFADatabase{db: db}
+}
+
+// Get returns the user's enrolment
+// Returns nil, nil if the user has none (not an error condition)
+func (db *MFADatabase) Get(userID int) (*UserMFA, error) {
+	m := &UserMFA{}
+	var enabled int
+	var createdAt string
+
+	err := db.db.QueryRow(`
+		SELECT user_id, secret, enabled, last_step, created_at
+		FROM user_mfa WHERE user_id = ?
+	`, userID).Scan(&m.UserID, &m.Secret, &enabled, &m.LastStep, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa enrolment: %w", err)
+	}
+
+	m.Enabled = enabled == 1
+	if m.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	return m, nil
+}
+
+// SavePending stores a new, not yet confirmed secret for the user.
+// An enabled enrolment is never replaced; it must be deleted first.
+func (db *MFADatabase) SavePending(userID int, secret []byte) error {
+	result, err := db.db.Exec(`
+		INSERT INTO user_mfa (user_id, secret, enabled, last_step)
+		VALUES (?, ?, 0, 0)
+		ON CONFLICT(user_id) DO UPDATE SET
+			secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled = 0
+	`, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save pending mfa enrolment: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("mfa already enabled for user %d", userID)
+	}
+	return nil
+}
+
+// Enable activates a pending enrolment and replaces the user's recovery codes,
+// recording step as the last accepted TOTP step
+func (db *MFADatabase) Enable(userID int, step int64, codeHashes []string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin mfa transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE user_mfa SET enabled = 1, last_step = ? WHERE user_id = ? AND enabled = 0",
+		step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable mfa: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no pending mfa enrolment for user %d", userID)
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores new ones
+func (db *MFADatabase) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin mfa transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes swaps the user's recovery codes inside tx
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, h); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the user's enrolment and recovery codes
+func (db *MFADatabase) Delete(userID int) error {
+	if _, err := db.db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := db.db.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete mfa enrolment: %w", err)
+	}
+	return nil
+}
+
+// UseStep records step as used if it is newer than the last accepted step.
+// Returns false if the step (or a later one) was already used.
+func (db *MFADatabase) UseStep(userID int, step int64) (bool, error) {
+	result, err := db.db.Exec(
+		"UPDATE user_mfa SET last_step = ? WHERE user_id = ? AND enabled = 1 AND last_step < ?",
+		step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return n == 1, nil
+}
+
+// ConsumeRecoveryCode deletes a matching recovery code.
+// Returns false if the user has no such code.
+func (db *MFADatabase) ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := db.db.Exec(
+		"DELETE FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ?", userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes the user has left
+func (db *MFADatabase) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := db.db.QueryRow(
+		"SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// CreateChallenge stores a pending second-factor login
+func (db *MFADatabase) CreateChallenge(c *MFAChallenge) error {
+	_, err := db.db.Exec(`
+		INSERT INTO mfa_challenges (token_hash, user_id, expires_at)
+		VALUES (?, ?, ?)
+	`, c.TokenHash, c.UserID, c.ExpiresAt.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+	return nil
+}
+
+// GetChallenge returns an unexpired challenge by token hash
+// Returns nil, nil if there is none (not an error condition)
+func (db *MFADatabase) GetChallenge(tokenHash string) (*MFAChallenge, error) {
+	c := &MFAChallenge{}
+	var expiresAt string
+
+	err := db.db.QueryRow(`
+		SELECT token_hash, user_id, attempts, expires_at
+		FROM mfa_challenges WHERE token_hash = ? AND expires_at > ?
+	`, tokenHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(
+		&c.TokenHash, &c.UserID, &c.Attempts, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	if c.ExpiresAt, err = parseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to parse expires_at: %w", err)
+	}
+	return c, nil
+}
+
+// FailChallenge counts a wrong code against a challenge and deletes it once
+// maxAttempts is reached. Returns true if the challenge is still usable.
+func (db *MFADatabase) FailChallenge(tokenHash string, maxAttempts int) (bool, error) {
+	if _, err := db.db.Exec(
+		"UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ?", tokenHash); err != nil {
+		return false, fmt.Errorf("failed to record mfa attempt: %w", err)
+	}
+	result, err := db.db.Exec(
+		"DELETE FROM mfa_challenges WHERE token_hash = ? AND attempts >= ?", tokenHash, maxAttempts)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire mfa challenge: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n == 0, nil
+}
+
+// DeleteChallenge removes a challenge once it has been used.
+// Returns false if it was already gone, so one challenge yields one session.
+func (db *MFADatabase) DeleteChallenge(tokenHash string) (bool, error) {
+	result, err := db.db.Exec("DELETE FROM mfa_challenges WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete mfa challenge: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete mfa challenge: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteExpiredChallenges removes expired challenges and returns the count deleted
+func (db *MFADatabase) DeleteExpiredChallenges() (int64, error) {
+	result, err := db.db.Exec(
+		"DELETE FROM mfa_challenges WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired mfa challenges: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UserIdentity links a user to an account at an external OpenID provider,
+// identified by the provider's issuer and its subject for the user
+type UserIdentity struct {
+	ID          int
+	UserID      int
+	Issuer      string
+	Subject     string
+	Email       string // as the provider last reported it
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// OIDCDatabase provides database operations for external identities and
+// sign-ins in progress. Login states are stored only as SHA-256 hashes.
+type OIDCDatabase struct {
+	db *sql.DB
+}
+
+// NewOIDCDatabase creates a new OIDCDatabase
+func NewOIDCDatabase(db *sql.DB) *OIDCDatabase {
+	return &OIDCDatabase{db: db}
+}
+
+// CreateLoginState records a sign-in sent to the provider, with the nonce
+// and PKCE verifier needed to finish it
+func (db *OIDCDatabase) CreateLoginState(stateHash, nonce, verifier string, expiresAt time.Time) error {
+	if _, err := db.db.Exec(
+		"INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at) VALUES (?, ?, ?, ?)",
+		stateHash, nonce, verifier, expiresAt.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		return fmt.Errorf("failed to create oidc login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLoginState deletes an unexpired login state and returns its nonce
+// and verifier, so each state finishes at most one sign-in.
+// Returns "", "", nil if the state is unknown, expired or already used.
+func (db *OIDCDatabase) ConsumeLoginState(stateHash string) (nonce, verifier string, err error) {
+	err = db.db.QueryRow(
+		"DELETE FROM oidc_login_states WHERE state_hash = ? AND expires_at > ? RETURNING nonce, code_verifier",
+		stateHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&nonce, &verifier)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to consume oidc login state: %w", err)
+	}
+	return nonce, verifier, nil
+}
+
+// DeleteExpiredLoginStates removes abandoned sign-ins and returns the count deleted
+func (db *OIDCDatabase) DeleteExpiredLoginStates() (int64, error) {
+	result, err := db.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired oidc login states: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetIdentity returns the identity for a provider account.
+// Returns nil, nil if it is not linked to any user (not an error condition)
+func (db *OIDCDatabase) GetIdentity(issuer, subject string) (*UserIdentity, error) {
+	i := &UserIdentity{}
+	var createdAt, lastLoginAt string
+	err := db.db.QueryRow(`
+		SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+		FROM user_identities WHERE issuer = ? AND subject = ?
+	`, issuer, subject).Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &createdAt, &lastLoginAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+	if i.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if i.LastLoginAt, err = parseTime(lastLoginAt); err != nil {
+		return nil, fmt.Errorf("failed to parse last_login_at: %w", err)
+	}
+	return i, nil
+}
+
+// CreateIdentity links a provider account to identity.UserID. It sets identity.ID.
+func (db *OIDCDatabase) CreateIdentity(identity *UserIdentity) error {
+	result, err := db.db.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email)
+		VALUES (?, ?, ?, ?)
+	`, identity.UserID, identity.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	identity.ID = int(id)
+	identity.CreatedAt = time.Now()
+	identity.LastLoginAt = identity.CreatedAt
+	return nil
+}
+
+// TouchIdentity records a sign-in with the identity and the email the
+// provider reported for it
+func (db *OIDCDatabase) TouchIdentity(id int, email string) error {
+	if _, err := db.db.Exec(
+		"UPDATE user_identities SET email = ?, last_login_at = CURRENT_TIMESTAMP WHERE id = ?",
+		email, id); err != nil {
+		return fmt.Errorf("failed to update identity %d: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PasswordResetDatabase provides database operations for password reset tokens.
+// Only SHA-256 hashes of tokens are stored.
+type PasswordResetDatabase struct {
+	db *sql.DB
+}
+
+// NewPasswordResetDatabase creates a new PasswordResetDatabase
+func NewPasswordResetDatabase(db *sql.DB) *PasswordResetDatabase {
+	return &PasswordResetDatabase{db: db}
+}
+
+// Create stores a reset token for the user and discards any earlier ones,
+// so only the most recent email's link works
+func (db *PasswordResetDatabase) Create(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin reset token transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete old reset tokens: %w", err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		tokenHash, userID, expiresAt.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		return fmt.Errorf("failed to create reset token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Lookup returns the user an unexpired token belongs to without using it up
+// Returns 0, nil if the token is unknown or expired (not an error condition)
+func (db *PasswordResetDatabase) Lookup(tokenHash string) (int, error) {
+	var userID int
+	err := db.db.QueryRow(
+		"SELECT user_id FROM password_reset_tokens WHERE token_hash = ? AND expires_at > ?",
+		tokenHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up reset token: %w", err)
+	}
+	return userID, nil
+}
+
+// Consume deletes an unexpired token and returns its user. The single DELETE
+// means two concurrent submissions of one link cannot both succeed.
+// Returns 0, nil if the token is unknown, expired or already used.
+func (db *PasswordResetDatabase) Consume(tokenHash string) (int, error) {
+	var userID int
+	err := db.db.QueryRow(
+		"DELETE FROM password_reset_tokens WHERE token_hash = ? AND expires_at > ? RETURNING user_id",
+		tokenHash, time.Now().UTC().Format("2006-01-02 15:04:05")).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteByUserID removes all of the user's outstanding reset tokens
+func (db *PasswordResetDatabase) DeleteByUserID(userID int) error {
+	if _, err := db.db.Exec("DELETE FROM password_reset_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete reset tokens: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes expired tokens and returns the count deleted
+func (db *PasswordResetDatabase) DeleteExpired() (int64, error) {
+	result, err := db.db.Exec(
+		"DELETE FROM password_reset_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired reset tokens: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Permissions checked by the application. Each is granted to a role with a
+// scope: ScopeAll for every resource, or ScopeOwn for the user's own only.
+const (
+	PermUsersCreate     = "users.create"
+	PermUsersUpdate     = "users.update"
+	PermUsersAssignRole = "users.assign_role"
+	PermUsersDelete     = "users.delete"
+	PermUsersVerify     = "users.verify"
+	PermTelemetryView   = "telemetry.view"
+	PermRolesManage     = "roles.manage"
+)
+
+// Grant scopes
+const (
+	ScopeAll = "all"
+	ScopeOwn = "own"
+)
+
+// ErrRoleExists is returned when creating a role whose name is taken
+var ErrRoleExists = errors.New("role already exists")
+
+// ErrRoleInUse is returned when deleting a built-in role or one that users still have
+var ErrRoleInUse = errors.New("role is built in or assigned to users")
+
+// Role is a named set of permission grants
+type Role struct {
+	Name        string
+	Description string
+	BuiltIn     bool // created with the schema; cannot be deleted
+	Users       int  // number of users with this role
+}
+
+// Permission is something a role can be granted
+type Permission struct {
+	Name        string
+	Description string
+	Ownable     bool // may be granted with ScopeOwn
+}
+
+// RoleDatabase provides database operations for roles and their permissions
+type RoleDatabase struct {
+	db *sql.DB
+}
+
+// NewRoleDatabase creates a new RoleDatabase
+func NewRoleDatabase(db *sql.DB) *RoleDatabase {
+	return &RoleDatabase{db: db}
+}
+
+// List returns all roles with their user counts, built-in roles first
+func (db *RoleDatabase) List() ([]*Role, error) {
+	rows, err := db.db.Query(`
+		SELECT r.name, r.description, r.built_in, COUNT(u.id)
+		FROM roles r LEFT JOIN users u ON u.role = r.name
+		GROUP BY r.name
+		ORDER BY r.built_in DESC, r.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		r := &Role{}
+		if err := rows.Scan(&r.Name, &r.Description, &r.BuiltIn, &r.Users); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// Exists reports whether a role called name exists
+func (db *RoleDatabase) Exists(name string) (bool, error) {
+	var n int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", name).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to look up role %q: %w", name, err)
+	}
+	return n > 0, nil
+}
+
+// Permissions returns every permission, ordered by name
+func (db *RoleDatabase) Permissions() ([]*Permission, error) {
+	rows, err := db.db.Query("SELECT name, description, ownable FROM permissions ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var perms []*Permission
+	for rows.Next() {
+		p := &Permission{}
+		if err := rows.Scan(&p.Name, &p.Description, &p.Ownable); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		perms = append(perms, p)
+	}
+	return perms, rows.Err()
+}
+
+// Scope returns the scope at which role holds permission, or "" if it does not
+func (db *RoleDatabase) Scope(role, permission string) (string, error) {
+	var scope string
+	err := db.db.QueryRow(
+		"SELECT scope FROM role_permissions WHERE role = ? AND permission = ?",
+		role, permission).Scan(&scope)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up permission %s for role %s: %w", permission, role, err)
+	}
+	return scope, nil
+}
+
+// Grants returns every role's grants as role → permission → scope
+func (db *RoleDatabase) Grants() (map[string]map[string]string, error) {
+	rows, err := db.db.Query("SELECT role, permission, scope FROM role_permissions")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make(map[string]map[string]string)
+	for rows.Next() {
+		var role, permission, scope string
+		if err := rows.Scan(&role, &permission, &scope); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		if grants[role] == nil {
+			grants[role] = make(map[string]string)
+		}
+		grants[role][permission] = scope
+	}
+	return grants, rows.Err()
+}
+
+// SetGrants replaces all of role's grants with grants (permission → scope).
+// Returns ErrNotFound if the role does not exist.
+func (db *RoleDatabase) SetGrants(role string, grants map[string]string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin role permissions transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM roles WHERE name = ?", role).Scan(&n); err != nil {
+		return fmt.Errorf("failed to look up role %q: %w", role, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = ?", role); err != nil {
+		return fmt.Errorf("failed to clear permissions of role %q: %w", role, err)
+	}
+	for permission, scope := range grants {
+		if _, err := tx.Exec(
+			"INSERT INTO role_permissions (role, permission, scope) VALUES (?, ?, ?)",
+			role, permission, scope); err != nil {
+			return fmt.Errorf("failed to grant %s to role %q: %w", permission, role, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Create adds a role with no permissions.
+// Returns ErrRoleExists if the name is taken.
+func (db *RoleDatabase) Create(name, description string) error {
+	result, err := db.db.Exec(
+		"INSERT INTO roles (name, description) VALUES (?, ?) ON CONFLICT(name) DO NOTHING",
+		name, description)
+	if err != nil {
+		return fmt.Errorf("failed to create role %q: %w", name, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrRoleExists
+	}
+	return nil
+}
+
+// Delete removes a role and its grants. Returns ErrNotFound if there is no
+// such role, or ErrRoleInUse if it is built in or still assigned to users.
+func (db *RoleDatabase) Delete(name string) error {
+	result, err := db.db.Exec(`
+		DELETE FROM roles
+		WHERE name = ? AND built_in = 0
+		  AND NOT EXISTS (SELECT 1 FROM users WHERE role = roles.name)
+	`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete role %q: %w", name, err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check rows affected: %w", err)
+	} else if n == 1 {
+		return nil
+	}
+
+	exists, err := db.Exists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrRoleInUse
+}
@@ -11,13 +11,16 @@ import (
 
 // Session represents an authenticated user session
 type Session struct {
-	ID        int
-	UserID    int
-	Token     string
-	IPAddress string
-	UserAgent string    // stored for audit/forensics only; not checked during validation
-	ExpiresAt time.Time
-	CreatedAt time.Time
+	ID            int
+	UserID        int
+	TokenHash     string // HashToken of the session token; the token itself is never stored
+	PrevTokenHash string // hash of the token replaced at RotatedAt; "" if never rotated
+	IPAddress     string
+	UserAgent     string // stored for audit/forensics only; not checked during validation
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+	LastSeenAt    time.Time // when the session last made a request
+	RotatedAt     time.Time // when the token was last rotated; CreatedAt if never
 }
 
 // SessionDatabase provides database operations for sessions
@@ -40,12 +43,12 @@ func GenerateSessionToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-// Create inserts a new session into the database
+// Create inserts a new session into the database; session.TokenHash must be set
 func (db *SessionDatabase) Create(session *Session) error {
 	_, err := db.db.Exec(`
-		INSERT INTO sessions (user_id, token, ip_address, user_agent, expires_at)
-		VALUES (?, ?, ?, ?, ?)
-	`, session.UserID, session.Token, session.IPAddress, session.UserAgent,
+		INSERT INTO sessions (user_id, token_hash, ip_address, user_agent, expires_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, session.UserID, session.TokenHash, session.IPAddress, session.UserAgent,
 		session.ExpiresAt.UTC().Format("2006-01-02 15:04:05"))
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
@@ -53,19 +56,16 @@ func (db *SessionDatabase) Create(session *Session) error {
 	return nil
 }
 
-// GetByToken retrieves a session by its token
+// GetByToken retrieves a session by its raw token, looking it up by hash.
+// The token may also be the session's previous one; callers compare TokenHash
+// to tell the two apart and decide whether the rotation grace window applies.
 // Returns nil, nil if not found (not an error condition)
 func (db *SessionDatabase) GetByToken(token string) (*Session, error) {
-	s := &Session{}
-	var expiresAt, createdAt string
-
-	err := db.db.QueryRow(`
-		SELECT id, user_id, token, ip_address, user_agent, expires_at, created_at
-		FROM sessions WHERE token = ?
-	`, token).Scan(
-		&s.ID, &s.UserID, &s.Token, &s.IPAddress,
-		&s.UserAgent, &expiresAt, &createdAt,
-	)
+	hash := HashToken(token)
+	s, err := scanSession(db.db.QueryRow(`
+		SELECT `+sessionColumns+`
+		FROM sessions WHERE token_hash = ? OR prev_token_hash = ?
+	`, hash, hash))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, nil
@@ -73,6 +73,47 @@ func (db *SessionDatabase) GetByToken(token string) (*Session, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	return s, nil
+}
+
+// ListByUserID returns the user's unexpired sessions, most recently used first
+func (db *SessionDatabase) ListByUserID(userID int) ([]*Session, error) {
+	rows, err := db.db.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY COALESCE(last_seen_at, created_at) DESC, id DESC
+	`, userID, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions for user %d: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// sessionColumns lists the columns scanSession expects, in order
+const sessionColumns = "id, user_id, token_hash, COALESCE(prev_token_hash, ''), ip_address, user_agent, " +
+	"expires_at, created_at, COALESCE(last_seen_at, created_at), COALESCE(rotated_at, created_at)"
+
+// scanSession reads one row selected with sessionColumns
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	s := &Session{}
+	var expiresAt, createdAt, lastSeenAt, rotatedAt string
+	if err := row.Scan(
+		&s.ID, &s.UserID, &s.TokenHash, &s.PrevTokenHash, &s.IPAddress,
+		&s.UserAgent, &expiresAt, &createdAt, &lastSeenAt, &rotatedAt,
+	); err != nil {
+		return nil, err
+	}
 
 	var parseErr error
 	s.ExpiresAt, parseErr = parseTime(expiresAt)
@@ -83,19 +124,90 @@ func (db *SessionDatabase) GetByToken(token string) (*Session, error) {
 	if parseErr != nil {
 		return nil, fmt.Errorf("failed to parse created_at: %w", parseErr)
 	}
-
+	s.LastSeenAt, parseErr = parseTime(lastSeenAt)
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse last_seen_at: %w", parseErr)
+	}
+	s.RotatedAt, parseErr = parseTime(rotatedAt)
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse rotated_at: %w", parseErr)
+	}
 	return s, nil
 }
 
-// DeleteByToken removes a session by its token (logout)
-func (db *SessionDatabase) DeleteByToken(token string) error {
-	_, err := db.db.Exec("DELETE FROM sessions WHERE token = ?", token)
+// Touch records that a session was just used and moves its expiry to expiresAt
+func (db *SessionDatabase) Touch(id int, expiresAt time.Time) error {
+	if _, err := db.db.Exec(
+		"UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP, expires_at = ? WHERE id = ?",
+		expiresAt.UTC().Format("2006-01-02 15:04:05"), id,
+	); err != nil {
+		return fmt.Errorf("failed to update last_seen_at for session %d: %w", id, err)
+	}
+	return nil
+}
+
+// Rotate replaces the session's token hash with newHash, keeping oldHash as
+// the previous token. It only applies while oldHash is still current, so of
+// several concurrent requests exactly one rotates; the others get false.
+func (db *SessionDatabase) Rotate(id int, oldHash, newHash string) (bool, error) {
+	result, err := db.db.Exec(`
+		UPDATE sessions SET token_hash = ?, prev_token_hash = ?, rotated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND token_hash = ?
+	`, newHash, oldHash, id, oldHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate session %d: %w", id, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected == 1, nil
+}
+
+// DeleteByToken removes a session by its raw token (logout). The session's
+// previous token works too while it is within grace of the rotation, so
+// signing out mid-rotation still ends it but a stale token cannot.
+func (db *SessionDatabase) DeleteByToken(token string, grace time.Duration) error {
+	hash := HashToken(token)
+	_, err := db.db.Exec(
+		"DELETE FROM sessions WHERE token_hash = ? OR (prev_token_hash = ? AND rotated_at >= ?)",
+		hash, hash, time.Now().Add(-grace).UTC().Format("2006-01-02 15:04:05"),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 	return nil
 }
 
+// DeleteByID removes one of the user's sessions (sign out a single device).
+// Returns ErrNotFound if the session does not exist or belongs to another user.
+func (db *SessionDatabase) DeleteByID(id, userID int) error {
+	result, err := db.db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete session %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteOthers removes all of the user's sessions except keepID and returns the count deleted
+func (db *SessionDatabase) DeleteOthers(userID, keepID int) (int64, error) {
+	result, err := db.db.Exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete other sessions for user %d: %w", userID, err)
+	}
+	return result.RowsAffected()
+}
+
 // DeleteByUserID removes all sessions for a user (force logout all devices)
 func (db *SessionDatabase) DeleteByUserID(userID int) error {
 	_, err := db.db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TelemetryEvent is a scored telemetry submission persisted for threshold tuning
+type TelemetryEvent struct {
+	ID        int
+	FormID    string
+	Status    string // verification status (verified, unsigned, invalid, ...)
+	RiskScore int
+	Action    string
+	Signals   []string
+	IPHash    string
+	CreatedAt time.Time
+}
+
+// ScoreBucket is the number of events whose score falls in [Min, Max]
+type ScoreBucket struct {
+	Min   int
+	Max   int
+	Count int
+}
+
+// SignalCount is how often a risk signal fired
+type SignalCount struct {
+	Signal string
+	Count  int
+}
+
+// FormDayStat summarises one form's submissions on one day
+type FormDayStat struct {
+	FormID     string
+	Day        string
+	Count      int
+	AvgScore   float64
+	Challenged int
+	Blocked    int
+}
+
+// TelemetryStats is the aggregate view rendered on the admin telemetry page
+type TelemetryStats struct {
+	Since      time.Time
+	Total      int
+	Buckets    []ScoreBucket
+	TopSignals []SignalCount
+	Forms      []FormDayStat
+}
+
+// TelemetryEventDatabase provides database operations for telemetry events.
+// Client IPs are never stored: Record keys them with HMAC-SHA-256 so events
+// from the same client can be correlated without retaining the address.
+type TelemetryEventDatabase struct {
+	db        *sql.DB
+	ipHashKey []byte
+}
+
+// NewTelemetryEventDatabase creates a new TelemetryEventDatabase.
+// ipHashKey keys the IP hash; it must be stable across restarts for hashes to correlate.
+func NewTelemetryEventDatabase(db *sql.DB, ipHashKey []byte) *TelemetryEventDatabase {
+	return &TelemetryEventDatabase{db: db, ipHashKey: ipHashKey}
+}
+
+// HashIP returns the keyed hash stored in place of a client IP
+func (db *TelemetryEventDatabase) HashIP(ip string) string {
+	mac := hmac.New(sha256.New, db.ipHashKey)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Record inserts a telemetry event, hashing ip before it is written
+func (db *TelemetryEventDatabase) Record(event *TelemetryEvent, ip string) error {
+	signals := event.Signals
+	if signals == nil {
+		signals = []string{}
+	}
+	signalsJSON, err := json.Marshal(signals)
+	if err != nil {
+		return fmt.Errorf("failed to encode telemetry signals: %w", err)
+	}
+	event.IPHash = db.HashIP(ip)
+
+	_, err = db.db.Exec(`
+		INSERT INTO telemetry_events (form_id, status, risk_score, action, signals, ip_hash)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, event.FormID, event.Status, event.RiskScore, event.Action, string(signalsJSON), event.IPHash)
+	if err != nil {
+		return fmt.Errorf("failed to record telemetry event: %w", err)
+	}
+	return nil
+}
+
+// Stats aggregates events recorded within window: a 10-point score histogram,
+// the most frequently triggered signals, and a per-form daily breakdown.
+func (db *TelemetryEventDatabase) Stats(window time.Duration, topSignals int) (*TelemetryStats, error) {
+	since := time.Now().Add(-window).UTC()
+	cutoff := since.Format("2006-01-02 15:04:05")
+	stats := &TelemetryStats{Since: since}
+
+	if err := db.db.QueryRow(
+		"SELECT COUNT(*) FROM telemetry_events WHERE created_at > ?", cutoff,
+	).Scan(&stats.Total); err != nil {
+		return nil, fmt.Errorf("failed to count telemetry events: %w", err)
+	}
+
+	// Score histogram — every bucket is present, even when empty
+	stats.Buckets = make([]ScoreBucket, 10)
+	for i := range stats.Buckets {
+		stats.Buckets[i] = ScoreBucket{Min: i * 10, Max: i*10 + 9}
+	}
+	stats.Buckets[9].Max = 100
+
+	rows, err := db.db.Query(`
+		SELECT MIN(risk_score / 10, 9) AS bucket, COUNT(*)
+		FROM telemetry_events
+		WHERE created_at > ?
+		GROUP BY bucket
+	`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query score distribution: %w", err)
+	}
+	for rows.Next() {
+		var bucket, count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan score bucket: %w", err)
+		}
+		if bucket >= 0 && bucket < len(stats.Buckets) {
+			stats.Buckets[bucket].Count = count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating score buckets: %w", err)
+	}
+
+	rows, err = db.db.Query(`
+		SELECT j.value, COUNT(*) AS n
+		FROM telemetry_events, json_each(telemetry_events.signals) AS j
+		WHERE telemetry_events.created_at > ?
+		GROUP BY j.value
+		ORDER BY n DESC, j.value
+		LIMIT ?
+	`, cutoff, topSignals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top signals: %w", err)
+	}
+	for rows.Next() {
+		var sc SignalCount
+		if err := rows.Scan(&sc.Signal, &sc.Count); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan signal count: %w", err)
+		}
+		stats.TopSignals = append(stats.TopSignals, sc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating signal counts: %w", err)
+	}
+
+	rows, err = db.db.Query(`
+		SELECT form_id, date(created_at) AS day, COUNT(*), AVG(risk_score),
+			SUM(action = 'challenge'), SUM(action = 'block')
+		FROM telemetry_events
+		WHERE created_at > ?
+		GROUP BY form_id, day
+		ORDER BY day DESC, form_id
+	`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query form breakdown: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fs FormDayStat
+		if err := rows.Scan(&fs.FormID, &fs.Day, &fs.Count, &fs.AvgScore, &fs.Challenged, &fs.Blocked); err != nil {
+			return nil, fmt.Errorf("failed to scan form breakdown: %w", err)
+		}
+		stats.Forms = append(stats.Forms, fs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating form breakdown: %w", err)
+	}
+
+	return stats, nil
+}
+
+// DeleteOlderThan removes events older than the retention period and returns the count deleted
+func (db *TelemetryEventDatabase) DeleteOlderThan(retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention).UTC().Format("2006-01-02 15:04:05")
+	result, err := db.db.Exec("DELETE FROM telemetry_events WHERE created_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old telemetry events: %w", err)
+	}
+	return result.RowsAffected()
+}
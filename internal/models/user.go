@@ -41,6 +41,17 @@ type User struct {
 	Role         string    `json:"role"`
 	Status       string    `json:"status"`
 	CreatedAt    time.Time `json:"createdAt"`
+
+	// Scopes limits the user's permissions to these for the current request.
+	// It is set only when the request is authenticated with an API token;
+	// nil means the role's permissions apply in full.
+	Scopes []string `json:"-"`
+}
+
+// OwnerID makes a user record its own owner, so permissions granted with
+// ScopeOwn let users act on their own account
+func (u *User) OwnerID() int {
+	return u.ID
 }
 
 // UserDatabase provides database operations for users
@@ -268,6 +279,29 @@ func (db *UserDatabase) UpdatePasswordHash(id int, passwordHash string) error {
 	return nil
 }
 
+// UpdateStatus moves a user from one status to another, e.g. pending to active.
+// Returns ErrNotFound if no user with that ID currently has status from.
+func (db *UserDatabase) UpdateStatus(id int, from, to string) error {
+	result, err := db.db.Exec(
+		"UPDATE users SET status = ? WHERE id = ? AND status = ?",
+		to, id, from,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update status for user %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
 // Delete deletes a user by ID
 // Returns ErrNotFound if the user does not exist
 func (db *UserDatabase) Delete(id int) error {
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WebAuthnCredential is a registered passkey. PublicKey is the COSE_Key from
+// the authenticator.
+type WebAuthnCredential struct {
+	ID           int
+	UserID       int
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    uint32
+	Name         string
+	CreatedAt    time.Time
+	LastUsedAt   time.Time // zero if never used to sign in
+}
+
+// WebAuthnCredentialDatabase provides database operations for passkeys
+type WebAuthnCredentialDatabase struct {
+	db *sql.DB
+}
+
+// NewWebAuthnCredentialDatabase creates a new WebAuthnCredentialDatabase
+func NewWebAuthnCredentialDatabase(db *sql.DB) *WebAuthnCredentialDatabase {
+	return &WebAuthnCredentialDatabase{db: db}
+}
+
+// Create stores a newly registered credential
+func (db *WebAuthnCredentialDatabase) Create(c *WebAuthnCredential) error {
+	result, err := db.db.Exec(`
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, name)
+		VALUES (?, ?, ?, ?, ?)
+	`, c.UserID, c.CredentialID, c.PublicKey, c.SignCount, c.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create webauthn credential: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get credential ID: %w", err)
+	}
+	c.ID = int(id)
+	return nil
+}
+
+// GetByCredentialID returns the credential with the authenticator-assigned ID
+// Returns nil, nil if there is none (not an error condition)
+func (db *WebAuthnCredentialDatabase) GetByCredentialID(credentialID []byte) (*WebAuthnCredential, error) {
+	rows, err := db.db.Query(`
+		SELECT id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE credential_id = ?
+	`, credentialID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webauthn credential: %w", err)
+	}
+	defer rows.Close()
+
+	creds, err := scanWebAuthnCredentials(rows)
+	if err != nil || len(creds) == 0 {
+		return nil, err
+	}
+	return creds[0], nil
+}
+
+// ListByUserID returns the user's credentials, oldest first
+func (db *WebAuthnCredentialDatabase) ListByUserID(userID int) ([]*WebAuthnCredential, error) {
+	rows, err := db.db.Query(`
+		SELECT id, user_id, credential_id, public_key, sign_count, name, created_at, last_used_at
+		FROM webauthn_credentials WHERE user_id = ? ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+	defer rows.Close()
+
+	return scanWebAuthnCredentials(rows)
+}
+
+// UserHandle returns the user's WebAuthn user handle, storing newHandle first
+// if the user does not have one yet
+func (db *WebAuthnCredentialDatabase) UserHandle(userID int, newHandle []byte) ([]byte, error) {
+	if _, err := db.db.Exec(
+		"INSERT OR IGNORE INTO webauthn_users (user_id, user_handle) VALUES (?, ?)",
+		userID, newHandle); err != nil {
+		return nil, fmt.Errorf("failed to store webauthn user handle: %w", err)
+	}
+	var handle []byte
+	if err := db.db.QueryRow(
+		"SELECT user_handle FROM webauthn_users WHERE user_id = ?", userID).Scan(&handle); err != nil {
+		return nil, fmt.Errorf("failed to get webauthn user handle: %w", err)
+	}
+	return handle, nil
+}
+
+// UpdateUsage records a successful sign-in with the credential.
+// The counter only moves forward, so two racing logins cannot roll it back.
+func (db *WebAuthnCredentialDatabase) UpdateUsage(id int, signCount uint32) error {
+	_, err := db.db.Exec(`
+		UPDATE webauthn_credentials
+		SET sign_count = MAX(sign_count, ?), last_used_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, signCount, id)
+	if err != nil {
+		return fmt.Errorf("failed to update webauthn credential: %w", err)
+	}
+	return nil
+}
+
+// Delete removes one of the user's credentials
+// Returns ErrNotFound if the user has no credential with that ID
+func (db *WebAuthnCredentialDatabase) Delete(userID, id int) error {
+	result, err := db.db.Exec(
+		"DELETE FROM webauthn_credentials WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanWebAuthnCredentials reads credential rows
+func scanWebAuthnCredentials(rows *sql.Rows) ([]*WebAuthnCredential, error) {
+	var creds []*WebAuthnCredential
+	for rows.Next() {
+		c := &WebAuthnCredential{}
+		var createdAt string
+		var lastUsedAt sql.NullString
+
+		if err := rows.Scan(&c.ID, &c.UserID, &c.CredentialID, &c.PublicKey,
+			&c.SignCount, &c.Name, &createdAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webauthn credential: %w", err)
+		}
+
+		var err error
+		if c.CreatedAt, err = parseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		if lastUsedAt.Valid {
+			if c.LastUsedAt, err = parseTime(lastUsedAt.String); err != nil {
+				return nil, fmt.Errorf("failed to parse last_used_at: %w", err)
+			}
+		}
+		creds = append(creds, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webauthn credentials: %w", err)
+	}
+	return creds, nil
+}
@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWS algorithms accepted for ID tokens (RFC 7518 §3.1)
+const (
+	algRS256 = "RS256"
+	algES256 = "ES256"
+)
+
+// minRSABits rejects RSA keys too short to be trusted
+const minRSABits = 2048
+
+// errUnsupportedKey is returned for keys in the set this package cannot use;
+// they are skipped rather than failing the whole set
+var errUnsupportedKey = errors.New("unsupported json web key")
+
+// jsonWebKey is one entry of a JWK set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey verifies ID token signatures for one algorithm
+type publicKey struct {
+	alg string
+	ec  *ecdsa.PublicKey
+	rsa *rsa.PublicKey
+}
+
+// parse converts a signing key to a publicKey
+func (k jsonWebKey) parse() (*publicKey, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("%w: use %q", errUnsupportedKey, k.Use)
+	}
+	switch {
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == algRS256):
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad RSA key", errUnsupportedKey)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits || pub.E < 3 {
+			return nil, fmt.Errorf("%w: weak RSA key", errUnsupportedKey)
+		}
+		return &publicKey{alg: algRS256, rsa: pub}, nil
+
+	case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == algES256):
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad P-256 key", errUnsupportedKey)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point not on curve", errUnsupportedKey)
+		}
+		return &publicKey{alg: algES256, ec: pub}, nil
+	}
+	return nil, fmt.Errorf("%w: kty %q alg %q", errUnsupportedKey, k.Kty, k.Alg)
+}
+
+// verify checks sig over data. alg is the token header's algorithm, which
+// must be the one the key is for: trusting it alone would let a forger pick
+// a weaker algorithm.
+func (k *publicKey) verify(alg string, data, sig []byte) error {
+	if alg != k.alg {
+		return fmt.Errorf("%w: algorithm %q for %s key", ErrSignature, alg, k.alg)
+	}
+	digest := sha256.Sum256(data)
+	switch k.alg {
+	case algRS256:
+		if rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	case algES256:
+		// JWS carries ECDSA signatures as fixed-size R || S, not ASN.1
+		if len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if ecdsa.Verify(k.ec, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return ErrSignature
+}
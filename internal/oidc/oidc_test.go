@@ -0,0 +1,158 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"secure-ui-showcase-go/internal/oidc"
+	"secure-ui-showcase-go/internal/oidc/oidctest"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://app.example/login/oidc/callback"
+)
+
+// signIn runs a sign-in against issuer with claims and returns the result of
+// redeeming the code. The provider is given the same nonce and verifier it
+// built the authorization URL with unless nonce is set.
+func signIn(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider, claims oidctest.Claims, nonce string) (*oidc.Claims, error) {
+	t.Helper()
+	ctx := context.Background()
+	sentNonce, _ := oidc.NewVerifier()
+	verifier, _ := oidc.NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state", sentNonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	_, code, err := issuer.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if nonce == "" {
+		nonce = sentNonce
+	}
+	return p.Exchange(ctx, code, verifier, nonce)
+}
+
+func newProvider(issuer *oidctest.Issuer) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email"},
+	}, nil)
+}
+
+func TestExchange(t *testing.T) {
+	for _, secret := range []string{testClientSecret, ""} {
+		issuer := oidctest.NewIssuer(testClientID, secret)
+		defer issuer.Close()
+
+		claims, err := signIn(t, issuer, newProvider(issuer), oidctest.Claims{
+			"email":          "user@example.com",
+			"email_verified": "true",
+		}, "")
+		if err != nil {
+			t.Fatalf("Exchange (secret %q): %v", secret, err)
+		}
+		if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !bool(claims.EmailVerified) {
+			t.Errorf("claims = %+v", claims)
+		}
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*oidctest.Issuer)
+		claims oidctest.Claims
+		nonce  string
+		want   error
+	}{
+		{name: "bad signature", tamper: func(i *oidctest.Issuer) { i.SigningKey = otherKey }, want: oidc.ErrSignature},
+		{name: "wrong audience", claims: oidctest.Claims{"aud": "other-client"}, want: oidc.ErrClaims},
+		{name: "audience list without azp", claims: oidctest.Claims{"aud": []string{testClientID, "other"}}, want: oidc.ErrClaims},
+		{name: "wrong issuer", claims: oidctest.Claims{"iss": "https://evil.example"}, want: oidc.ErrClaims},
+		{name: "expired", claims: oidctest.Claims{"exp": time.Now().Add(-time.Hour).Unix()}, want: oidc.ErrClaims},
+		{name: "issued in the future", claims: oidctest.Claims{"iat": time.Now().Add(time.Hour).Unix()}, want: oidc.ErrClaims},
+		{name: "no subject", claims: oidctest.Claims{"sub": nil}, want: oidc.ErrClaims},
+		{name: "nonce of another sign-in", nonce: "another-sign-in", want: oidc.ErrClaims},
+		{name: "no nonce", claims: oidctest.Claims{"nonce": nil}, want: oidc.ErrClaims},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer := oidctest.NewIssuer(testClientID, testClientSecret)
+			defer issuer.Close()
+			if tt.tamper != nil {
+				tt.tamper(issuer)
+			}
+			if _, err := signIn(t, issuer, newProvider(issuer), tt.claims, tt.nonce); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID, testClientSecret)
+	defer issuer.Close()
+	p := newProvider(issuer)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "the-verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	_, code, err := issuer.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	// A code intercepted on its way back cannot be redeemed without the verifier
+	if _, err := p.Exchange(ctx, code, "another-verifier", "nonce"); !errors.Is(err, oidc.ErrExchange) {
+		t.Errorf("err = %v, want %v", err, oidc.ErrExchange)
+	}
+}
+
+func TestExchangeCodeReused(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID, testClientSecret)
+	defer issuer.Close()
+	p := newProvider(issuer)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	_, code, err := issuer.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, oidc.ErrExchange) {
+		t.Errorf("err = %v, want %v", err, oidc.ErrExchange)
+	}
+}
+
+func TestDiscoveryUnreachable(t *testing.T) {
+	issuer := oidctest.NewIssuer(testClientID, testClientSecret)
+	p := newProvider(issuer)
+	issuer.Close()
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); !errors.Is(err, oidc.ErrDiscovery) {
+		t.Errorf("err = %v, want %v", err, oidc.ErrDiscovery)
+	}
+}
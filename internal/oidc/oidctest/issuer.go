@@ -0,0 +1,226 @@
+// Package oidctest provides an in-process OpenID provider for testing
+// relying-party code, in the way net/http/httptest provides a test server.
+// It serves discovery, a JWKS with one ES256 key and a token endpoint that
+// checks the client, the redirect URI and the PKCE verifier.
+package oidctest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// keyID names the issuer's signing key in its JWKS and token headers
+const keyID = "test-key"
+
+// Claims are ID token claims. Given to Authorize, they are merged over the
+// defaults (iss, aud, sub, exp, iat and the sign-in's nonce); a nil value
+// removes a default.
+type Claims map[string]any
+
+// Issuer is a running mock provider. Its exported fields may be changed
+// between sign-ins to simulate a misbehaving provider.
+type Issuer struct {
+	URL          string // the issuer identifier and base URL
+	ClientID     string
+	ClientSecret string // empty for a public client
+
+	// SigningKey signs ID tokens. Replacing it with a key the JWKS does not
+	// publish produces tokens with a bad signature.
+	SigningKey *ecdsa.PrivateKey
+
+	server *httptest.Server
+	key    *ecdsa.PrivateKey // published in the JWKS
+
+	mu     sync.Mutex
+	grants map[string]grant
+	next   int
+}
+
+// grant is an authorization code waiting to be redeemed
+type grant struct {
+	redirectURI string
+	challenge   string
+	claims      Claims
+}
+
+// NewIssuer starts a provider for one client. Callers should Close it.
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	i := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		SigningKey:   key,
+		key:          key,
+		grants:       make(map[string]grant),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/token", i.token)
+	i.server = httptest.NewServer(mux)
+	i.URL = i.server.URL
+	return i
+}
+
+// Close shuts the provider down
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// Authorize plays the user signing in at the provider: it reads the sign-in
+// request from authURL, as built by the relying party, and returns the state
+// and authorization code the provider would redirect back with. claims are
+// merged over the defaults for the ID token the code redeems.
+func (i *Issuer) Authorize(authURL string, claims Claims) (state, code string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	q := u.Query()
+	switch {
+	case q.Get("response_type") != "code":
+		return "", "", errors.New("oidctest: response_type is not code")
+	case q.Get("client_id") != i.ClientID:
+		return "", "", fmt.Errorf("oidctest: unknown client %q", q.Get("client_id"))
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		return "", "", errors.New("oidctest: no S256 code challenge")
+	}
+
+	merged := Claims{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"sub":   "subject-1",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.next++
+	code = "code-" + strconv.Itoa(i.next)
+	i.grants[code] = grant{redirectURI: q.Get("redirect_uri"), challenge: q.Get("code_challenge"), claims: merged}
+	return q.Get("state"), code, nil
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "EC",
+		"crv": "P-256",
+		"kid": keyID,
+		"use": "sig",
+		"alg": "ES256",
+		"x":   encodeCoord(i.key.PublicKey.X),
+		"y":   encodeCoord(i.key.PublicKey.Y),
+	}}})
+}
+
+// token redeems an authorization code once (RFC 6749 §4.1.3, RFC 7636 §4.6)
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID || secret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := i.sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// sign returns claims as a compact JWS signed with SigningKey
+func (i *Issuer) sign(claims Claims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, i.SigningKey, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS carries ECDSA signatures as fixed-size R || S
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// encodeCoord encodes a P-256 coordinate as a fixed-size base64url string
+func encodeCoord(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, 32)))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
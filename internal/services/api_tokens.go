@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"secure-ui-showcase-go/internal/models"
+)
+
+const (
+	// apiTokenPrefix marks API tokens so leaked ones are easy to spot in logs
+	// and by secret scanners
+	apiTokenPrefix        = "sui_"
+	apiTokenDisplayLength = len(apiTokenPrefix) + 6
+	maxAPITokensPerUser   = 20
+	maxAPITokenNameLength = 64
+	maxAPITokenLifetime   = 365 * 24 * time.Hour
+	apiTokenUsesRetention = 90 * 24 * time.Hour
+	defaultAPITokenName   = "API token"
+)
+
+// APITokenLifetimes are the expiry choices offered when creating a token, in days
+var APITokenLifetimes = []int{7, 30, 90, 365}
+
+var (
+	// ErrAPITokensUnavailable is returned when API tokens are not configured
+	ErrAPITokensUnavailable = errors.New("API tokens are not configured")
+	// ErrAPITokenLimit is returned when the user already has the maximum number of tokens
+	ErrAPITokenLimit = errors.New("too many API tokens")
+	// ErrAPITokenInvalid is returned for a token request without scopes or with
+	// a lifetime out of range
+	ErrAPITokenInvalid = errors.New("choose at least one scope and an expiry of at most a year")
+)
+
+// SetAPITokens enables personal API tokens
+func (s *AuthService) SetAPITokens(db *models.APITokenDatabase) {
+	s.APITokenDB = db
+}
+
+// APITokensAvailable reports whether SetAPITokens has been called
+func (s *AuthService) APITokensAvailable() bool {
+	return s.APITokenDB != nil
+}
+
+// APITokens returns the user's unexpired API tokens
+func (s *AuthService) APITokens(userID int) ([]*models.APIToken, error) {
+	if s.APITokenDB == nil {
+		return nil, nil
+	}
+	return s.APITokenDB.ListByUserID(userID)
+}
+
+// CreateAPIToken issues a token for user limited to scopes, which the caller
+// must already have checked the user holds. The returned token string is the
+// only copy; only its hash is stored.
+func (s *AuthService) CreateAPIToken(user *models.User, name string, scopes []string, lifetime time.Duration) (string, *models.APIToken, error) {
+	if s.APITokenDB == nil {
+		return "", nil, ErrAPITokensUnavailable
+	}
+	if len(scopes) == 0 || lifetime <= 0 || lifetime > maxAPITokenLifetime {
+		return "", nil, ErrAPITokenInvalid
+	}
+	n, err := s.APITokenDB.CountByUserID(user.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if n >= maxAPITokensPerUser {
+		return "", nil, ErrAPITokenLimit
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultAPITokenName
+	}
+	if utf8.RuneCountInString(name) > maxAPITokenNameLength {
+		name = string([]rune(name)[:maxAPITokenNameLength])
+	}
+
+	random, err := models.GenerateSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := apiTokenPrefix + strings.TrimRight(random, "=")
+	t := &models.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: models.HashToken(raw),
+		Prefix:    raw[:apiTokenDisplayLength],
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := s.APITokenDB.Create(t); err != nil {
+		return "", nil, err
+	}
+	log.Printf("[SECURITY] api token created: user=%d token=%d scopes=%s expires=%s",
+		user.ID, t.ID, strings.Join(scopes, ","), t.ExpiresAt.UTC().Format(time.RFC3339))
+	return raw, t, nil
+}
+
+// RevokeAPIToken deletes one of the user's tokens. It returns
+// models.ErrNotFound if the token is gone or belongs to someone else.
+func (s *AuthService) RevokeAPIToken(userID, tokenID int) error {
+	if s.APITokenDB == nil {
+		return ErrAPITokensUnavailable
+	}
+	if err := s.APITokenDB.DeleteByID(tokenID, userID); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] api token revoked: user=%d token=%d", userID, tokenID)
+	return nil
+}
+
+// AuthenticateAPIToken returns the user and token for a bearer token, or
+// nil, nil if it is unknown, expired or its account is not active. The user's
+// Scopes are set to the token's, so the Authorizer only allows permissions
+// that are both granted to the role and in scope.
+func (s *AuthService) AuthenticateAPIToken(raw string) (*models.User, *models.APIToken, error) {
+	if s.APITokenDB == nil || !strings.HasPrefix(raw, apiTokenPrefix) {
+		return nil, nil, nil
+	}
+	t, err := s.APITokenDB.GetByHash(models.HashToken(raw))
+	if err != nil || t == nil {
+		return nil, nil, err
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, nil, nil
+	}
+
+	user, err := s.UserDB.GetByID(t.UserID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Status != "active" {
+		log.Printf("[SECURITY] api token refused for inactive account: user=%d token=%d", user.ID, t.ID)
+		return nil, nil, nil
+	}
+	user.Scopes = t.Scopes
+	if user.Scopes == nil {
+		user.Scopes = []string{}
+	}
+	return user, t, nil
+}
+
+// RecordAPITokenUse adds a request made with t to its audit trail
+func (s *AuthService) RecordAPITokenUse(t *models.APIToken, method, path, ip string, status int) {
+	log.Printf("[SECURITY] api token used: user=%d token=%d %s %s status=%d ip=%s",
+		t.UserID, t.ID, method, path, status, ip)
+	if err := s.APITokenDB.RecordUse(t, method, path, ip, status); err != nil {
+		log.Printf("Failed to record api token use: token=%d err=%v", t.ID, err)
+	}
+}
+
+// cleanupAPITokens removes expired tokens and prunes their audit trail
+func (s *AuthService) cleanupAPITokens() {
+	if s.APITokenDB == nil {
+		return
+	}
+	if _, err := s.APITokenDB.DeleteExpired(); err != nil {
+		log.Printf("Failed to cleanup expired api tokens: %v", err)
+	}
+	if _, err := s.APITokenDB.DeleteUsesOlderThan(apiTokenUsesRetention); err != nil {
+		log.Printf("Failed to prune api token uses: %v", err)
+	}
+}
@@ -1,151 +1,419 @@
 package services
 
 import (
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
+	"secure-ui-showcase-go/internal/ipfilter"
+	"secure-ui-showcase-go/internal/mail"
 	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/oidc"
+	"secure-ui-showcase-go/internal/telemetry"
+	"secure-ui-showcase-go/internal/webauthn"
 )
 
 var (
 	// ErrInvalidCredentials is returned for any login failure (generic to prevent enumeration)
 	ErrInvalidCredentials = errors.New("invalid email or password")
-	// ErrAccountLocked is returned when too many failed attempts have occurred
+	// ErrAccountLocked is returned when too many failed attempts have occurred.
+	// Login wraps it in a *LockoutError carrying the retry time.
 	ErrAccountLocked = errors.New("account temporarily locked")
 	// ErrEmailExists is returned generically when registration fails due to duplicate email
 	ErrEmailExists = errors.New("registration failed")
+	// ErrRiskRefused is returned when behavioral telemetry scores a login at the
+	// challenge threshold. No challenge step is offered: the login is refused,
+	// but unlike ErrRiskBlocked it is not counted as a failed attempt.
+	ErrRiskRefused = errors.New("login refused by risk policy")
+	// ErrRiskBlocked is returned when behavioral telemetry is scored as a bot
+	ErrRiskBlocked = errors.New("login blocked by risk policy")
+	// ErrClientDenied is returned when the client IP is on the denylist
+	ErrClientDenied = errors.New("client address denied")
 )
 
+// RiskMode controls how Login acts on a telemetry risk assessment
+type RiskMode string
+
 const (
-	bcryptCost      = 12
-	sessionDuration = 24 * time.Hour
+	// RiskModeLog records the assessment but never blocks a login
+	RiskModeLog RiskMode = "log"
+	// RiskModeEnforce refuses logins the assessment challenges or blocks
+	RiskModeEnforce RiskMode = "enforce"
+)
 
-	// DefaultLockoutThreshold is the number of consecutive failures before lockout.
-	DefaultLockoutThreshold = 5
-	// DefaultLockoutWindow is the time window for counting failures.
-	DefaultLockoutWindow = 15 * time.Minute
+// LockoutPolicy locks a key once Threshold failures have been recorded within
+// Window. The first lock lasts BaseLock and each further failure doubles it, up
+// to MaxLock, measured from the latest failure. Failures made while locked are
+// refused before they are recorded, so only attempts after a lock expires escalate it.
+type LockoutPolicy struct {
+	Threshold int // a negative threshold disables the policy
+	Window    time.Duration
+	BaseLock  time.Duration
+	MaxLock   time.Duration
+}
+
+// Default prefix lengths that group client IPs into a subnet for lockout:
+// wide enough to catch one operator's address range, unlike the rate limiter's
+// per-client buckets
+const (
+	DefaultLockoutSubnetIPv4Prefix = 24
+	DefaultLockoutSubnetIPv6Prefix = 48
 )
 
-// dummyHash is a valid bcrypt hash pre-computed at startup cost factor.
-// Used in the user-not-found path to perform a real bcrypt comparison,
-// keeping that path timing-indistinguishable from a wrong-password path.
-var dummyHash string
+// LockoutConfig holds a lockout policy per scope: the submitted email, the exact
+// client IP, and the client's subnet. The IP scopes catch credential stuffing
+// spread across many accounts. SubnetBuckets groups addresses into subnets; it
+// is separate from the rate limiter's buckets, and zero fields take the defaults.
+type LockoutConfig struct {
+	Account       LockoutPolicy
+	IP            LockoutPolicy
+	Subnet        LockoutPolicy
+	SubnetBuckets ipfilter.Bucketer
+}
 
-func init() {
-	h, err := bcrypt.GenerateFromPassword([]byte("dummy-placeholder-no-match"), bcryptCost)
-	if err != nil {
-		panic(fmt.Sprintf("failed to pre-compute dummy bcrypt hash: %v", err))
+// DefaultLockoutConfig returns the package default lockout policies
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		Account: LockoutPolicy{Threshold: 5, Window: time.Hour, BaseLock: time.Minute, MaxLock: time.Hour},
+		IP:      LockoutPolicy{Threshold: 20, Window: time.Hour, BaseLock: time.Minute, MaxLock: time.Hour},
+		Subnet:  LockoutPolicy{Threshold: 100, Window: time.Hour, BaseLock: time.Minute, MaxLock: time.Hour},
+		SubnetBuckets: ipfilter.Bucketer{
+			IPv4Bits: DefaultLockoutSubnetIPv4Prefix,
+			IPv6Bits: DefaultLockoutSubnetIPv6Prefix,
+		},
+	}
+}
+
+// withDefaults fills zero fields of p from def
+func (p LockoutPolicy) withDefaults(def LockoutPolicy) LockoutPolicy {
+	if p.Threshold == 0 {
+		p.Threshold = def.Threshold
 	}
-	dummyHash = string(h)
+	if p.Window <= 0 {
+		p.Window = def.Window
+	}
+	if p.BaseLock <= 0 {
+		p.BaseLock = def.BaseLock
+	}
+	if p.MaxLock < p.BaseLock {
+		p.MaxLock = max(def.MaxLock, p.BaseLock)
+	}
+	return p
+}
+
+// lockFor returns the lock length after failures recent failures
+func (p LockoutPolicy) lockFor(failures int) time.Duration {
+	lock := p.BaseLock
+	for i := p.Threshold; i < failures && lock < p.MaxLock; i++ {
+		lock *= 2
+	}
+	return min(lock, p.MaxLock)
+}
+
+// LockoutError is returned by Login while any lockout applies. It matches
+// ErrAccountLocked with errors.Is and deliberately does not say which scope fired.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%v; retry after %v", ErrAccountLocked, e.RetryAfter)
+}
+
+// Is reports whether target is ErrAccountLocked
+func (e *LockoutError) Is(target error) bool {
+	return target == ErrAccountLocked
 }
 
 // AuthService handles authentication, registration, and session management
 type AuthService struct {
-	UserDB            *models.UserDatabase
-	SessionDB         *models.SessionDatabase
-	LoginAttemptDB    *models.LoginAttemptDatabase
-	lockoutThreshold  int
-	lockoutWindow     time.Duration
+	UserDB         *models.UserDatabase
+	SessionDB      *models.SessionDatabase
+	LoginAttemptDB *models.LoginAttemptDatabase
+	MFADB          *models.MFADatabase                // nil until SetMFA is called
+	PasskeyDB      *models.WebAuthnCredentialDatabase // nil until SetPasskeys is called
+	ResetDB        *models.PasswordResetDatabase      // nil until SetPasswordReset is called
+	APITokenDB     *models.APITokenDatabase           // nil until SetAPITokens is called
+	OIDCDB         *models.OIDCDatabase               // nil until SetOIDC is called
+	MagicLinkDB    *models.MagicLinkDatabase          // nil until SetMagicLinks is called
+	mfaAEAD        cipher.AEAD
+	rp             *webauthn.RelyingParty
+	oidc           *oidc.Provider
+	oidcName       string
+	challenges     ChallengeStore
+	mailer         mail.Mailer
+	baseURL        string
+	verifyKey      []byte // nil until SetEmailVerification is called
+	hasher         PasswordHasher
+	dummyHash      string // hashed by hasher; verified when the user is not found
+	sessions       SessionConfig
+	policy         *PasswordPolicy
+	lockout        LockoutConfig
+	riskMode       RiskMode
+	clientBuckets  ipfilter.Bucketer
+	clientAccess   *ipfilter.List
 }
 
 // NewAuthService creates a new AuthService with the given dependencies.
-// lockoutThreshold and lockoutWindow control account lockout behaviour;
-// pass 0 values to use the package defaults.
+// lockout controls account, IP and subnet lockout; zero fields fall back to
+// DefaultLockoutConfig.
 func NewAuthService(
 	userDB *models.UserDatabase,
 	sessionDB *models.SessionDatabase,
 	loginAttemptDB *models.LoginAttemptDatabase,
-	lockoutThreshold int,
-	lockoutWindow time.Duration,
+	lockout LockoutConfig,
 ) *AuthService {
-	if lockoutThreshold <= 0 {
-		lockoutThreshold = DefaultLockoutThreshold
-	}
-	if lockoutWindow <= 0 {
-		lockoutWindow = DefaultLockoutWindow
+	def := DefaultLockoutConfig()
+	lockout.Account = lockout.Account.withDefaults(def.Account)
+	lockout.IP = lockout.IP.withDefaults(def.IP)
+	lockout.Subnet = lockout.Subnet.withDefaults(def.Subnet)
+	if lockout.SubnetBuckets.IPv4Bits <= 0 {
+		lockout.SubnetBuckets.IPv4Bits = def.SubnetBuckets.IPv4Bits
+	}
+	if lockout.SubnetBuckets.IPv6Bits <= 0 {
+		lockout.SubnetBuckets.IPv6Bits = def.SubnetBuckets.IPv6Bits
+	}
+	s := &AuthService{
+		UserDB:         userDB,
+		SessionDB:      sessionDB,
+		LoginAttemptDB: loginAttemptDB,
+		lockout:        lockout,
+		riskMode:       RiskModeLog,
+		clientBuckets:  ipfilter.DefaultBucketer(),
+		sessions:       DefaultSessionConfig(),
+		policy:         DefaultPasswordPolicy(),
+	}
+	if err := s.SetPasswordHasher(NewArgon2idHasher(DefaultArgon2idParams)); err != nil {
+		panic(fmt.Sprintf("failed to pre-compute dummy password hash: %v", err))
+	}
+	return s
+}
+
+// SetPasswordHasher changes how new passwords are hashed. Stored hashes in
+// other formats the hasher can verify are upgraded as users sign in.
+func (s *AuthService) SetPasswordHasher(hasher PasswordHasher) error {
+	dummy, err := hasher.Hash("dummy-placeholder-no-match")
+	if err != nil {
+		return err
 	}
-	return &AuthService{
-		UserDB:           userDB,
-		SessionDB:        sessionDB,
-		LoginAttemptDB:   loginAttemptDB,
-		lockoutThreshold: lockoutThreshold,
-		lockoutWindow:    lockoutWindow,
+	s.hasher = hasher
+	s.dummyHash = dummy
+	return nil
+}
+
+// SetRiskMode changes how Login acts on telemetry risk assessments.
+// Unknown modes fall back to RiskModeLog.
+func (s *AuthService) SetRiskMode(mode RiskMode) {
+	if mode != RiskModeEnforce {
+		mode = RiskModeLog
 	}
+	s.riskMode = mode
+}
+
+// SetClientFilter sets how client IPs are bucketed in security logs, matching the
+// rate limiter, and which networks are denied. Lockout subnets are configured
+// separately through LockoutConfig.SubnetBuckets.
+// Denylisted clients are refused before any credential check. Allowlisted clients
+// skip IP and subnet lockout but never account lockout or authentication.
+func (s *AuthService) SetClientFilter(buckets ipfilter.Bucketer, access *ipfilter.List) {
+	s.clientBuckets = buckets
+	s.clientAccess = access
+}
+
+// SetPasswordPolicy replaces the rules new passwords are checked against
+func (s *AuthService) SetPasswordPolicy(policy *PasswordPolicy) {
+	s.policy = policy
+}
+
+// PasswordPolicy returns the rules new passwords are checked against
+func (s *AuthService) PasswordPolicy() *PasswordPolicy {
+	return s.policy
 }
 
-// HashPassword creates a bcrypt hash from a plaintext password
+// HashPassword hashes a plaintext password with the configured PasswordHasher
 func (s *AuthService) HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	hash, err := s.hasher.Hash(password)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	return string(hash), nil
+	return hash, nil
 }
 
-// VerifyPassword checks a plaintext password against a bcrypt hash
-// bcrypt internally uses constant-time comparison
+// VerifyPassword checks a plaintext password against a stored hash in constant time
 func (s *AuthService) VerifyPassword(hash, password string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	ok, _, err := s.hasher.Verify(hash, password)
+	if err != nil {
+		log.Printf("Failed to verify password hash: %v", err)
+	}
+	return ok
 }
 
-// IsAccountLocked checks if an account has exceeded the failure threshold
-func (s *AuthService) IsAccountLocked(email string) (bool, error) {
-	count, err := s.LoginAttemptDB.CountRecentFailures(email, s.lockoutWindow)
+// verifyAndUpgradePassword is VerifyPassword for sign-in: when the password is
+// right but the stored hash uses an older algorithm or weaker parameters, it
+// is replaced with a fresh hash while the plaintext is at hand
+func (s *AuthService) verifyAndUpgradePassword(user *models.User, password string) bool {
+	ok, rehash, err := s.hasher.Verify(user.PasswordHash, password)
 	if err != nil {
-		return false, err
-	}
-	return count >= s.lockoutThreshold, nil
+		log.Printf("Failed to verify password hash for user %d: %v", user.ID, err)
+		return false
+	}
+	if ok && rehash {
+		if hash, err := s.HashPassword(password); err != nil {
+			log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		} else if err := s.UserDB.UpdatePasswordHash(user.ID, hash); err != nil {
+			log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+		} else {
+			log.Printf("Password hash upgraded for user %d", user.ID)
+		}
+	}
+	return ok
+}
+
+// lockoutRemaining returns how long login must stay refused for this email and
+// client, the longest of the account, IP and subnet locks; 0 means not locked.
+func (s *AuthService) lockoutRemaining(email, ip string) (time.Duration, error) {
+	type scope struct {
+		policy LockoutPolicy
+		key    models.AttemptKey
+		value  string
+		count  func(string, time.Duration) (int, error)
+	}
+	scopes := []scope{{s.lockout.Account, models.AttemptKeyEmail, email, s.LoginAttemptDB.CountRecentFailures}}
+	if !s.clientAccess.Allowed(ip) {
+		scopes = append(scopes, scope{s.lockout.IP, models.AttemptKeyIP, ip, s.LoginAttemptDB.CountRecentFailuresByIP})
+		scopes = append(scopes, scope{s.lockout.Subnet, models.AttemptKeySubnet, s.lockout.SubnetBuckets.Key(ip), s.LoginAttemptDB.CountRecentFailuresBySubnet})
+	}
+
+	now := time.Now()
+	var remaining time.Duration
+	for _, sc := range scopes {
+		if sc.policy.Threshold <= 0 || sc.value == "" {
+			continue
+		}
+		failures, err := sc.count(sc.value, sc.policy.Window)
+		if err != nil {
+			return 0, err
+		}
+		if failures < sc.policy.Threshold {
+			continue
+		}
+		last, err := s.LoginAttemptDB.LastFailure(sc.key, sc.value)
+		if err != nil {
+			return 0, err
+		}
+		if left := last.Add(sc.policy.lockFor(failures)).Sub(now); left > remaining {
+			log.Printf("Login lockout: scope=%s value=%s failures=%d retry_after=%v", sc.key, sc.value, failures, left.Round(time.Second))
+			remaining = left
+		}
+	}
+	return remaining, nil
 }
 
-// Login authenticates a user and creates a session
-// Returns the session token on success
-func (s *AuthService) Login(email, password, ip, userAgent string) (string, error) {
+// Login authenticates a user and creates a session.
+// Users with two-factor authentication get an MFA challenge token instead of a
+// session; the session is created by VerifyMFA.
+func (s *AuthService) Login(email, password, ip, userAgent string) (LoginResult, error) {
+	return s.LoginWithRisk(email, password, ip, userAgent, nil)
+}
+
+// LoginWithRisk is Login with a server-side telemetry risk assessment.
+// In RiskModeEnforce, challenged and blocked assessments are both refused before
+// any credential check; only blocked ones are recorded as failed attempts.
+// A nil risk skips the check.
+func (s *AuthService) LoginWithRisk(email, password, ip, userAgent string, risk *telemetry.Assessment) (LoginResult, error) {
+	if s.clientAccess.Denied(ip) {
+		log.Printf("[SECURITY] login from denylisted client: email=%s ip=%s bucket=%s ua=%.200s",
+			email, ip, s.clientBuckets.Key(ip), userAgent)
+		return LoginResult{}, ErrClientDenied
+	}
+
 	// Check lockout BEFORE any credential check
-	locked, err := s.IsAccountLocked(email)
+	remaining, err := s.lockoutRemaining(email, ip)
 	if err != nil {
-		return "", fmt.Errorf("failed to check lockout: %w", err)
+		return LoginResult{}, fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked login attempt: email=%s ip=%s", email, ip)
+		return LoginResult{}, &LockoutError{RetryAfter: remaining}
 	}
-	if locked {
-		log.Printf("Locked account login attempt: email=%s ip=%s", email, ip)
-		return "", ErrAccountLocked
+
+	if risk != nil && risk.Action != telemetry.ActionAllow {
+		log.Printf("[RISK] login: email=%s ip=%s score=%d action=%s mode=%s reasons=%v",
+			email, ip, risk.Score, risk.Action, s.riskMode, risk.Reasons)
+		if s.riskMode == RiskModeEnforce {
+			if risk.Action == telemetry.ActionBlock {
+				s.recordFailedAttempt(email, ip, userAgent)
+				return LoginResult{}, ErrRiskBlocked
+			}
+			return LoginResult{}, ErrRiskRefused
+		}
 	}
 
 	// Look up user
 	user, err := s.UserDB.GetByEmail(email)
 	if err != nil {
-		// User not found — run a real bcrypt comparison against the pre-computed
+		// User not found — run a real hash comparison against the pre-computed
 		// dummy hash to keep this path timing-indistinguishable from wrong password.
-		_ = bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+		_, _, _ = s.hasher.Verify(s.dummyHash, password)
 		s.recordFailedAttempt(email, ip, userAgent)
-		return "", ErrInvalidCredentials
+		return LoginResult{}, ErrInvalidCredentials
 	}
 
 	// Check that user has a password set
 	if user.PasswordHash == "" {
 		s.recordFailedAttempt(email, ip, userAgent)
-		return "", ErrInvalidCredentials
+		return LoginResult{}, ErrInvalidCredentials
 	}
 
-	// Verify password
-	if !s.VerifyPassword(user.PasswordHash, password) {
+	// Verify password, upgrading an outdated hash
+	if !s.verifyAndUpgradePassword(user, password) {
 		s.recordFailedAttempt(email, ip, userAgent)
-		return "", ErrInvalidCredentials
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	// Pending accounts get their own error so the login page can offer a new
+	// link; the password was right, so it is not counted as a failure
+	if user.Status == "pending" && s.EmailVerificationRequired() {
+		log.Printf("Login refused, email not verified: id=%d ip=%s", user.ID, ip)
+		return LoginResult{}, ErrEmailNotVerified
 	}
 
 	// Check user status
 	if user.Status != "active" {
 		s.recordFailedAttempt(email, ip, userAgent)
-		return "", ErrInvalidCredentials
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	// Second factor: the password was right, but no session until VerifyMFA
+	needMFA, err := s.requiresMFA(user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if needMFA {
+		token, err := s.startMFAChallenge(user.ID)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		log.Printf("Password accepted, second factor required: id=%d ip=%s", user.ID, ip)
+		return LoginResult{MFAToken: token}, nil
+	}
+
+	token, err := s.createSession(user, ip, userAgent)
+	if err != nil {
+		return LoginResult{}, err
 	}
+	return LoginResult{SessionToken: token}, nil
+}
 
+// createSession records a successful login and creates the user's session
+func (s *AuthService) createSession(user *models.User, ip, userAgent string) (string, error) {
 	// Record successful login
 	_ = s.LoginAttemptDB.Record(&models.LoginAttempt{
-		Email:     email,
+		Email:     user.Email,
 		IPAddress: ip,
+		IPBucket:  s.lockout.SubnetBuckets.Key(ip),
 		UserAgent: userAgent,
 		Success:   true,
 	})
@@ -158,18 +426,18 @@ func (s *AuthService) Login(email, password, ip, userAgent string) (string, erro
 
 	session := &models.Session{
 		UserID:    user.ID,
-		Token:     token,
+		TokenHash: models.HashToken(token),
 		IPAddress: ip,
 		UserAgent: userAgent,
-		ExpiresAt: time.Now().Add(sessionDuration),
+		ExpiresAt: time.Now().Add(s.sessions.IdleTimeout),
 	}
 
 	if err := s.SessionDB.Create(session); err != nil {
-		log.Printf("Session creation failed after successful auth: id=%d email=%s ip=%s err=%v", user.ID, email, ip, err)
+		log.Printf("Session creation failed after successful auth: id=%d email=%s ip=%s err=%v", user.ID, user.Email, ip, err)
 		return "", fmt.Errorf("failed to create session: %w", err)
 	}
 
-	log.Printf("User logged in: id=%d email=%s ip=%s", user.ID, email, ip)
+	log.Printf("User logged in: id=%d email=%s ip=%s", user.ID, user.Email, ip)
 	return token, nil
 }
 
@@ -178,6 +446,7 @@ func (s *AuthService) recordFailedAttempt(email, ip, userAgent string) {
 	if err := s.LoginAttemptDB.Record(&models.LoginAttempt{
 		Email:     email,
 		IPAddress: ip,
+		IPBucket:  s.lockout.SubnetBuckets.Key(ip),
 		UserAgent: userAgent,
 		Success:   false,
 	}); err != nil {
@@ -188,49 +457,72 @@ func (s *AuthService) recordFailedAttempt(email, ip, userAgent string) {
 
 // Logout deletes a session by token
 func (s *AuthService) Logout(token string) error {
-	return s.SessionDB.DeleteByToken(token)
+	return s.SessionDB.DeleteByToken(token, s.sessions.RotationGrace)
 }
 
-// ValidateSession checks if a session token is valid and returns the associated user
+// ValidateSession checks if a session token is valid and returns the associated user.
+// Each use slides the session's idle expiry forward (throttled by sessionTouchInterval).
 // Returns nil, nil if the session is invalid or expired (not an error)
 func (s *AuthService) ValidateSession(token string) (*models.User, error) {
+	user, _, err := s.validateSession(token)
+	return user, err
+}
+
+// AuthenticateSession is ValidateSession for incoming requests: when the
+// session's token is due for rotation it also returns the replacement, which
+// the caller must send back as the new session cookie. The old token keeps
+// working for SessionConfig.RotationGrace.
+func (s *AuthService) AuthenticateSession(token string) (*models.User, *RotatedSession, error) {
+	user, session, err := s.validateSession(token)
+	if user == nil {
+		return nil, nil, err
+	}
+	return user, s.rotateSession(session, token), nil
+}
+
+// validateSession implements ValidateSession, also returning the session row
+func (s *AuthService) validateSession(token string) (*models.User, *models.Session, error) {
 	if token == "" {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	session, err := s.SessionDB.GetByToken(token)
+	session, err := s.lookupSession(token)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if session == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	// Check expiry
-	if time.Now().After(session.ExpiresAt) {
-		_ = s.SessionDB.DeleteByToken(token)
-		return nil, nil
+	// Check idle expiry and absolute lifetime
+	now := time.Now()
+	if now.After(session.ExpiresAt) || now.After(session.CreatedAt.Add(s.sessions.AbsoluteTimeout)) {
+		_ = s.SessionDB.DeleteByToken(token, s.sessions.RotationGrace)
+		return nil, nil, nil
 	}
 
 	user, err := s.UserDB.GetByID(session.UserID)
 	if err != nil {
 		// User deleted but session still exists; clean up
-		_ = s.SessionDB.DeleteByToken(token)
-		return nil, nil
+		_ = s.SessionDB.DeleteByToken(token, s.sessions.RotationGrace)
+		return nil, nil, nil
 	}
 
-	return user, nil
+	s.touchSession(session)
+	return user, session, nil
 }
 
-// RegisterUser creates a new user account with a hashed password
+// RegisterUser creates a new user account with a hashed password.
+// With email verification on, the account starts as pending and a
+// verification link is emailed.
 func (s *AuthService) RegisterUser(firstName, lastName, email, password string) (*models.User, error) {
-	existing, err := s.UserDB.GetByEmail(email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check email availability: %w", err)
-	}
-	if existing != nil {
+	_, err := s.UserDB.GetByEmail(email)
+	if err == nil {
 		return nil, ErrEmailExists
 	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check email availability: %w", err)
+	}
 
 	hash, err := s.HashPassword(password)
 	if err != nil {
@@ -245,13 +537,19 @@ func (s *AuthService) RegisterUser(firstName, lastName, email, password string)
 		Role:         "user",
 		Status:       "active",
 	}
+	if s.EmailVerificationRequired() {
+		user.Status = "pending"
+	}
 
 	created, err := s.UserDB.CreateWithPassword(user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	log.Printf("User registered: id=%d email=%s", created.ID, email)
+	log.Printf("User registered: id=%d email=%s status=%s", created.ID, email, created.Status)
+	if created.Status == "pending" {
+		s.sendVerification(created)
+	}
 	return created, nil
 }
 
@@ -270,6 +568,15 @@ func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword st
 		return ErrInvalidCredentials
 	}
 
+	if err := s.setPassword(userID, newPassword); err != nil {
+		return err
+	}
+	log.Printf("Password changed for user id=%d, all sessions invalidated", userID)
+	return nil
+}
+
+// setPassword stores a new password hash and signs the user out everywhere
+func (s *AuthService) setPassword(userID int, newPassword string) error {
 	// Hash new password
 	newHash, err := s.HashPassword(newPassword)
 	if err != nil {
@@ -287,7 +594,12 @@ func (s *AuthService) ChangePassword(userID int, currentPassword, newPassword st
 		// Don't return error — password was already changed successfully
 	}
 
-	log.Printf("Password changed for user id=%d, all sessions invalidated", userID)
+	// An outstanding reset link must not outlive the password it was meant to replace
+	if s.ResetDB != nil {
+		if err := s.ResetDB.DeleteByUserID(userID); err != nil {
+			log.Printf("Warning: failed to delete reset tokens for user %d: %v", userID, err)
+		}
+	}
 	return nil
 }
 
@@ -302,4 +614,18 @@ func (s *AuthService) CleanupExpiredSessions() {
 	if count > 0 {
 		log.Printf("Cleaned up %d expired sessions", count)
 	}
+
+	if s.MFADB != nil {
+		if _, err := s.MFADB.DeleteExpiredChallenges(); err != nil {
+			log.Printf("Failed to cleanup expired MFA challenges: %v", err)
+		}
+	}
+	if s.ResetDB != nil {
+		if _, err := s.ResetDB.DeleteExpired(); err != nil {
+			log.Printf("Failed to cleanup expired reset tokens: %v", err)
+		}
+	}
+	s.cleanupAPITokens()
+	s.cleanupOIDC()
+	s.cleanupMagicLinks()
 }
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+
+	"secure-ui-showcase-go/internal/models"
+)
+
+var (
+	// ErrInvalidRoleName is returned for role names outside roleNamePattern
+	ErrInvalidRoleName = errors.New("role names are 2 to 32 lowercase letters, digits, - or _, starting with a letter")
+	// ErrInvalidGrant is returned for an unknown permission or a scope it cannot have
+	ErrInvalidGrant = errors.New("invalid permission or scope")
+	// ErrRoleLockout is returned when a change would take role management away
+	// from the caller's own role, leaving nobody able to undo it
+	ErrRoleLockout = errors.New("you cannot remove role management from your own role")
+)
+
+// roleNamePattern limits role names to short slugs
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Resource is something a permission can be checked against. Permissions
+// granted with models.ScopeOwn only apply to resources the user owns.
+type Resource interface {
+	OwnerID() int
+}
+
+// Authorizer decides what users may do from the permissions granted to their
+// role. Grants are read from the database on every check, so changes made on
+// the roles page apply to the next request, on every instance.
+type Authorizer struct {
+	roles *models.RoleDatabase
+}
+
+// NewAuthorizer creates an authorizer backed by roles
+func NewAuthorizer(roles *models.RoleDatabase) *Authorizer {
+	return &Authorizer{roles: roles}
+}
+
+// Can reports whether user may use permission on resource. resource may be nil
+// for actions not about one resource, in which case only a grant for all
+// resources allows it. A nil user or a failed lookup is denied.
+func (a *Authorizer) Can(user *models.User, permission string, resource Resource) bool {
+	switch a.scope(user, permission) {
+	case models.ScopeAll:
+		return true
+	case models.ScopeOwn:
+		return resource != nil && resource.OwnerID() == user.ID
+	default:
+		return false
+	}
+}
+
+// Has reports whether user holds permission at any scope. Route middleware
+// uses it to turn away requests early; handlers of own-scoped permissions
+// still call Can with the resource.
+func (a *Authorizer) Has(user *models.User, permission string) bool {
+	return a.scope(user, permission) != ""
+}
+
+// scope returns the scope at which user's role holds permission, or "".
+// A user authenticated with an API token only holds the permissions that are
+// both granted to their role and among the token's scopes.
+func (a *Authorizer) scope(user *models.User, permission string) string {
+	if user == nil {
+		return ""
+	}
+	if user.Scopes != nil && !slices.Contains(user.Scopes, permission) {
+		return ""
+	}
+	scope, err := a.roles.Scope(user.Role, permission)
+	if err != nil {
+		log.Printf("Failed to check permission %s for user %d: %v", permission, user.ID, err)
+		return ""
+	}
+	return scope
+}
+
+// Roles lists every role with its user count
+func (a *Authorizer) Roles() ([]*models.Role, error) {
+	return a.roles.List()
+}
+
+// RoleNames lists the roles that can be assigned to users
+func (a *Authorizer) RoleNames() ([]string, error) {
+	roles, err := a.roles.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	return names, nil
+}
+
+// Permissions lists every permission a role can be granted
+func (a *Authorizer) Permissions() ([]*models.Permission, error) {
+	return a.roles.Permissions()
+}
+
+// Grants returns every role's grants as role → permission → scope
+func (a *Authorizer) Grants() (map[string]map[string]string, error) {
+	return a.roles.Grants()
+}
+
+// SetRolePermissions replaces role's grants (permission → scope). It refuses
+// unknown permissions, ScopeOwn on permissions that are not ownable, and
+// changes that would leave the caller unable to manage roles.
+func (a *Authorizer) SetRolePermissions(caller *models.User, role string, grants map[string]string) error {
+	perms, err := a.roles.Permissions()
+	if err != nil {
+		return err
+	}
+	ownable := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		ownable[p.Name] = p.Ownable
+	}
+	for permission, scope := range grants {
+		canOwn, known := ownable[permission]
+		if !known || (scope != models.ScopeAll && (scope != models.ScopeOwn || !canOwn)) {
+			return fmt.Errorf("%w: %s=%s", ErrInvalidGrant, permission, scope)
+		}
+	}
+	if role == caller.Role && grants[models.PermRolesManage] != models.ScopeAll {
+		return ErrRoleLockout
+	}
+
+	if err := a.roles.SetGrants(role, grants); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] role permissions changed: role=%s grants=%v by=%d", role, grants, caller.ID)
+	return nil
+}
+
+// CreateRole adds a role without permissions
+func (a *Authorizer) CreateRole(caller *models.User, name, description string) error {
+	if !roleNamePattern.MatchString(name) {
+		return ErrInvalidRoleName
+	}
+	if err := a.roles.Create(name, description); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] role created: role=%s by=%d", name, caller.ID)
+	return nil
+}
+
+// DeleteRole removes a role that is not built in and has no users.
+// Returns models.ErrRoleInUse or models.ErrNotFound otherwise.
+func (a *Authorizer) DeleteRole(caller *models.User, name string) error {
+	if err := a.roles.Delete(name); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] role deleted: role=%s by=%d", name, caller.ID)
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// breachedFalsePositiveRate is the share of unbreached passwords the filter
+// wrongly reports as breached. At 0.1% the filter takes about 1.8 bytes per entry.
+const breachedFalsePositiveRate = 0.001
+
+// BreachedPasswords is a bloom filter over the SHA-1 hashes of passwords known
+// from data breaches. It can report a password as breached that is not (rarely,
+// see breachedFalsePositiveRate) but never misses one that is in the list.
+type BreachedPasswords struct {
+	bits  []uint64
+	m     uint64 // number of bits
+	k     int    // hash functions per entry
+	Count int    // entries loaded
+}
+
+// LoadBreachedPasswords builds the filter from a file with one entry per line,
+// either a SHA-1 hash in hex as in the Have I Been Pwned downloads ("HASH:COUNT",
+// the count is ignored) or a plaintext password. Blank lines and lines starting
+// with # are skipped. The file is read twice, once to size the filter and once
+// to fill it, so memory use is the filter alone however long the list is.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	n := 0
+	if err := eachBreachedEntry(f, func(string) { n++ }); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind breached password list: %w", err)
+	}
+
+	b := newBreachedPasswords(n)
+	if err := eachBreachedEntry(f, func(entry string) { b.add(breachedHash(entry)) }); err != nil {
+		return nil, err
+	}
+	if b.Count != n {
+		return nil, fmt.Errorf("breached password list changed while loading (%d entries, then %d)", n, b.Count)
+	}
+	return b, nil
+}
+
+// eachBreachedEntry calls fn with every entry in r, skipping blank and comment lines
+func eachBreachedEntry(r io.Reader, fn func(entry string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry := strings.TrimRight(scanner.Text(), "\r")
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		fn(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return nil
+}
+
+// breachedHash returns the SHA-1 an entry stands for: the entry itself when it
+// is a hex hash, otherwise the hash of the plaintext password
+func breachedHash(entry string) [sha1.Size]byte {
+	var sum [sha1.Size]byte
+	hexHash, _, _ := strings.Cut(entry, ":")
+	if len(hexHash) == 2*sha1.Size {
+		if _, err := hex.Decode(sum[:], []byte(hexHash)); err == nil {
+			return sum
+		}
+	}
+	return sha1.Sum([]byte(entry))
+}
+
+// newBreachedPasswords sizes an empty filter for n entries
+func newBreachedPasswords(n int) *BreachedPasswords {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(breachedFalsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BreachedPasswords{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// Contains reports whether password is (probably) in the list
+func (b *BreachedPasswords) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	h1, h2 := b.hashes(sum)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add inserts a SHA-1 hash into the filter
+func (b *BreachedPasswords) add(sum [sha1.Size]byte) {
+	h1, h2 := b.hashes(sum)
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+	b.Count++
+}
+
+// hashes derives the two base hashes for double hashing from the SHA-1,
+// which is already uniformly distributed
+func (b *BreachedPasswords) hashes(sum [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(sum[0:8]), binary.BigEndian.Uint64(sum[8:16]) | 1
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	hashed := sha1.Sum([]byte("hunter2"))
+	list := strings.Join([]string{
+		"# comment",
+		"",
+		strings.ToUpper(hex.EncodeToString(hashed[:])) + ":1234",
+		"password123\r",
+		"letmein",
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords: %v", err)
+	}
+	if b.Count != 3 {
+		t.Errorf("Count = %d, want 3", b.Count)
+	}
+	for _, pw := range []string{"hunter2", "password123", "letmein"} {
+		if !b.Contains(pw) {
+			t.Errorf("Contains(%q) = false, want true", pw)
+		}
+	}
+	if b.Contains("correct horse battery staple") {
+		t.Error("Contains reported an unlisted password")
+	}
+}
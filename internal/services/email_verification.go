@@ -0,0 +1,183 @@
+package services
+
+import (
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"secure-ui-showcase-go/internal/mail"
+	"secure-ui-showcase-go/internal/models"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	// verifyKeyInfo domain-separates the link signing key from other uses of EMAIL_VERIFICATION_KEY
+	verifyKeyInfo = "secure-ui email verification v1"
+)
+
+var (
+	// ErrEmailNotVerified is returned by Login for a pending account with the right password
+	ErrEmailNotVerified = errors.New("email address not verified")
+	// ErrVerificationInvalid is returned for a malformed, forged or expired verification link
+	ErrVerificationInvalid = errors.New("verification link is invalid or has expired")
+)
+
+// SetEmailVerification makes new accounts start as pending until the emailed
+// link is opened. Links are HMAC-signed with a key derived from key, so they
+// need no storage; they bind the user ID, email address and expiry time.
+// It needs SetMailer.
+func (s *AuthService) SetEmailVerification(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("email verification key required")
+	}
+	derived, err := hkdf.Key(sha256.New, key, nil, verifyKeyInfo, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive email verification key: %w", err)
+	}
+	s.verifyKey = derived
+	return nil
+}
+
+// EmailVerificationRequired reports whether new accounts must verify their email
+func (s *AuthService) EmailVerificationRequired() bool {
+	return s.verifyKey != nil && s.mailer != nil
+}
+
+// ResendVerification emails a new link if email belongs to a pending account.
+// Like RequestPasswordReset it returns nil whether or not it sent anything.
+func (s *AuthService) ResendVerification(email, ip string) error {
+	if !s.EmailVerificationRequired() {
+		return nil
+	}
+	user, err := s.UserDB.GetByEmail(email)
+	if errors.Is(err, models.ErrNotFound) {
+		log.Printf("Verification resend for unknown email: email=%s ip=%s", email, ip)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Status != "pending" {
+		return nil
+	}
+	s.sendVerification(user)
+	log.Printf("Verification email resent: id=%d ip=%s", user.ID, ip)
+	return nil
+}
+
+// CheckEmailVerificationToken reports whether a verification link is valid
+// without acting on it
+func (s *AuthService) CheckEmailVerificationToken(token string) error {
+	_, err := s.verificationUser(token)
+	return err
+}
+
+// VerifyEmail activates the pending account a verification link was sent to.
+// Opening a link for an account that is already active succeeds; links for
+// disabled accounts are refused so they cannot re-enable themselves.
+func (s *AuthService) VerifyEmail(token string) error {
+	user, err := s.verificationUser(token)
+	if err != nil {
+		return err
+	}
+	switch user.Status {
+	case "active":
+		return nil
+	case "pending":
+	default:
+		return ErrVerificationInvalid
+	}
+
+	if err := s.UserDB.UpdateStatus(user.ID, "pending", "active"); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return ErrVerificationInvalid
+		}
+		return err
+	}
+	log.Printf("Email verified: id=%d email=%s", user.ID, user.Email)
+	return nil
+}
+
+// ForceVerifyEmail lets a user with users.verify activate a pending account
+// without the email link
+func (s *AuthService) ForceVerifyEmail(by *models.User, userID int) error {
+	if err := s.UserDB.UpdateStatus(userID, "pending", "active"); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] email verification skipped: id=%d by=%d", userID, by.ID)
+	return nil
+}
+
+// sendVerification emails user a fresh verification link in the background
+func (s *AuthService) sendVerification(user *models.User) {
+	token := s.verificationToken(user.ID, user.Email, time.Now().Add(emailVerificationTTL))
+	link := s.baseURL + "/verify-email?token=" + token
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your Secure-UI email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Thanks for signing up to Secure-UI. Open this link within %d hours to confirm your email address "+
+			"and finish setting up your account:\n\n"+
+			"%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n",
+			user.FirstName, int(emailVerificationTTL/time.Hour), link),
+	}
+	go s.sendMail(msg, user.ID)
+}
+
+// verificationToken signs "<user id>.<expiry>" with the user's current email,
+// so changing the address invalidates links sent to the old one
+func (s *AuthService) verificationToken(userID int, email string, expiresAt time.Time) string {
+	payload := strconv.Itoa(userID) + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.verificationMAC(payload, email))
+}
+
+func (s *AuthService) verificationMAC(payload, email string) []byte {
+	mac := hmac.New(sha256.New, s.verifyKey)
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(email)))
+	return mac.Sum(nil)
+}
+
+// verificationUser checks a link's signature and expiry and returns its user
+func (s *AuthService) verificationUser(token string) (*models.User, error) {
+	if s.verifyKey == nil {
+		return nil, ErrVerificationInvalid
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrVerificationInvalid
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil || userID <= 0 {
+		return nil, ErrVerificationInvalid
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return nil, ErrVerificationInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrVerificationInvalid
+	}
+
+	user, err := s.UserDB.GetByID(userID)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, ErrVerificationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, s.verificationMAC(parts[0]+"."+parts[1], user.Email)) {
+		return nil, ErrVerificationInvalid
+	}
+	return user, nil
+}
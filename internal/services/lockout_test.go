@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockoutScopes(t *testing.T) {
+	// Each case turns one scope's threshold down to 3 and leaves the others out of reach
+	loose := LockoutPolicy{Threshold: 1000}
+	tight := LockoutPolicy{Threshold: 3}
+
+	type attempt struct{ email, ip string }
+	tests := []struct {
+		name     string
+		lockout  LockoutConfig
+		failures []attempt
+		probe    attempt
+		want     bool // locked
+	}{
+		{
+			name:     "account failures from many subnets lock the account",
+			lockout:  LockoutConfig{Account: tight, IP: loose, Subnet: loose},
+			failures: []attempt{{"victim@example.com", "192.0.2.1"}, {"victim@example.com", "198.51.100.1"}, {"victim@example.com", "203.0.113.1"}},
+			probe:    attempt{"victim@example.com", "10.9.8.7"},
+			want:     true,
+		},
+		{
+			name:     "account lock leaves other accounts alone",
+			lockout:  LockoutConfig{Account: tight, IP: loose, Subnet: loose},
+			failures: []attempt{{"victim@example.com", "192.0.2.1"}, {"victim@example.com", "198.51.100.1"}, {"victim@example.com", "203.0.113.1"}},
+			probe:    attempt{"other@example.com", "192.0.2.1"},
+		},
+		{
+			name:     "ip failures across accounts lock the ip",
+			lockout:  LockoutConfig{Account: loose, IP: tight, Subnet: loose},
+			failures: []attempt{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.1"}, {"c@example.com", "192.0.2.1"}},
+			probe:    attempt{"d@example.com", "192.0.2.1"},
+			want:     true,
+		},
+		{
+			name:     "ip lock leaves the neighbour alone",
+			lockout:  LockoutConfig{Account: loose, IP: tight, Subnet: loose},
+			failures: []attempt{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.1"}, {"c@example.com", "192.0.2.1"}},
+			probe:    attempt{"d@example.com", "192.0.2.2"},
+		},
+		{
+			name:     "failures across an ipv4 /24 lock the /24",
+			lockout:  LockoutConfig{Account: loose, IP: loose, Subnet: tight},
+			failures: []attempt{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.50"}, {"c@example.com", "192.0.2.99"}},
+			probe:    attempt{"d@example.com", "192.0.2.200"},
+			want:     true,
+		},
+		{
+			name:     "ipv4 subnet lock stops at the /24",
+			lockout:  LockoutConfig{Account: loose, IP: loose, Subnet: tight},
+			failures: []attempt{{"a@example.com", "192.0.2.1"}, {"b@example.com", "192.0.2.50"}, {"c@example.com", "192.0.2.99"}},
+			probe:    attempt{"d@example.com", "192.0.3.1"},
+		},
+		{
+			name:     "failures across an ipv6 /48 lock the /48",
+			lockout:  LockoutConfig{Account: loose, IP: loose, Subnet: tight},
+			failures: []attempt{{"a@example.com", "2001:db8:1:a::1"}, {"b@example.com", "2001:db8:1:b::1"}, {"c@example.com", "2001:db8:1:c::1"}},
+			probe:    attempt{"d@example.com", "2001:db8:1:ffff::1"},
+			want:     true,
+		},
+		{
+			name:     "ipv6 subnet lock stops at the /48",
+			lockout:  LockoutConfig{Account: loose, IP: loose, Subnet: tight},
+			failures: []attempt{{"a@example.com", "2001:db8:1:a::1"}, {"b@example.com", "2001:db8:1:b::1"}, {"c@example.com", "2001:db8:1:c::1"}},
+			probe:    attempt{"d@example.com", "2001:db8:2::1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestAuthServiceWithLockout(t, tt.lockout)
+			for _, a := range tt.failures {
+				if _, err := s.Login(a.email, "wrong password", a.ip, "test"); !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Login(%s, %s) err = %v, want %v", a.email, a.ip, err, ErrInvalidCredentials)
+				}
+			}
+
+			_, err := s.Login(tt.probe.email, "wrong password", tt.probe.ip, "test")
+			var lockout *LockoutError
+			if locked := errors.As(err, &lockout); locked != tt.want {
+				t.Fatalf("probe err = %v, want locked %t", err, tt.want)
+			}
+			if tt.want && lockout.RetryAfter <= 0 {
+				t.Errorf("RetryAfter = %v, want positive", lockout.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	p := LockoutPolicy{Threshold: 3, Window: time.Hour, BaseLock: time.Minute, MaxLock: time.Hour}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{8, 32 * time.Minute},
+		{9, time.Hour}, // 64 minutes, capped
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.lockFor(tt.failures); got != tt.want {
+			t.Errorf("lockFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutSubnetRecorded(t *testing.T) {
+	s, db := newTestAuthService(t)
+	if _, err := s.Login("a@example.com", "wrong password", "192.0.2.77", "test"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login err = %v", err)
+	}
+	var bucket string
+	if err := db.QueryRow("SELECT ip_bucket FROM login_attempts").Scan(&bucket); err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "192.0.2.0/24" {
+		t.Errorf("ip_bucket = %q, want 192.0.2.0/24", bucket)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"secure-ui-showcase-go/internal/mail"
+	"secure-ui-showcase-go/internal/models"
+)
+
+// magicLinkTTL is how long an emailed sign-in link works
+const magicLinkTTL = 15 * time.Minute
+
+// ErrMagicLinkInvalid is returned for a sign-in link that is unknown, expired,
+// already used or opened in a browser other than the one that asked for it
+var ErrMagicLinkInvalid = errors.New("sign-in link is invalid or has expired")
+
+// SetMagicLinks enables passwordless sign-in by emailed link. It needs SetMailer.
+func (s *AuthService) SetMagicLinks(db *models.MagicLinkDatabase) {
+	s.MagicLinkDB = db
+}
+
+// MagicLinksAvailable reports whether sign-in links can be sent
+func (s *AuthService) MagicLinksAvailable() bool {
+	return s.MagicLinkDB != nil && s.mailer != nil
+}
+
+// RequestMagicLink emails a sign-in link if email belongs to an active account.
+// It returns a nonce the caller must keep in the requesting browser's cookie
+// for LoginWithMagicLink, so a forwarded email cannot sign in anywhere else.
+// Like RequestPasswordReset, the result and its timing are the same whether
+// or not the account exists; only a lockout is reported, as Login would.
+func (s *AuthService) RequestMagicLink(email, ip, userAgent string) (nonce string, err error) {
+	if !s.MagicLinksAvailable() {
+		return "", errors.New("magic link sign-in is not configured")
+	}
+	if s.clientAccess.Denied(ip) {
+		log.Printf("[SECURITY] magic link request from denylisted client: email=%s ip=%s bucket=%s ua=%.200s",
+			email, ip, s.clientBuckets.Key(ip), userAgent)
+		return "", ErrClientDenied
+	}
+	remaining, err := s.lockoutRemaining(email, ip)
+	if err != nil {
+		return "", fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked magic link request: email=%s ip=%s", email, ip)
+		return "", &LockoutError{RetryAfter: remaining}
+	}
+
+	// The nonce is issued before the lookup so unknown emails get one too
+	if nonce, err = models.GenerateSessionToken(); err != nil {
+		return "", err
+	}
+
+	user, err := s.UserDB.GetByEmail(email)
+	if errors.Is(err, models.ErrNotFound) {
+		log.Printf("Magic link requested for unknown email: email=%s ip=%s", email, ip)
+		return nonce, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Status != "active" {
+		log.Printf("Magic link requested for inactive account: id=%d ip=%s", user.ID, ip)
+		return nonce, nil
+	}
+
+	token, err := models.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.MagicLinkDB.Create(user.ID, models.HashToken(token), models.HashToken(nonce), time.Now().Add(magicLinkTTL)); err != nil {
+		return "", err
+	}
+
+	link := s.baseURL + "/login/magic-link/verify?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Your Secure-UI sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to sign in to your Secure-UI account without a password. "+
+			"If it was you, open this link within %d minutes, in the same browser you asked from:\n\n"+
+			"%s\n\n"+
+			"The link works once. If you didn't ask for this, you can ignore this email; "+
+			"nobody can use the link from another browser.\n",
+			user.FirstName, int(magicLinkTTL/time.Minute), link),
+	}
+	go s.sendMail(msg, user.ID)
+
+	log.Printf("Magic link requested: id=%d ip=%s", user.ID, ip)
+	return nonce, nil
+}
+
+// LoginWithMagicLink signs in with an emailed link. nonce is the one
+// RequestMagicLink returned to the browser. The same lockout applies as for
+// Login, and every failure is recorded against the link's account and the
+// client. Users with two-factor authentication get an MFA challenge token
+// instead of a session.
+func (s *AuthService) LoginWithMagicLink(token, nonce, ip, userAgent string) (LoginResult, error) {
+	if s.MagicLinkDB == nil || token == "" {
+		return LoginResult{}, ErrMagicLinkInvalid
+	}
+	if s.clientAccess.Denied(ip) {
+		log.Printf("[SECURITY] magic link login from denylisted client: ip=%s bucket=%s ua=%.200s",
+			ip, s.clientBuckets.Key(ip), userAgent)
+		return LoginResult{}, ErrClientDenied
+	}
+
+	// The link's account, if it still has one, is needed for the lockout check
+	tokenHash := models.HashToken(token)
+	userID, err := s.MagicLinkDB.Lookup(tokenHash)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	var user *models.User
+	if userID != 0 {
+		user, err = s.UserDB.GetByID(userID)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return LoginResult{}, err
+		}
+	}
+	var email string
+	if user != nil {
+		email = user.Email
+	}
+
+	remaining, err := s.lockoutRemaining(email, ip)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked magic link login attempt: email=%s ip=%s", email, ip)
+		return LoginResult{}, &LockoutError{RetryAfter: remaining}
+	}
+
+	fail := func(reason string) (LoginResult, error) {
+		log.Printf("[SECURITY] magic link login rejected: email=%s ip=%s reason=%s", email, ip, reason)
+		s.recordFailedAttempt(email, ip, userAgent)
+		return LoginResult{}, ErrMagicLinkInvalid
+	}
+
+	if user == nil {
+		return fail("unknown or expired link")
+	}
+	if nonce == "" {
+		return fail("no browser nonce")
+	}
+	consumed, err := s.MagicLinkDB.Consume(tokenHash, models.HashToken(nonce))
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if consumed == 0 {
+		return fail("opened in another browser or already used")
+	}
+	if user.Status != "active" {
+		return fail("inactive account")
+	}
+
+	needMFA, err := s.requiresMFA(user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if needMFA {
+		token, err := s.startMFAChallenge(user.ID)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		log.Printf("Magic link accepted, second factor required: id=%d ip=%s", user.ID, ip)
+		return LoginResult{MFAToken: token}, nil
+	}
+
+	sessionToken, err := s.createSession(user, ip, userAgent)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{SessionToken: sessionToken}, nil
+}
+
+// cleanupMagicLinks removes expired sign-in links
+func (s *AuthService) cleanupMagicLinks() {
+	if s.MagicLinkDB == nil {
+		return
+	}
+	if _, err := s.MagicLinkDB.DeleteExpired(); err != nil {
+		log.Printf("Failed to cleanup expired magic links: %v", err)
+	}
+}
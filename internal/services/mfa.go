@@ -0,0 +1,432 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"secure-ui-showcase-go/internal/models"
+)
+
+const (
+	// RFC 6238 parameters understood by every authenticator app
+	totpPeriod      = 30 * time.Second
+	totpDigits      = 6
+	totpModulus     = 1_000_000 // 10^totpDigits
+	totpSkew        = 1         // steps accepted either side of now, for clock drift
+	totpSecretBytes = 20
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10 // 80 bits, shown as 16 base32 characters
+
+	mfaIssuer       = "Secure-UI"
+	mfaChallengeTTL = 5 * time.Minute
+	maxMFAAttempts  = 5
+
+	// mfaKeyInfo domain-separates the secret encryption key from other uses of MFA_ENCRYPTION_KEY
+	mfaKeyInfo = "secure-ui totp secret encryption v1"
+)
+
+var (
+	// ErrMFAUnavailable is returned when two-factor authentication is not configured
+	ErrMFAUnavailable = errors.New("two-factor authentication is not configured")
+	// ErrInvalidMFACode is returned for a wrong, reused or malformed second-factor code
+	ErrInvalidMFACode = errors.New("invalid authentication code")
+	// ErrMFAChallengeExpired is returned when a pending second-factor login is missing,
+	// expired or out of attempts; the user must sign in with their password again
+	ErrMFAChallengeExpired = errors.New("sign-in expired")
+)
+
+// totpEncoding is the unpadded base32 alphabet authenticator apps expect
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoginResult is the outcome of a successful password check.
+// Exactly one field is set: the session token when the login is complete,
+// or a second-factor challenge token to pass to VerifyMFA.
+type LoginResult struct {
+	SessionToken string
+	MFAToken     string
+}
+
+// TOTPEnrollment is shown to the user while they add the secret to an authenticator app
+type TOTPEnrollment struct {
+	Secret string // base32, for manual entry
+	URI    string // otpauth:// URI, for QR codes and mobile deep links
+}
+
+// MFAStatus describes a user's second factor for the profile page
+type MFAStatus struct {
+	Available         bool            // MFA is configured on this server
+	Enabled           bool            // enrolment confirmed; required at login
+	Pending           *TOTPEnrollment // enrolment started but not yet confirmed
+	RecoveryCodesLeft int
+}
+
+// SetMFA enables TOTP two-factor authentication. The secrets in db are
+// encrypted with AES-256-GCM under a key derived from encryptionKey.
+func (s *AuthService) SetMFA(db *models.MFADatabase, encryptionKey []byte) error {
+	if len(encryptionKey) == 0 {
+		return errors.New("mfa encryption key required")
+	}
+	key, err := hkdf.Key(sha256.New, encryptionKey, nil, mfaKeyInfo, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive mfa key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create mfa cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create mfa cipher: %w", err)
+	}
+	s.MFADB = db
+	s.mfaAEAD = aead
+	return nil
+}
+
+// MFAStatus returns the user's second-factor state
+func (s *AuthService) MFAStatus(user *models.User) (MFAStatus, error) {
+	if s.MFADB == nil {
+		return MFAStatus{}, nil
+	}
+	status := MFAStatus{Available: true}
+	m, err := s.MFADB.Get(user.ID)
+	if err != nil || m == nil {
+		return status, err
+	}
+
+	if !m.Enabled {
+		secret, err := s.openSecret(m)
+		if err != nil {
+			return status, err
+		}
+		status.Pending = newTOTPEnrollment(user.Email, secret)
+		return status, nil
+	}
+
+	status.Enabled = true
+	status.RecoveryCodesLeft, err = s.MFADB.CountRecoveryCodes(user.ID)
+	return status, err
+}
+
+// BeginTOTPEnrollment generates a new secret for the user. It is not required
+// at login until ConfirmTOTPEnrollment accepts a code generated from it.
+func (s *AuthService) BeginTOTPEnrollment(user *models.User) (*TOTPEnrollment, error) {
+	if s.MFADB == nil {
+		return nil, ErrMFAUnavailable
+	}
+	secret := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	sealed, err := s.sealSecret(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFADB.SavePending(user.ID, sealed); err != nil {
+		return nil, err
+	}
+
+	log.Printf("TOTP enrolment started: user=%d", user.ID)
+	return newTOTPEnrollment(user.Email, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables the user's pending secret once code matches it
+// and returns a fresh set of one-time recovery codes, which are only stored hashed
+func (s *AuthService) ConfirmTOTPEnrollment(userID int, code string) ([]string, error) {
+	if s.MFADB == nil {
+		return nil, ErrMFAUnavailable
+	}
+	m, err := s.MFADB.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || m.Enabled {
+		return nil, ErrInvalidMFACode
+	}
+	secret, err := s.openSecret(m)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), m.LastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFADB.Enable(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[SECURITY] TOTP enabled: user=%d", userID)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after re-checking their password
+func (s *AuthService) RegenerateRecoveryCodes(userID int, password string) ([]string, error) {
+	if s.MFADB == nil {
+		return nil, ErrMFAUnavailable
+	}
+	if err := s.checkPassword(userID, password); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.MFADB.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[SECURITY] TOTP recovery codes regenerated: user=%d", userID)
+	return codes, nil
+}
+
+// DisableTOTP removes the user's second factor after re-checking their password
+func (s *AuthService) DisableTOTP(userID int, password string) error {
+	if s.MFADB == nil {
+		return ErrMFAUnavailable
+	}
+	if err := s.checkPassword(userID, password); err != nil {
+		return err
+	}
+	if err := s.MFADB.Delete(userID); err != nil {
+		return err
+	}
+
+	log.Printf("[SECURITY] TOTP disabled: user=%d", userID)
+	return nil
+}
+
+// VerifyMFA completes a login that is waiting for a second factor.
+// code is a current TOTP code or an unused recovery code. Wrong codes count
+// towards lockout like wrong passwords, and a challenge is discarded after
+// maxMFAAttempts failures.
+func (s *AuthService) VerifyMFA(challengeToken, code, ip, userAgent string) (string, error) {
+	if s.MFADB == nil || challengeToken == "" {
+		return "", ErrMFAChallengeExpired
+	}
+	hash := models.HashToken(challengeToken)
+	c, err := s.MFADB.GetChallenge(hash)
+	if err != nil {
+		return "", err
+	}
+	if c == nil {
+		return "", ErrMFAChallengeExpired
+	}
+	user, err := s.UserDB.GetByID(c.UserID)
+	if err != nil || user.Status != "active" {
+		_, _ = s.MFADB.DeleteChallenge(hash)
+		return "", ErrMFAChallengeExpired
+	}
+
+	remaining, err := s.lockoutRemaining(user.Email, ip)
+	if err != nil {
+		return "", fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked second-factor attempt: user=%d ip=%s", user.ID, ip)
+		return "", &LockoutError{RetryAfter: remaining}
+	}
+
+	ok, err := s.checkSecondFactor(user.ID, code)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		s.recordFailedAttempt(user.Email, ip, userAgent)
+		usable, err := s.MFADB.FailChallenge(hash, maxMFAAttempts)
+		if err != nil {
+			return "", err
+		}
+		if !usable {
+			log.Printf("[SECURITY] second-factor challenge exhausted: user=%d ip=%s", user.ID, ip)
+			return "", ErrMFAChallengeExpired
+		}
+		return "", ErrInvalidMFACode
+	}
+
+	// Deleting the challenge is the commit point: concurrent submissions of
+	// one challenge cannot both get a session
+	if deleted, err := s.MFADB.DeleteChallenge(hash); err != nil || !deleted {
+		return "", ErrMFAChallengeExpired
+	}
+	return s.createSession(user, ip, userAgent)
+}
+
+// requiresMFA reports whether the user must complete a second factor at login
+func (s *AuthService) requiresMFA(userID int) (bool, error) {
+	if s.MFADB == nil {
+		return false, nil
+	}
+	m, err := s.MFADB.Get(userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check mfa enrolment: %w", err)
+	}
+	return m != nil && m.Enabled, nil
+}
+
+// startMFAChallenge records a pending second-factor login and returns its token
+func (s *AuthService) startMFAChallenge(userID int) (string, error) {
+	token, err := models.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.MFADB.CreateChallenge(&models.MFAChallenge{
+		TokenHash: models.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkSecondFactor checks a six-digit TOTP code, or otherwise a recovery code.
+// Both are single use: the TOTP step is recorded and the recovery code deleted.
+func (s *AuthService) checkSecondFactor(userID int, code string) (bool, error) {
+	code = normalizeMFACode(code)
+	if len(code) != totpDigits {
+		ok, err := s.MFADB.ConsumeRecoveryCode(userID, models.HashToken(code))
+		if ok {
+			log.Printf("[SECURITY] recovery code used: user=%d", userID)
+		}
+		return ok, err
+	}
+
+	m, err := s.MFADB.Get(userID)
+	if err != nil || m == nil || !m.Enabled {
+		return false, err
+	}
+	secret, err := s.openSecret(m)
+	if err != nil {
+		return false, err
+	}
+	step, ok := matchTOTP(secret, code, time.Now(), m.LastStep)
+	if !ok {
+		return false, nil
+	}
+	return s.MFADB.UseStep(userID, step)
+}
+
+// checkPassword re-verifies a signed-in user's password before a sensitive change
+func (s *AuthService) checkPassword(userID int, password string) error {
+	user, err := s.UserDB.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if !s.VerifyPassword(user.PasswordHash, password) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// sealSecret encrypts a TOTP secret; the user ID is bound as additional data
+// so a ciphertext copied to another account does not decrypt
+func (s *AuthService) sealSecret(userID int, secret []byte) ([]byte, error) {
+	nonce := make([]byte, s.mfaAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return s.mfaAEAD.Seal(nonce, nonce, secret, mfaAdditionalData(userID)), nil
+}
+
+// openSecret decrypts a stored TOTP secret
+func (s *AuthService) openSecret(m *models.UserMFA) ([]byte, error) {
+	n := s.mfaAEAD.NonceSize()
+	if len(m.Secret) < n {
+		return nil, errors.New("stored totp secret is truncated")
+	}
+	secret, err := s.mfaAEAD.Open(nil, m.Secret[:n], m.Secret[n:], mfaAdditionalData(m.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt totp secret (was MFA_ENCRYPTION_KEY changed?): %w", err)
+	}
+	return secret, nil
+}
+
+// mfaAdditionalData is the GCM additional data binding a secret to its user
+func mfaAdditionalData(userID int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// newTOTPEnrollment builds the manual-entry secret and otpauth URI for a secret
+func newTOTPEnrollment(email string, secret []byte) *TOTPEnrollment {
+	encoded := totpEncoding.EncodeToString(secret)
+	q := url.Values{}
+	q.Set("secret", encoded)
+	q.Set("issuer", mfaIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+	label := url.PathEscape(mfaIssuer + ":" + email)
+	return &TOTPEnrollment{
+		Secret: encoded,
+		URI:    "otpauth://totp/" + label + "?" + q.Encode(),
+	}
+}
+
+// totpCode computes the RFC 6238 code for a time step (HOTP, RFC 4226, over the step counter)
+func totpCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(step)))
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulus)
+}
+
+// matchTOTP checks code against the steps around now, skipping any step at or
+// before lastStep. Returns the matching step.
+func matchTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = normalizeMFACode(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns new recovery codes for display and their hashes for storage
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCodeCount {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:12]+"-"+code[12:])
+		hashes = append(hashes, models.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeMFACode strips the separators users type or paste into codes
+func normalizeMFACode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/oidc"
+	"secure-ui-showcase-go/internal/validation"
+)
+
+const (
+	// oidcLoginTTL is how long the user has to finish signing in at the provider
+	oidcLoginTTL = 10 * time.Minute
+	// maxOIDCNameLength matches the name limits of the user forms
+	maxOIDCNameLength = 50
+)
+
+var (
+	// ErrOIDCUnavailable is returned when single sign-on is not configured
+	ErrOIDCUnavailable = errors.New("single sign-on is not configured")
+	// ErrOIDCRejected is returned for any failed single sign-on; the detailed
+	// reason is logged, not returned
+	ErrOIDCRejected = errors.New("single sign-on failed")
+)
+
+// SetOIDC enables sign-in through an OpenID provider. name labels the
+// sign-in button (e.g. "Company SSO").
+func (s *AuthService) SetOIDC(provider *oidc.Provider, name string, db *models.OIDCDatabase) {
+	s.oidc = provider
+	s.oidcName = name
+	s.OIDCDB = db
+}
+
+// OIDCAvailable reports whether SetOIDC has been called
+func (s *AuthService) OIDCAvailable() bool {
+	return s.OIDCDB != nil
+}
+
+// OIDCProviderName returns the name shown on the sign-in button
+func (s *AuthService) OIDCProviderName() string {
+	return s.oidcName
+}
+
+// BeginOIDCLogin starts a sign-in at the provider. It returns the URL to send
+// the browser to and the state, which the caller must keep in a cookie for
+// FinishOIDCLogin so the callback can only finish a sign-in this browser began.
+func (s *AuthService) BeginOIDCLogin(ctx context.Context) (authURL, state string, err error) {
+	if s.OIDCDB == nil {
+		return "", "", ErrOIDCUnavailable
+	}
+	var nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		if *v, err = oidc.NewVerifier(); err != nil {
+			return "", "", err
+		}
+	}
+	if authURL, err = s.oidc.AuthCodeURL(ctx, state, nonce, verifier); err != nil {
+		return "", "", err
+	}
+	if err := s.OIDCDB.CreateLoginState(models.HashToken(state), nonce, verifier, time.Now().Add(oidcLoginTTL)); err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// FinishOIDCLogin completes a sign-in when the provider redirects back.
+// browserState is the state kept by the browser since BeginOIDCLogin and
+// returnedState the one in the callback URL; they must match. The account is
+// found by the provider's subject, or else linked by verified email address
+// to an existing user or a new one. Users with two-factor authentication get
+// an MFA challenge token instead of a session.
+func (s *AuthService) FinishOIDCLogin(ctx context.Context, browserState, returnedState, code, ip, userAgent string) (LoginResult, error) {
+	if s.OIDCDB == nil {
+		return LoginResult{}, ErrOIDCUnavailable
+	}
+	if s.clientAccess.Denied(ip) {
+		log.Printf("[SECURITY] oidc login from denylisted client: ip=%s bucket=%s ua=%.200s",
+			ip, s.clientBuckets.Key(ip), userAgent)
+		return LoginResult{}, ErrClientDenied
+	}
+	remaining, err := s.lockoutRemaining("", ip)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked oidc login attempt: ip=%s", ip)
+		return LoginResult{}, &LockoutError{RetryAfter: remaining}
+	}
+
+	fail := func(reason string, args ...any) (LoginResult, error) {
+		log.Printf("[SECURITY] oidc login rejected: ip=%s "+reason, append([]any{ip}, args...)...)
+		s.recordFailedAttempt("", ip, userAgent)
+		return LoginResult{}, ErrOIDCRejected
+	}
+
+	if returnedState == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(returnedState)) != 1 {
+		return fail("state does not match this browser")
+	}
+	nonce, verifier, err := s.OIDCDB.ConsumeLoginState(models.HashToken(returnedState))
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if verifier == "" {
+		return fail("unknown or expired state")
+	}
+
+	claims, err := s.oidc.Exchange(ctx, code, verifier, nonce)
+	if errors.Is(err, oidc.ErrDiscovery) {
+		// The provider is unreachable or misconfigured; not the user's fault
+		return LoginResult{}, err
+	}
+	if err != nil {
+		return fail("err=%v", err)
+	}
+
+	user, err := s.oidcUser(claims)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if user == nil {
+		return fail("no account for sub=%s email=%s verified=%t", claims.Subject, claims.Email, bool(claims.EmailVerified))
+	}
+	if user.Status != "active" {
+		return fail("inactive user=%d", user.ID)
+	}
+
+	needMFA, err := s.requiresMFA(user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if needMFA {
+		token, err := s.startMFAChallenge(user.ID)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		log.Printf("OIDC sign-in accepted, second factor required: id=%d ip=%s", user.ID, ip)
+		return LoginResult{MFAToken: token}, nil
+	}
+
+	token, err := s.createSession(user, ip, userAgent)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{SessionToken: token}, nil
+}
+
+// oidcUser returns the user for verified ID token claims, linking the
+// provider account on first sign-in. A user already linked is found by
+// issuer and subject alone, since the email address at the provider may
+// change. Otherwise the provider must vouch for the email address: it is
+// linked to the user with that address, activating an account still pending
+// email verification, or to a new account. Returns nil, nil when the claims
+// cannot be linked.
+func (s *AuthService) oidcUser(claims *oidc.Claims) (*models.User, error) {
+	email := validation.Sanitize(claims.Email)
+
+	identity, err := s.OIDCDB.GetIdentity(claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.UserDB.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.OIDCDB.TouchIdentity(identity.ID, email); err != nil {
+			log.Printf("Failed to record oidc sign-in: identity=%d err=%v", identity.ID, err)
+		}
+		return user, nil
+	}
+
+	if email == "" || !claims.EmailVerified {
+		return nil, nil
+	}
+	user, err := s.UserDB.GetByEmail(email)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		first, last := oidcNames(claims)
+		user, err = s.UserDB.Create(&models.User{
+			FirstName: first,
+			LastName:  last,
+			Email:     email,
+			Role:      "user",
+			Status:    "active",
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[SECURITY] account created from oidc identity: user=%d iss=%s sub=%s", user.ID, claims.Issuer, claims.Subject)
+	case err != nil:
+		return nil, err
+	case user.Status == "pending":
+		if err := s.UserDB.UpdateStatus(user.ID, "pending", "active"); err != nil {
+			return nil, err
+		}
+		user.Status = "active"
+		log.Printf("Email verified by oidc provider: id=%d", user.ID)
+	}
+
+	if err := s.OIDCDB.CreateIdentity(&models.UserIdentity{
+		UserID:  user.ID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	}); err != nil {
+		return nil, err
+	}
+	log.Printf("[SECURITY] oidc identity linked: user=%d iss=%s sub=%s", user.ID, claims.Issuer, claims.Subject)
+	return user, nil
+}
+
+// oidcNames returns first and last names for a new account from the
+// claims, falling back to the full name and then the email's local part
+func oidcNames(claims *oidc.Claims) (first, last string) {
+	first = validation.Sanitize(claims.GivenName)
+	last = validation.Sanitize(claims.FamilyName)
+	if first == "" {
+		name := validation.Sanitize(claims.Name)
+		if name == "" {
+			name, _, _ = strings.Cut(claims.Email, "@")
+		}
+		first, last, _ = strings.Cut(name, " ")
+		last = strings.TrimSpace(last)
+	}
+	return truncateRunes(first, maxOIDCNameLength), truncateRunes(last, maxOIDCNameLength)
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// cleanupOIDC removes abandoned sign-ins
+func (s *AuthService) cleanupOIDC() {
+	if s.OIDCDB == nil {
+		return
+	}
+	if _, err := s.OIDCDB.DeleteExpiredLoginStates(); err != nil {
+		log.Printf("Failed to cleanup expired oidc login states: %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"testing"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/oidc"
+	"secure-ui-showcase-go/internal/oidc/oidctest"
+)
+
+// newOIDCService returns a service with MFA available that signs in through
+// a mock issuer
+func newOIDCService(t *testing.T) (*AuthService, *oidctest.Issuer) {
+	t.Helper()
+	s, db := newTestAuthService(t)
+	if err := s.SetMFA(models.NewMFADatabase(db), make([]byte, 32)); err != nil {
+		t.Fatalf("SetMFA: %v", err)
+	}
+	issuer := oidctest.NewIssuer("client", "secret")
+	t.Cleanup(issuer.Close)
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  "https://app.example/login/oidc/callback",
+	}, nil)
+	s.SetOIDC(provider, "Test SSO", models.NewOIDCDatabase(db))
+	return s, issuer
+}
+
+// oidcSignIn is one sign-in started by the service and answered by the issuer
+type oidcSignIn struct {
+	state, code, nonce string
+}
+
+// beginOIDC starts a sign-in and has the issuer answer it with claims
+func beginOIDC(t *testing.T, s *AuthService, issuer *oidctest.Issuer, claims oidctest.Claims) oidcSignIn {
+	t.Helper()
+	authURL, state, err := s.BeginOIDCLogin(context.Background())
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	returned, code, err := issuer.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if returned != state {
+		t.Fatalf("issuer returned state %q, want %q", returned, state)
+	}
+	return oidcSignIn{state: state, code: code, nonce: u.Query().Get("nonce")}
+}
+
+// finish completes si from the browser that began it
+func (si oidcSignIn) finish(s *AuthService) (LoginResult, error) {
+	return s.FinishOIDCLogin(context.Background(), si.state, si.state, si.code, "192.0.2.1", "test")
+}
+
+func verifiedEmail(email string) oidctest.Claims {
+	return oidctest.Claims{"email": email, "email_verified": true, "given_name": "Ada", "family_name": "Lovelace"}
+}
+
+func TestOIDCLoginCreatesAccount(t *testing.T) {
+	s, issuer := newOIDCService(t)
+
+	result, err := beginOIDC(t, s, issuer, verifiedEmail("new@example.com")).finish(s)
+	if err != nil || result.SessionToken == "" {
+		t.Fatalf("FinishOIDCLogin = %+v, %v", result, err)
+	}
+	user, err := s.ValidateSession(result.SessionToken)
+	if err != nil || user == nil || user.Email != "new@example.com" || user.FirstName != "Ada" || user.Role != "user" {
+		t.Fatalf("session user = %+v, %v", user, err)
+	}
+
+	// Later sign-ins find the account by subject, even once the provider
+	// reports another address
+	result, err = beginOIDC(t, s, issuer, verifiedEmail("renamed@example.com")).finish(s)
+	if err != nil {
+		t.Fatalf("second FinishOIDCLogin: %v", err)
+	}
+	again, err := s.ValidateSession(result.SessionToken)
+	if err != nil || again == nil || again.ID != user.ID {
+		t.Fatalf("second session user = %+v, %v; want id %d", again, err, user.ID)
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*oidctest.Issuer)
+		claims oidctest.Claims
+	}{
+		{name: "bad signature", tamper: func(i *oidctest.Issuer) { i.SigningKey = otherKey }, claims: verifiedEmail("a@example.com")},
+		{name: "wrong audience", claims: oidctest.Claims{"aud": "other-client", "email": "a@example.com", "email_verified": true}},
+		{name: "unverified email for a new account", claims: oidctest.Claims{"email": "a@example.com", "email_verified": false}},
+		{name: "no email", claims: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, issuer := newOIDCService(t)
+			if tt.tamper != nil {
+				tt.tamper(issuer)
+			}
+			if _, err := beginOIDC(t, s, issuer, tt.claims).finish(s); !errors.Is(err, ErrOIDCRejected) {
+				t.Errorf("err = %v, want %v", err, ErrOIDCRejected)
+			}
+			if _, err := s.UserDB.GetByEmail("a@example.com"); !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("account created for a rejected sign-in: %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginReusedState(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	si := beginOIDC(t, s, issuer, verifiedEmail("a@example.com"))
+	if _, err := si.finish(s); err != nil {
+		t.Fatalf("first FinishOIDCLogin: %v", err)
+	}
+
+	// The same callback again, and the state with a fresh code
+	if _, err := si.finish(s); !errors.Is(err, ErrOIDCRejected) {
+		t.Errorf("replayed callback err = %v, want %v", err, ErrOIDCRejected)
+	}
+	fresh := beginOIDC(t, s, issuer, verifiedEmail("a@example.com"))
+	fresh.state = si.state
+	if _, err := fresh.finish(s); !errors.Is(err, ErrOIDCRejected) {
+		t.Errorf("reused state err = %v, want %v", err, ErrOIDCRejected)
+	}
+}
+
+func TestOIDCLoginStateFromAnotherBrowser(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	si := beginOIDC(t, s, issuer, verifiedEmail("a@example.com"))
+	other := beginOIDC(t, s, issuer, verifiedEmail("a@example.com"))
+	if _, err := s.FinishOIDCLogin(context.Background(), other.state, si.state, si.code, "192.0.2.1", "test"); !errors.Is(err, ErrOIDCRejected) {
+		t.Errorf("err = %v, want %v", err, ErrOIDCRejected)
+	}
+}
+
+func TestOIDCLoginReusedNonce(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	first := beginOIDC(t, s, issuer, verifiedEmail("a@example.com"))
+	if _, err := first.finish(s); err != nil {
+		t.Fatalf("first FinishOIDCLogin: %v", err)
+	}
+
+	// An ID token minted for the first sign-in, replayed into a second one
+	claims := verifiedEmail("a@example.com")
+	claims["nonce"] = first.nonce
+	if _, err := beginOIDC(t, s, issuer, claims).finish(s); !errors.Is(err, ErrOIDCRejected) {
+		t.Errorf("err = %v, want %v", err, ErrOIDCRejected)
+	}
+}
+
+func TestOIDCLoginUnverifiedEmailDoesNotLink(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	existing := newTestUser(t, s, "owner@example.com")
+
+	_, err := beginOIDC(t, s, issuer, oidctest.Claims{"email": "owner@example.com", "email_verified": false}).finish(s)
+	if !errors.Is(err, ErrOIDCRejected) {
+		t.Fatalf("err = %v, want %v", err, ErrOIDCRejected)
+	}
+	identity, err := s.OIDCDB.GetIdentity(issuer.URL, "subject-1")
+	if err != nil || identity != nil {
+		t.Fatalf("identity = %+v, %v; want none linked to user %d", identity, err, existing.ID)
+	}
+}
+
+func TestOIDCLoginActivatesPendingAccount(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	pending, err := s.UserDB.Create(&models.User{FirstName: "P", LastName: "U", Email: "pending@example.com", Role: "user", Status: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := beginOIDC(t, s, issuer, verifiedEmail("pending@example.com")).finish(s)
+	if err != nil || result.SessionToken == "" {
+		t.Fatalf("FinishOIDCLogin = %+v, %v", result, err)
+	}
+	user, err := s.UserDB.GetByID(pending.ID)
+	if err != nil || user.Status != "active" {
+		t.Fatalf("user = %+v, %v; want active", user, err)
+	}
+}
+
+func TestOIDCLoginLinksAccountWithTOTP(t *testing.T) {
+	s, issuer := newOIDCService(t)
+	user := newTestUser(t, s, "mfa@example.com")
+	enableTestTOTP(t, s, user.ID)
+
+	result, err := beginOIDC(t, s, issuer, verifiedEmail("mfa@example.com")).finish(s)
+	if err != nil {
+		t.Fatalf("FinishOIDCLogin: %v", err)
+	}
+	if result.SessionToken != "" || result.MFAToken == "" {
+		t.Fatalf("result = %+v; want an MFA challenge and no session", result)
+	}
+	identity, err := s.OIDCDB.GetIdentity(issuer.URL, "subject-1")
+	if err != nil || identity == nil || identity.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v; want linked to user %d", identity, err, user.ID)
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/webauthn"
+)
+
+const (
+	passkeyUserHandleBytes = 32
+	maxPasskeysPerUser     = 10
+	maxPasskeyNameLength   = 64
+	defaultPasskeyName     = "Passkey"
+)
+
+var (
+	// ErrPasskeysUnavailable is returned when WebAuthn is not configured
+	ErrPasskeysUnavailable = errors.New("passkeys are not configured")
+	// ErrPasskeyRejected is returned when a registration or assertion fails
+	// verification; the detailed reason is logged, not returned
+	ErrPasskeyRejected = errors.New("passkey verification failed")
+	// ErrPasskeyLimit is returned when the user already has the maximum number of passkeys
+	ErrPasskeyLimit = errors.New("too many passkeys")
+)
+
+// ChallengeStore issues single-use ceremony challenges, each bound to the
+// party that asked for it. middleware.SQLiteCSRFTokenStore satisfies it.
+type ChallengeStore interface {
+	GenerateBoundToken(binding string) (string, error)
+	ConsumeBoundToken(token, binding string) bool
+}
+
+// SetPasskeys enables WebAuthn passkey registration and passwordless login
+func (s *AuthService) SetPasskeys(rp *webauthn.RelyingParty, db *models.WebAuthnCredentialDatabase, challenges ChallengeStore) {
+	s.rp = rp
+	s.PasskeyDB = db
+	s.challenges = challenges
+}
+
+// PasskeysAvailable reports whether SetPasskeys has been called
+func (s *AuthService) PasskeysAvailable() bool {
+	return s.PasskeyDB != nil
+}
+
+// Passkeys returns the user's registered passkeys
+func (s *AuthService) Passkeys(userID int) ([]*models.WebAuthnCredential, error) {
+	if s.PasskeyDB == nil {
+		return nil, nil
+	}
+	return s.PasskeyDB.ListByUserID(userID)
+}
+
+// BeginPasskeyRegistration returns creation options for a new passkey on the
+// user's account, with a fresh challenge
+func (s *AuthService) BeginPasskeyRegistration(user *models.User) (*webauthn.CreationOptions, error) {
+	if s.PasskeyDB == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	existing, err := s.PasskeyDB.ListByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		return nil, ErrPasskeyLimit
+	}
+	handle, err := s.passkeyUserHandle(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.challenges.GenerateBoundToken(userChallengeBinding(user.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue webauthn challenge: %w", err)
+	}
+
+	exclude := make([][]byte, 0, len(existing))
+	for _, c := range existing {
+		exclude = append(exclude, c.CredentialID)
+	}
+	entity := webauthn.UserEntity{
+		ID:          handle,
+		Name:        user.Email,
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}
+	return s.rp.CreationOptions([]byte(challenge), entity, exclude), nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's response and stores
+// the new passkey under name. The challenge must have been issued to the same user.
+func (s *AuthService) FinishPasskeyRegistration(user *models.User, name string, resp *webauthn.RegistrationResponse) (*models.WebAuthnCredential, error) {
+	if s.PasskeyDB == nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	cred, err := s.rp.VerifyRegistration(resp, s.challengeConsumer(userChallengeBinding(user.ID)))
+	if err != nil {
+		log.Printf("[SECURITY] passkey registration rejected: user=%d err=%v", user.ID, err)
+		return nil, ErrPasskeyRejected
+	}
+
+	existing, err := s.PasskeyDB.ListByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		return nil, ErrPasskeyLimit
+	}
+
+	c := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    cred.SignCount,
+		Name:         passkeyName(name),
+	}
+	if err := s.PasskeyDB.Create(c); err != nil {
+		// Most likely the credential ID is already registered, possibly to another account
+		log.Printf("[SECURITY] passkey registration not stored: user=%d err=%v", user.ID, err)
+		return nil, ErrPasskeyRejected
+	}
+	log.Printf("Passkey registered: user=%d credential=%d", user.ID, c.ID)
+	return c, nil
+}
+
+// DeletePasskey removes one of the user's passkeys
+func (s *AuthService) DeletePasskey(userID, id int) error {
+	if s.PasskeyDB == nil {
+		return ErrPasskeysUnavailable
+	}
+	if err := s.PasskeyDB.Delete(userID, id); err != nil {
+		return err
+	}
+	log.Printf("Passkey removed: user=%d credential=%d", userID, id)
+	return nil
+}
+
+// BeginPasskeyLogin returns request options with a fresh challenge. No
+// account is named; the authenticator offers any passkey it holds for this site.
+// The challenge is bound to the returned nonce, which the caller must keep in
+// the requesting browser's cookie and pass to LoginWithPasskey.
+func (s *AuthService) BeginPasskeyLogin() (*webauthn.RequestOptions, string, error) {
+	if s.PasskeyDB == nil {
+		return nil, "", ErrPasskeysUnavailable
+	}
+	nonce, err := models.GenerateSessionToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate webauthn nonce: %w", err)
+	}
+	challenge, err := s.challenges.GenerateBoundToken(nonceChallengeBinding(nonce))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to issue webauthn challenge: %w", err)
+	}
+	return s.rp.RequestOptions([]byte(challenge)), nonce, nil
+}
+
+// LoginWithPasskey verifies an assertion and creates a session without a
+// password. nonce is the one BeginPasskeyLogin returned to this browser. A user-verified passkey is already two factors (the device and its
+// PIN or biometric), so TOTP is not asked for.
+//
+// Failures count towards IP and subnet lockout but not account lockout: the
+// account is only known from the credential ID, which is not secret, and a
+// passkey must stay usable while someone is guessing the account's password.
+func (s *AuthService) LoginWithPasskey(resp *webauthn.AssertionResponse, nonce, ip, userAgent string) (string, error) {
+	if s.PasskeyDB == nil {
+		return "", ErrPasskeysUnavailable
+	}
+	if s.clientAccess.Denied(ip) {
+		log.Printf("[SECURITY] passkey login from denylisted client: ip=%s bucket=%s ua=%.200s",
+			ip, s.clientBuckets.Key(ip), userAgent)
+		return "", ErrClientDenied
+	}
+
+	remaining, err := s.lockoutRemaining("", ip)
+	if err != nil {
+		return "", fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if remaining > 0 {
+		log.Printf("Locked passkey login attempt: ip=%s", ip)
+		return "", &LockoutError{RetryAfter: remaining}
+	}
+
+	fail := func(reason string, args ...any) (string, error) {
+		log.Printf("[SECURITY] passkey login rejected: ip=%s "+reason, append([]any{ip}, args...)...)
+		s.recordFailedAttempt("", ip, userAgent)
+		return "", ErrPasskeyRejected
+	}
+
+	consume := s.challengeConsumer(nonceChallengeBinding(nonce))
+	cred, err := s.PasskeyDB.GetByCredentialID(resp.RawID)
+	if err != nil {
+		return "", err
+	}
+	if cred == nil {
+		// Burn the challenge anyway so an unknown credential cannot probe with it
+		_, verr := s.rp.VerifyAssertion(resp, nil, 0, consume)
+		return fail("unknown credential err=%v", verr)
+	}
+	handle, err := s.passkeyUserHandle(cred.UserID)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Response.UserHandle) > 0 &&
+		subtle.ConstantTimeCompare(resp.Response.UserHandle, handle) != 1 {
+		_, _ = s.rp.VerifyAssertion(resp, nil, 0, consume)
+		return fail("user handle mismatch credential=%d", cred.ID)
+	}
+
+	signCount, err := s.rp.VerifyAssertion(resp, cred.PublicKey, cred.SignCount, consume)
+	if errors.Is(err, webauthn.ErrSignCountRegressed) {
+		log.Printf("[SECURITY] possible cloned authenticator: user=%d credential=%d", cred.UserID, cred.ID)
+	}
+	if err != nil {
+		return fail("credential=%d err=%v", cred.ID, err)
+	}
+
+	user, err := s.UserDB.GetByID(cred.UserID)
+	if err != nil || user.Status != "active" {
+		return fail("inactive user=%d", cred.UserID)
+	}
+	if err := s.PasskeyDB.UpdateUsage(cred.ID, signCount); err != nil {
+		return "", err
+	}
+
+	log.Printf("Passkey accepted: user=%d credential=%d ip=%s", user.ID, cred.ID, ip)
+	return s.createSession(user, ip, userAgent)
+}
+
+// challengeConsumer returns a callback that spends a challenge issued by Begin*
+// to binding; challenge bytes are the ASCII of the store token. A challenge
+// issued to anyone else is refused and left for its owner.
+func (s *AuthService) challengeConsumer(binding string) func(challenge []byte) bool {
+	return func(challenge []byte) bool {
+		return s.challenges.ConsumeBoundToken(string(challenge), binding)
+	}
+}
+
+// userChallengeBinding binds a registration challenge to the signed-in user
+func userChallengeBinding(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// nonceChallengeBinding binds a sign-in challenge to the browser holding nonce.
+// An empty nonce gets a binding no challenge is ever issued to.
+func nonceChallengeBinding(nonce string) string {
+	if nonce == "" {
+		return "nonce:none"
+	}
+	return "nonce:" + models.HashToken(nonce)
+}
+
+// passkeyUserHandle returns the user's WebAuthn user handle, creating a random
+// one on first use. It is never derived from the user ID or email, so
+// authenticators learn nothing about the account from it.
+func (s *AuthService) passkeyUserHandle(userID int) ([]byte, error) {
+	handle := make([]byte, passkeyUserHandleBytes)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, fmt.Errorf("failed to generate user handle: %w", err)
+	}
+	return s.PasskeyDB.UserHandle(userID, handle)
+}
+
+// passkeyName trims a user-supplied label to something safe to list
+func passkeyName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if !utf8.ValidString(name) || name == "" {
+		return defaultPasskeyName
+	}
+	if utf8.RuneCountInString(name) > maxPasskeyNameLength {
+		name = string([]rune(name)[:maxPasskeyNameLength])
+	}
+	return name
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"secure-ui-showcase-go/internal/models"
+	"secure-ui-showcase-go/internal/webauthn"
+	"secure-ui-showcase-go/internal/webauthn/webauthntest"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// memoryChallenges is a single-use ChallengeStore; issued maps each token to its binding
+type memoryChallenges struct {
+	next   int
+	issued map[string]string
+}
+
+func (c *memoryChallenges) GenerateBoundToken(binding string) (string, error) {
+	c.next++
+	token := "challenge-" + strconv.Itoa(c.next)
+	c.issued[token] = binding
+	return token, nil
+}
+
+func (c *memoryChallenges) ConsumeBoundToken(token, binding string) bool {
+	issuedTo, ok := c.issued[token]
+	if !ok || issuedTo != binding {
+		return false
+	}
+	delete(c.issued, token)
+	return true
+}
+
+// newPasskeyService returns a service with passkeys enabled, a user, and an
+// authenticator registered to that user through the service
+func newPasskeyService(t *testing.T) (*AuthService, *models.User, *webauthntest.Authenticator) {
+	t.Helper()
+	s, db := newTestAuthService(t)
+	s.SetPasskeys(
+		&webauthn.RelyingParty{ID: testRPID, Name: "Test", Origins: []string{testOrigin}},
+		models.NewWebAuthnCredentialDatabase(db),
+		&memoryChallenges{issued: map[string]string{}},
+	)
+	user := newTestUser(t, s, "passkey@example.com")
+
+	opts, err := s.BeginPasskeyRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	auth := webauthntest.New(testRPID, testOrigin)
+	if _, err := s.FinishPasskeyRegistration(user, "Laptop", auth.Register(opts.Challenge, opts.User.ID)); err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+	return s, user, auth
+}
+
+// assert runs a passkey login ceremony with auth, returning the assertion and
+// the nonce the challenge was bound to
+func assert(t *testing.T, s *AuthService, auth *webauthntest.Authenticator) (*webauthn.AssertionResponse, string) {
+	t.Helper()
+	opts, nonce, err := s.BeginPasskeyLogin()
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin: %v", err)
+	}
+	return auth.Assert(opts.Challenge), nonce
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	s, user, auth := newPasskeyService(t)
+
+	resp, nonce := assert(t, s, auth)
+	token, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatalf("LoginWithPasskey: %v", err)
+	}
+	got, err := s.ValidateSession(token)
+	if err != nil || got == nil || got.ID != user.ID {
+		t.Fatalf("session user = %v, %v; want %d", got, err, user.ID)
+	}
+
+	creds, err := s.Passkeys(user.ID)
+	if err != nil || len(creds) != 1 || creds[0].SignCount != auth.SignCount {
+		t.Fatalf("stored passkeys = %v, %v; want one with sign count %d", creds, err, auth.SignCount)
+	}
+}
+
+func TestPasskeyRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*webauthntest.Authenticator)
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example" }},
+		{"wrong rpId hash", func(a *webauthntest.Authenticator) { a.RPID = "evil.example" }},
+		{"missing UV flag", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserPresent }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, user, _ := newPasskeyService(t)
+			opts, err := s.BeginPasskeyRegistration(user)
+			if err != nil {
+				t.Fatalf("BeginPasskeyRegistration: %v", err)
+			}
+			auth := webauthntest.New(testRPID, testOrigin)
+			tt.tamper(auth)
+			if _, err := s.FinishPasskeyRegistration(user, "", auth.Register(opts.Challenge, opts.User.ID)); !errors.Is(err, ErrPasskeyRejected) {
+				t.Errorf("err = %v, want %v", err, ErrPasskeyRejected)
+			}
+		})
+	}
+}
+
+func TestPasskeyLoginRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*webauthntest.Authenticator)
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example" }},
+		{"wrong rpId hash", func(a *webauthntest.Authenticator) { a.RPID = "evil.example" }},
+		{"missing UV flag", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserPresent }},
+		{"user handle mismatch", func(a *webauthntest.Authenticator) { a.UserHandle = []byte("someone-else") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, auth := newPasskeyService(t)
+			tt.tamper(auth)
+			resp, nonce := assert(t, s, auth)
+			if _, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test"); !errors.Is(err, ErrPasskeyRejected) {
+				t.Errorf("err = %v, want %v", err, ErrPasskeyRejected)
+			}
+		})
+	}
+}
+
+func TestPasskeyLoginReplayedChallenge(t *testing.T) {
+	s, _, auth := newPasskeyService(t)
+	resp, nonce := assert(t, s, auth)
+	if _, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test"); err != nil {
+		t.Fatalf("first LoginWithPasskey: %v", err)
+	}
+	if _, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test"); !errors.Is(err, ErrPasskeyRejected) {
+		t.Errorf("replay err = %v, want %v", err, ErrPasskeyRejected)
+	}
+}
+
+func TestPasskeyLoginSignCountRegressed(t *testing.T) {
+	s, _, auth := newPasskeyService(t)
+	for range 3 {
+		resp, nonce := assert(t, s, auth)
+		if _, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test"); err != nil {
+			t.Fatalf("LoginWithPasskey: %v", err)
+		}
+	}
+	// A clone of the authenticator still at an earlier count
+	auth.SignCount = 1
+	resp, nonce := assert(t, s, auth)
+	if _, err := s.LoginWithPasskey(resp, nonce, "192.0.2.1", "test"); !errors.Is(err, ErrPasskeyRejected) {
+		t.Errorf("err = %v, want %v", err, ErrPasskeyRejected)
+	}
+}
+
+func TestPasskeyRegistrationOtherUsersChallenge(t *testing.T) {
+	s, user, _ := newPasskeyService(t)
+	other := newTestUser(t, s, "other@example.com")
+
+	opts, err := s.BeginPasskeyRegistration(user)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	auth := webauthntest.New(testRPID, testOrigin)
+	if _, err := s.FinishPasskeyRegistration(other, "", auth.Register(opts.Challenge, opts.User.ID)); !errors.Is(err, ErrPasskeyRejected) {
+		t.Errorf("err = %v, want %v", err, ErrPasskeyRejected)
+	}
+	// The challenge is left for the user it was issued to
+	if _, err := s.FinishPasskeyRegistration(user, "", auth.Register(opts.Challenge, opts.User.ID)); err != nil {
+		t.Errorf("owner's FinishPasskeyRegistration: %v", err)
+	}
+}
+
+func TestPasskeyLoginOtherBrowsersChallenge(t *testing.T) {
+	tests := []struct {
+		name  string
+		nonce string
+	}{
+		{"other browser's nonce", "someone-elses-nonce"},
+		{"no nonce", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, auth := newPasskeyService(t)
+			resp, _ := assert(t, s, auth)
+			if _, err := s.LoginWithPasskey(resp, tt.nonce, "192.0.2.1", "test"); !errors.Is(err, ErrPasskeyRejected) {
+				t.Errorf("err = %v, want %v", err, ErrPasskeyRejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordLength bounds passwords accepted by the forms. Argon2id has no
+// input limit of its own (unlike bcrypt's 72 bytes); this only keeps hashing
+// work per request reasonable.
+const MaxPasswordLength = 128
+
+// ErrUnknownHashFormat is returned when a stored hash matches no supported algorithm
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords into self-describing strings and verifies them
+type PasswordHasher interface {
+	// Hash returns an encoded hash of password, including algorithm and parameters
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded and, if it does, whether
+	// encoded should be replaced by a fresh Hash because it uses an older
+	// algorithm or weaker parameters
+	Verify(encoded, password string) (match, rehash bool, err error)
+}
+
+// Argon2idParams are the argon2id cost parameters
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP recommendation (19 MiB, 2 passes, 1 lane)
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes with argon2id in PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// It also verifies bcrypt hashes from before argon2id was introduced, and
+// reports them (and argon2id hashes with other parameters) as needing a rehash.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// Compile-time check that Argon2idHasher satisfies PasswordHasher
+var _ PasswordHasher = (*Argon2idHasher)(nil)
+
+// NewArgon2idHasher creates a hasher that hashes with params
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Hash returns the PHC-format argon2id hash of password with a random salt
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks password against an argon2id or bcrypt hash in constant time
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, bool, error) {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false, nil
+	}
+	rehash := params.Memory != h.params.Memory ||
+		params.Iterations != h.params.Iterations ||
+		params.Parallelism != h.params.Parallelism ||
+		uint32(len(salt)) != h.params.SaltLength ||
+		uint32(len(key)) != h.params.KeyLength
+	return true, rehash, nil
+}
+
+// maxArgon2idMemory caps the memory a stored hash may ask for (1 GiB), so a
+// tampered hash row cannot make verification exhaust the server
+const maxArgon2idMemory = 1 << 20
+
+// decodeArgon2id parses a PHC-format argon2id hash
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var p Argon2idParams
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHashFormat)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("%w: bad argon2 parameters", ErrUnknownHashFormat)
+	}
+	if p.Memory == 0 || p.Memory > maxArgon2idMemory || p.Iterations == 0 || p.Iterations > 64 || p.Parallelism == 0 {
+		return p, nil, nil, fmt.Errorf("%w: argon2 parameters out of range", ErrUnknownHashFormat)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < 8 {
+		return p, nil, nil, fmt.Errorf("%w: bad argon2 salt", ErrUnknownHashFormat)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < 16 || len(key) > 64 {
+		return p, nil, nil, fmt.Errorf("%w: bad argon2 hash", ErrUnknownHashFormat)
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy decides which new passwords are acceptable. Handlers check it
+// wherever a password is chosen, and turn each violation into a localized
+// error for the password field.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest EstimatePasswordStrength score accepted, 0 to 4
+	MinScore int
+	// Breached rejects passwords from a breach corpus; nil skips the check
+	Breached *BreachedPasswords
+}
+
+// PasswordViolation is one rule a password breaks
+type PasswordViolation struct {
+	Key  string // i18n key of the message
+	Arg  int    // number the message refers to, such as the minimum length
+	Hint string // i18n key of an extra suggestion, or ""
+}
+
+// Password policy violation keys
+const (
+	PasswordTooShort = "password.too_short"
+	PasswordTooLong  = "password.too_long"
+	PasswordTooWeak  = "password.too_weak"
+	PasswordPersonal = "password.personal"
+	PasswordBreached = "password.breached"
+)
+
+// minPersonalTokenLength ignores name and email parts too short to matter, so
+// someone called "Al" can still use a password containing "al"
+const minPersonalTokenLength = 3
+
+// DefaultPasswordPolicy requires 8 to MaxPasswordLength characters that are
+// not trivially guessable (score 2), without a breach corpus
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: 8,
+		MaxLength: MaxPasswordLength,
+		MinScore:  2,
+	}
+}
+
+// Check returns every rule password breaks, or nil if it is acceptable.
+// personal lists the user's own details (names, email address) that the
+// password must not contain. An empty password returns nil; required-field
+// checks are the caller's.
+func (p *PasswordPolicy) Check(password string, personal ...string) []PasswordViolation {
+	if password == "" {
+		return nil
+	}
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		return []PasswordViolation{{Key: PasswordTooShort, Arg: p.MinLength}}
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return []PasswordViolation{{Key: PasswordTooLong, Arg: p.MaxLength}}
+	}
+
+	var violations []PasswordViolation
+	if containsPersonalInfo(password, personal) {
+		violations = append(violations, PasswordViolation{Key: PasswordPersonal})
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, PasswordViolation{Key: PasswordBreached})
+	} else if strength := EstimatePasswordStrength(password); strength.Score < p.MinScore {
+		violations = append(violations, PasswordViolation{Key: PasswordTooWeak, Hint: strength.Warning})
+	}
+	return violations
+}
+
+// containsPersonalInfo reports whether password contains any of the personal
+// details, or a word of them such as the local part of an email address or
+// one of several first names, ignoring case
+func containsPersonalInfo(password string, personal []string) bool {
+	lower := strings.ToLower(password)
+	for _, detail := range personal {
+		detail = strings.ToLower(strings.TrimSpace(detail))
+		local, _, _ := strings.Cut(detail, "@")
+		tokens := strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		tokens = append(tokens, local)
+		for _, token := range tokens {
+			if len([]rune(token)) >= minPersonalTokenLength && strings.Contains(lower, token) {
+				return true
+			}
+		}
+	}
+	return false
+}
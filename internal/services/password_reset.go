@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"secure-ui-showcase-go/internal/mail"
+	"secure-ui-showcase-go/internal/models"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	mailSendTimeout  = 30 * time.Second
+)
+
+// ErrResetTokenInvalid is returned for an unknown, expired or already used reset link
+var ErrResetTokenInvalid = errors.New("password reset link is invalid or has expired")
+
+// SetMailer sets the transport for account emails. Links in them are built
+// from baseURL (e.g. "https://example.com") rather than the request's Host
+// header, so a forged Host cannot redirect a token to another site.
+func (s *AuthService) SetMailer(mailer mail.Mailer, baseURL string) {
+	s.mailer = mailer
+	s.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetPasswordReset enables the forgotten-password flow. It needs SetMailer.
+func (s *AuthService) SetPasswordReset(db *models.PasswordResetDatabase) {
+	s.ResetDB = db
+}
+
+// RequestPasswordReset emails a reset link if email belongs to an active account.
+// It returns nil whether or not the account exists and sends the email in the
+// background, so neither the response nor its timing reveals which emails are
+// registered.
+func (s *AuthService) RequestPasswordReset(email, ip string) error {
+	if s.ResetDB == nil || s.mailer == nil {
+		return errors.New("password reset is not configured")
+	}
+
+	user, err := s.UserDB.GetByEmail(email)
+	if errors.Is(err, models.ErrNotFound) {
+		log.Printf("Password reset requested for unknown email: email=%s ip=%s", email, ip)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Status != "active" {
+		log.Printf("Password reset requested for inactive account: id=%d ip=%s", user.ID, ip)
+		return nil
+	}
+
+	token, err := models.GenerateSessionToken()
+	if err != nil {
+		return err
+	}
+	if err := s.ResetDB.Create(user.ID, models.HashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
+	}
+
+	link := s.baseURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Secure-UI password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password for your Secure-UI account. "+
+			"If it was you, open this link within %d minutes to choose a new password:\n\n"+
+			"%s\n\n"+
+			"The link works once. If you didn't ask for this, you can ignore this email; "+
+			"your password has not been changed.\n",
+			user.FirstName, int(passwordResetTTL/time.Minute), link),
+	}
+	go s.sendMail(msg, user.ID)
+
+	log.Printf("Password reset requested: id=%d ip=%s", user.ID, ip)
+	return nil
+}
+
+// CheckPasswordResetToken reports whether a reset link is still usable,
+// without using it up, and returns the account it resets
+func (s *AuthService) CheckPasswordResetToken(token string) (*models.User, error) {
+	if s.ResetDB == nil || token == "" {
+		return nil, ErrResetTokenInvalid
+	}
+	userID, err := s.ResetDB.Lookup(models.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, ErrResetTokenInvalid
+	}
+	user, err := s.UserDB.GetByID(userID)
+	if err != nil || user.Status != "active" {
+		return nil, ErrResetTokenInvalid
+	}
+	return user, nil
+}
+
+// ResetPassword sets a new password using a reset link. Like ChangePassword
+// it signs the user out of every session. Two-factor authentication stays on.
+func (s *AuthService) ResetPassword(token, newPassword string) error {
+	if s.ResetDB == nil || token == "" {
+		return ErrResetTokenInvalid
+	}
+	userID, err := s.ResetDB.Consume(models.HashToken(token))
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		return ErrResetTokenInvalid
+	}
+
+	user, err := s.UserDB.GetByID(userID)
+	if err != nil || user.Status != "active" {
+		return ErrResetTokenInvalid
+	}
+
+	if err := s.setPassword(user.ID, newPassword); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] password reset by email link: id=%d, all sessions invalidated", user.ID)
+	return nil
+}
+
+// sendMail delivers msg with a timeout, logging rather than returning failures
+// because the caller has already answered the request
+func (s *AuthService) sendMail(msg mail.Message, userID int) {
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		log.Printf("Failed to send %q to user %d: %v", msg.Subject, userID, err)
+	}
+}
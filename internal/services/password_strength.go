@@ -0,0 +1,377 @@
+package services
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PasswordStrength is a zxcvbn-style estimate of how many guesses an attacker
+// who knows common passwords and patterns needs to find a password
+type PasswordStrength struct {
+	Score   int     // 0 (trivial) to 4 (very strong), on the zxcvbn scale
+	Guesses float64 // log10 of the estimated number of guesses
+	// Warning is the i18n key describing the weakest pattern found, or ""
+	Warning string
+}
+
+// Pattern warnings, returned as PasswordStrength.Warning
+const (
+	warnCommon   = "password.warn_common"
+	warnSequence = "password.warn_sequence"
+	warnRepeat   = "password.warn_repeat"
+	warnKeyboard = "password.warn_keyboard"
+	warnDate     = "password.warn_date"
+)
+
+// scoreThresholds are the log10 guess counts for scores 1 to 4, as in zxcvbn:
+// 10^3 guesses falls to an online attack, 10^10 withstands an offline one
+// against a slow hash
+var scoreThresholds = [...]float64{3, 6, 8, 10}
+
+// bruteforceGuessesPerChar is the log10 cost of a character no pattern explains
+const bruteforceGuessesPerChar = 1
+
+// passwordMatch is a substring explained by a known pattern
+type passwordMatch struct {
+	start, end int     // byte offsets into the password, end exclusive
+	guesses    float64 // log10
+	warning    string
+}
+
+// EstimatePasswordStrength estimates the strength of password. It splits the
+// password into the cheapest combination of dictionary words (including
+// l33t and reversed spellings), sequences, repeats, keyboard runs, dates and
+// brute-forced characters, and scores the total number of guesses.
+func EstimatePasswordStrength(password string) PasswordStrength {
+	if password == "" {
+		return PasswordStrength{}
+	}
+	lower := asciiLower(password)
+
+	var matches []passwordMatch
+	matches = append(matches, dictionaryMatches(password, lower)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, repeatMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, dateMatches(lower)...)
+
+	// best[i] is the cheapest way to guess password[:i]; via[i] is the match
+	// that ends it there, or -1 for a brute-forced character
+	n := len(password)
+	byEnd := make(map[int][]int)
+	for k, m := range matches {
+		byEnd[m.end] = append(byEnd[m.end], k)
+	}
+	best := make([]float64, n+1)
+	via := make([]int, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = best[i-1] + bruteforceGuessesPerChar
+		via[i] = -1
+		for _, k := range byEnd[i] {
+			if g := best[matches[k].start] + matches[k].guesses; g < best[i] {
+				best[i] = g
+				via[i] = k
+			}
+		}
+	}
+
+	// The warning comes from the longest pattern in the cheapest split
+	strength := PasswordStrength{Guesses: best[n]}
+	longest := 0
+	for i := n; i > 0; {
+		k := via[i]
+		if k < 0 {
+			i--
+			continue
+		}
+		if l := matches[k].end - matches[k].start; l > longest {
+			longest = l
+			strength.Warning = matches[k].warning
+		}
+		i = matches[k].start
+	}
+	for _, t := range scoreThresholds {
+		if strength.Guesses >= t {
+			strength.Score++
+		}
+	}
+	return strength
+}
+
+// l33tSubstitutions maps symbols commonly swapped for letters back to the letter
+var l33tSubstitutions = map[byte]byte{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i',
+	'!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// dictionaryMatches finds common passwords and words, also when reversed or
+// spelled with l33t substitutions. Capitals and substitutions each add a
+// little to the guess count, as attackers try those variants early.
+func dictionaryMatches(password, lower string) []passwordMatch {
+	unl33t := []byte(lower)
+	for i := range unl33t {
+		if c, ok := l33tSubstitutions[unl33t[i]]; ok {
+			unl33t[i] = c
+		}
+	}
+
+	var matches []passwordMatch
+	n := len(lower)
+	for i := 0; i < n; i++ {
+		for j := i + 3; j <= n; j++ {
+			word, subbed := lower[i:j], false
+			rank, ok := commonPasswordRank[word]
+			if !ok {
+				word, subbed = string(unl33t[i:j]), true
+				rank, ok = commonPasswordRank[word]
+			}
+			reversed := false
+			if !ok {
+				word, subbed, reversed = reverseString(lower[i:j]), false, true
+				rank, ok = commonPasswordRank[word]
+			}
+			if !ok {
+				continue
+			}
+			guesses := math.Log10(float64(rank)) + capitalisationGuesses(password[i:j])
+			if subbed && word != lower[i:j] {
+				guesses += math.Log10(2) * float64(countDifferences(word, lower[i:j]))
+			}
+			if reversed {
+				guesses += math.Log10(2)
+			}
+			matches = append(matches, passwordMatch{start: i, end: j, guesses: guesses, warning: warnCommon})
+		}
+	}
+	return matches
+}
+
+// capitalisationGuesses is the log10 cost of the capitals in word: nothing for
+// all lower case, a doubling for a leading capital or all caps, and otherwise
+// one bit per capital letter
+func capitalisationGuesses(word string) float64 {
+	upper := 0
+	for i := 0; i < len(word); i++ {
+		if word[i] >= 'A' && word[i] <= 'Z' {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 0
+	case upper == len(word), upper == 1 && word[0] >= 'A' && word[0] <= 'Z':
+		return math.Log10(2)
+	default:
+		return math.Log10(2) * float64(upper)
+	}
+}
+
+// sequenceMatches finds runs like "abcd", "9876" or "acegi" with a constant step
+func sequenceMatches(lower string) []passwordMatch {
+	var matches []passwordMatch
+	n := len(lower)
+	for i := 0; i+2 < n; {
+		delta := int(lower[i+1]) - int(lower[i])
+		if delta == 0 || delta < -5 || delta > 5 {
+			i++
+			continue
+		}
+		j := i + 2
+		for j < n && int(lower[j])-int(lower[j-1]) == delta {
+			j++
+		}
+		if j-i < 3 {
+			i++
+			continue
+		}
+		base := math.Log10(26)
+		switch c := lower[i]; {
+		case c == 'a' || c == 'z' || c == '0' || c == '1' || c == '9':
+			base = math.Log10(4)
+		case c >= '0' && c <= '9':
+			base = 1
+		}
+		guesses := base + math.Log10(float64(j-i))
+		if delta < 0 {
+			guesses += math.Log10(2)
+		}
+		matches = append(matches, passwordMatch{start: i, end: j, guesses: guesses, warning: warnSequence})
+		i = j - 1
+	}
+	return matches
+}
+
+// repeatMatches finds a character or block repeated, like "aaaa" or "abcabcabc".
+// A block costs as much as guessing it once, plus the number of repetitions.
+func repeatMatches(lower string) []passwordMatch {
+	var matches []passwordMatch
+	n := len(lower)
+	for i := 0; i < n; i++ {
+		for size := 1; i+2*size <= n; size++ {
+			block := lower[i : i+size]
+			j := i + size
+			for j+size <= n && lower[j:j+size] == block {
+				j += size
+			}
+			count := (j - i) / size
+			if count < 2 || j-i < 3 {
+				continue
+			}
+			blockGuesses := EstimatePasswordStrength(block).Guesses
+			if size == 1 {
+				blockGuesses = math.Log10(charsetSize(block[0]))
+			}
+			matches = append(matches, passwordMatch{
+				start: i, end: j,
+				guesses: blockGuesses + math.Log10(float64(count)),
+				warning: warnRepeat,
+			})
+		}
+	}
+	return matches
+}
+
+// keyboardRows are QWERTY rows, searched forwards and backwards
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// keyboardMatches finds runs of four or more adjacent keys along a keyboard row
+func keyboardMatches(lower string) []passwordMatch {
+	var matches []passwordMatch
+	n := len(lower)
+	for i := 0; i+4 <= n; i++ {
+		for j := n; j >= i+4; j-- {
+			run := lower[i:j]
+			found := false
+			for _, row := range keyboardRows {
+				if strings.Contains(row, run) || strings.Contains(row, reverseString(run)) {
+					found = true
+					break
+				}
+			}
+			if found {
+				// Start key, direction and length
+				guesses := math.Log10(float64(len(keyboardRows)*12)) + math.Log10(2) + math.Log10(float64(j-i))
+				matches = append(matches, passwordMatch{start: i, end: j, guesses: guesses, warning: warnKeyboard})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// dateMatches finds years from 1900 to 2099 and eight-digit dates such as
+// 31121999 or 19991231. Years close to now are guessed first.
+func dateMatches(lower string) []passwordMatch {
+	var matches []passwordMatch
+	now := time.Now().Year()
+	yearGuesses := func(year int) float64 {
+		return math.Log10(math.Max(math.Abs(float64(year-now)), 20))
+	}
+
+	n := len(lower)
+	for i := 0; i+4 <= n; i++ {
+		if year, err := strconv.Atoi(lower[i : i+4]); err == nil && year >= 1900 && year <= 2099 {
+			matches = append(matches, passwordMatch{start: i, end: i + 4, guesses: yearGuesses(year), warning: warnDate})
+		}
+		if i+8 > n {
+			continue
+		}
+		digits := lower[i : i+8]
+		if _, err := strconv.Atoi(digits); err != nil {
+			continue
+		}
+		for _, layout := range []string{"02012006", "01022006", "20060102"} {
+			if t, err := time.Parse(layout, digits); err == nil && t.Year() >= 1900 && t.Year() <= 2099 {
+				matches = append(matches, passwordMatch{
+					start: i, end: i + 8,
+					guesses: math.Log10(365) + yearGuesses(t.Year()),
+					warning: warnDate,
+				})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// asciiLower lower-cases ASCII letters only, so byte offsets into the result
+// are valid for the original (strings.ToLower can change lengths)
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// charsetSize is the number of characters in c's class
+func charsetSize(c byte) float64 {
+	switch {
+	case c >= '0' && c <= '9':
+		return 10
+	case c >= 'a' && c <= 'z':
+		return 26
+	default:
+		return 33
+	}
+}
+
+// countDifferences counts the positions at which a and b differ; they must be the same length
+func countDifferences(a, b string) int {
+	n := 0
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			n++
+		}
+	}
+	return n
+}
+
+// reverseString reverses s byte by byte; passwords are matched on ASCII patterns
+func reverseString(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// commonPasswordRank ranks the most common passwords and English words found in
+// password dumps, most common first (rank 1). It is deliberately short: the
+// breached-password list catches the long tail.
+var commonPasswordRank = func() map[string]int {
+	words := strings.Fields(`
+		password 123456 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon
+		123123 baseball abc123 football monkey letmein 696969 shadow master 666666
+		qwertyuiop 123321 mustang 1234567890 michael 654321 superman 1qaz2wsx 7777777 121212
+		000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm asdfgh hunter
+		buster soccer harley batman andrew tigger sunshine iloveyou 2000 charlie robert
+		thomas hockey ranger daniel starwars 112233 george computer michelle jessica
+		pepper 1111 zxcvbn 555555 11111111 131313 freedom 777777 pass maggie
+		159753 aaaaaa ginger princess joshua cheese amanda summer love ashley
+		nicole chelsea biteme matthew access yankees 987654321 dallas austin thunder
+		taylor matrix minecraft welcome admin administrator login secret passw0rd hello
+		whatever monday flower lovely hottie loveme zaq12wsx qwerty123 password1 football1
+		secure security changeme default guest root toor test user
+		spring autumn winter january february march april june july august
+		september october november december sunday tuesday friday saturday
+		apple orange banana chocolate coffee cookie family friend friends happy
+		heaven angel baby blue green purple yellow black silver golden
+		money power magic secret dream star moon sun water fire
+		tiger lion eagle horse dog cat bear wolf snake dolphin
+		america canada london paris berlin madrid france germany spain mexico
+		jesus god church faith christ peace life music rock metal
+		qwer asdf zxcv qaz wsx edc abc xyz
+	`)
+	ranks := make(map[string]int, len(words))
+	for i, w := range words {
+		if _, seen := ranks[w]; !seen {
+			ranks[w] = i + 1
+		}
+	}
+	return ranks
+}()
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"secure-ui-showcase-go/internal/database"
+	"secure-ui-showcase-go/internal/models"
+)
+
+// newTestAuthService returns an AuthService over a fresh database, and the
+// database for the optional features a test enables
+func newTestAuthService(t *testing.T) (*AuthService, *sql.DB) {
+	t.Helper()
+	return newTestAuthServiceWithLockout(t, LockoutConfig{})
+}
+
+// newTestAuthServiceWithLockout is newTestAuthService with lockout policies
+func newTestAuthServiceWithLockout(t *testing.T, lockout LockoutConfig) (*AuthService, *sql.DB) {
+	t.Helper()
+	db, err := database.InitDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	s := NewAuthService(models.NewUserDatabase(db), models.NewSessionDatabase(db), models.NewLoginAttemptDatabase(db), lockout)
+	return s, db
+}
+
+// newTestUser creates an active user with the "user" role
+func newTestUser(t *testing.T, s *AuthService, email string) *models.User {
+	t.Helper()
+	user, err := s.UserDB.Create(&models.User{FirstName: "Test", LastName: "User", Email: email, Role: "user", Status: "active"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// enableTestTOTP turns on TOTP for the user; s must have MFA set up
+func enableTestTOTP(t *testing.T, s *AuthService, userID int) {
+	t.Helper()
+	sealed, err := s.sealSecret(userID, []byte("12345678901234567890"))
+	if err != nil {
+		t.Fatalf("seal secret: %v", err)
+	}
+	if err := s.MFADB.SavePending(userID, sealed); err != nil {
+		t.Fatalf("save pending: %v", err)
+	}
+	if err := s.MFADB.Enable(userID, 0, nil); err != nil {
+		t.Fatalf("enable totp: %v", err)
+	}
+}
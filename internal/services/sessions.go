@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"secure-ui-showcase-go/internal/models"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time and
+// sliding expiry are written, so browsing does not cost a database write per request
+const sessionTouchInterval = time.Minute
+
+// SessionConfig controls how long sessions last and how often their tokens change
+type SessionConfig struct {
+	// IdleTimeout ends a session that has made no request for this long
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends a session this long after sign-in, however active
+	AbsoluteTimeout time.Duration
+	// RotateInterval is how often a session gets a new token; 0 disables rotation
+	RotateInterval time.Duration
+	// RotationGrace is how long the replaced token keeps working, for requests
+	// that were already in flight when the token changed
+	RotationGrace time.Duration
+}
+
+// DefaultSessionConfig returns a 2h idle / 24h absolute lifetime with a new
+// token every 15 minutes
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		IdleTimeout:     2 * time.Hour,
+		AbsoluteTimeout: 24 * time.Hour,
+		RotateInterval:  15 * time.Minute,
+		RotationGrace:   30 * time.Second,
+	}
+}
+
+// SetSessionConfig changes session lifetimes. Zero timeouts keep their
+// defaults, and the idle timeout never exceeds the absolute one.
+func (s *AuthService) SetSessionConfig(cfg SessionConfig) {
+	def := DefaultSessionConfig()
+	if cfg.AbsoluteTimeout <= 0 {
+		cfg.AbsoluteTimeout = def.AbsoluteTimeout
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = def.IdleTimeout
+	}
+	if cfg.IdleTimeout > cfg.AbsoluteTimeout {
+		cfg.IdleTimeout = cfg.AbsoluteTimeout
+	}
+	if cfg.RotateInterval < 0 {
+		cfg.RotateInterval = 0
+	}
+	if cfg.RotationGrace <= 0 {
+		cfg.RotationGrace = def.RotationGrace
+	}
+	s.sessions = cfg
+}
+
+// SessionCookieMaxAge is the lifetime to give a new session cookie. The server
+// enforces the idle timeout; the cookie only needs to outlive the session.
+func (s *AuthService) SessionCookieMaxAge() time.Duration {
+	return s.sessions.AbsoluteTimeout
+}
+
+// RotatedSession is a session's replacement token, to be sent as the new cookie
+type RotatedSession struct {
+	Token  string
+	MaxAge time.Duration // remaining absolute lifetime of the session
+}
+
+// Device is one signed-in session as shown on the profile page
+type Device struct {
+	SessionID  int
+	Browser    string // e.g. "Firefox 128"; "Unknown browser" if unrecognised
+	OS         string // e.g. "macOS"; "Unknown OS" if unrecognised
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	Current    bool // the session making this request
+}
+
+// Devices lists the user's active sessions, most recently used first.
+// currentToken marks the caller's own session.
+func (s *AuthService) Devices(userID int, currentToken string) ([]Device, error) {
+	sessions, err := s.SessionDB.ListByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// The current token may be the one just rotated out by this very request
+	currentHash := models.HashToken(currentToken)
+	devices := make([]Device, 0, len(sessions))
+	for _, session := range sessions {
+		browser, os := parseUserAgent(session.UserAgent)
+		devices = append(devices, Device{
+			SessionID:  session.ID,
+			Browser:    browser,
+			OS:         os,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.TokenHash == currentHash || session.PrevTokenHash == currentHash,
+		})
+	}
+	return devices, nil
+}
+
+// RevokeSession signs out one of the user's sessions. It returns
+// models.ErrNotFound if the session is gone or belongs to someone else.
+func (s *AuthService) RevokeSession(userID, sessionID int) error {
+	if err := s.SessionDB.DeleteByID(sessionID, userID); err != nil {
+		return err
+	}
+	log.Printf("[SECURITY] session revoked by user: id=%d session=%d", userID, sessionID)
+	return nil
+}
+
+// RevokeOtherSessions signs out every session of the user except currentToken's
+func (s *AuthService) RevokeOtherSessions(userID int, currentToken string) (int64, error) {
+	current, err := s.lookupSession(currentToken)
+	if err != nil {
+		return 0, err
+	}
+	if current == nil || current.UserID != userID {
+		return 0, errors.New("current session not found")
+	}
+	n, err := s.SessionDB.DeleteOthers(userID, current.ID)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("[SECURITY] other sessions revoked by user: id=%d count=%d", userID, n)
+	return n, nil
+}
+
+// SessionKey returns a stable identifier for the session behind token, or ""
+// if there is none. Unlike the token it survives rotation, so values bound to
+// it (like signed CSRF tokens) stay valid when the session cookie changes.
+func (s *AuthService) SessionKey(token string) string {
+	session, err := s.lookupSession(token)
+	if err != nil || session == nil {
+		return ""
+	}
+	return strconv.Itoa(session.ID)
+}
+
+// SessionUserKey returns the ID of the user signed in with token, or "" if
+// the token has no live session. Per-user rate limits are keyed by it, so
+// neither made-up cookies nor token rotation give a client a fresh quota.
+func (s *AuthService) SessionUserKey(token string) string {
+	session, err := s.lookupSession(token)
+	if err != nil || session == nil || time.Now().After(session.ExpiresAt) {
+		return ""
+	}
+	return strconv.Itoa(session.UserID)
+}
+
+// lookupSession finds the session for token, accepting the session's previous
+// token only within the rotation grace window. Returns nil, nil if not found.
+func (s *AuthService) lookupSession(token string) (*models.Session, error) {
+	session, err := s.SessionDB.GetByToken(token)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if session.TokenHash != models.HashToken(token) && time.Since(session.RotatedAt) > s.sessions.RotationGrace {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// sessionDeadline is when a session ends if it makes no further request:
+// one idle timeout from now, but never past its absolute lifetime
+func (s *AuthService) sessionDeadline(session *models.Session) time.Time {
+	deadline := time.Now().Add(s.sessions.IdleTimeout)
+	if absolute := session.CreatedAt.Add(s.sessions.AbsoluteTimeout); absolute.Before(deadline) {
+		return absolute
+	}
+	return deadline
+}
+
+// touchSession records activity and slides the session's idle expiry forward,
+// at most once per sessionTouchInterval
+func (s *AuthService) touchSession(session *models.Session) {
+	if time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+	if err := s.SessionDB.Touch(session.ID, s.sessionDeadline(session)); err != nil {
+		log.Printf("Failed to update session last-seen time: %v", err)
+	}
+}
+
+// rotateSession gives the session a new token once RotateInterval has passed
+// since the last one was issued. It returns nil when no rotation is due, when
+// the request used the previous token, or when a concurrent request won.
+func (s *AuthService) rotateSession(session *models.Session, token string) *RotatedSession {
+	if s.sessions.RotateInterval <= 0 || time.Since(session.RotatedAt) < s.sessions.RotateInterval {
+		return nil
+	}
+	oldHash := models.HashToken(token)
+	if session.TokenHash != oldHash {
+		return nil
+	}
+	newToken, err := models.GenerateSessionToken()
+	if err != nil {
+		log.Printf("Failed to generate rotated session token: %v", err)
+		return nil
+	}
+	rotated, err := s.SessionDB.Rotate(session.ID, oldHash, models.HashToken(newToken))
+	if err != nil {
+		log.Printf("Failed to rotate session token: %v", err)
+		return nil
+	}
+	if !rotated {
+		return nil
+	}
+	return &RotatedSession{
+		Token:  newToken,
+		MaxAge: time.Until(session.CreatedAt.Add(s.sessions.AbsoluteTimeout)),
+	}
+}
+
+// parseUserAgent extracts a browser name with major version and an operating
+// system from a User-Agent header. It only needs to be good enough for a
+// person to recognise their own devices; the header is client-controlled.
+func parseUserAgent(ua string) (browser, os string) {
+	browser, os = "Unknown browser", "Unknown OS"
+
+	// Order matters: most browsers also claim to be Safari and Chrome
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"EdgiOS/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Version/", "Safari"},
+	} {
+		i := strings.Index(ua, b.token)
+		if i < 0 || (b.name == "Safari" && !strings.Contains(ua, "Safari/")) {
+			continue
+		}
+		browser = b.name
+		if v := majorVersion(ua[i+len(b.token):]); v != "" {
+			browser = b.name + " " + v
+		}
+		break
+	}
+
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		os = "iOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+	return browser, os
+}
+
+// majorVersion returns the leading digits of a version string like "126.0.1"
+func majorVersion(v string) string {
+	end := 0
+	for end < len(v) && end < 4 && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+	return v[:end]
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"secure-ui-showcase-go/internal/models"
+)
+
+func TestLogoutWithRotatedToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		rotatedAgo time.Duration
+		wantEnded  bool
+	}{
+		{name: "within the grace window ends the session", rotatedAgo: 0, wantEnded: true},
+		{name: "after the grace window is ignored", rotatedAgo: time.Hour, wantEnded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, db := newTestAuthService(t)
+			oldToken, err := s.createSession(newTestUser(t, s, "a@example.com"), "192.0.2.1", "test")
+			if err != nil {
+				t.Fatalf("createSession: %v", err)
+			}
+			session, err := s.SessionDB.GetByToken(oldToken)
+			if err != nil || session == nil {
+				t.Fatalf("GetByToken = %v, %v", session, err)
+			}
+			newToken, _ := models.GenerateSessionToken()
+			if ok, err := s.SessionDB.Rotate(session.ID, session.TokenHash, models.HashToken(newToken)); !ok || err != nil {
+				t.Fatalf("Rotate = %t, %v", ok, err)
+			}
+			rotatedAt := time.Now().Add(-tt.rotatedAgo).UTC().Format("2006-01-02 15:04:05")
+			if _, err := db.Exec("UPDATE sessions SET rotated_at = ? WHERE id = ?", rotatedAt, session.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.Logout(oldToken); err != nil {
+				t.Fatalf("Logout: %v", err)
+			}
+			user, err := s.ValidateSession(newToken)
+			if err != nil {
+				t.Fatalf("ValidateSession: %v", err)
+			}
+			if ended := user == nil; ended != tt.wantEnded {
+				t.Errorf("session ended = %t, want %t", ended, tt.wantEnded)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrMissing is returned when a submission carries no _telemetry object
+	ErrMissing = errors.New("telemetry missing")
+	// ErrMalformed is returned when the _telemetry object cannot be decoded
+	ErrMalformed = errors.New("telemetry malformed")
+	// ErrUnsigned is returned when the envelope has an empty signature (non-secure context)
+	ErrUnsigned = errors.New("telemetry unsigned")
+	// ErrNoKey is returned when no signing key is bound to the request
+	ErrNoKey = errors.New("telemetry signing key unavailable")
+	// ErrInvalidSignature is returned when the HMAC does not match the envelope
+	ErrInvalidSignature = errors.New("telemetry signature mismatch")
+	// ErrKeyMismatch is returned when the signed key ID names a different key from the one that verified
+	ErrKeyMismatch = errors.New("telemetry key id mismatch")
+	// ErrNoKeyID is returned when a signed envelope does not embed the ID of its key
+	ErrNoKeyID = errors.New("telemetry key id missing")
+	// ErrStale is returned when issuedAt falls outside the accepted window
+	ErrStale = errors.New("telemetry envelope stale")
+	// ErrReplayed is returned when an envelope nonce has already been accepted
+	ErrReplayed = errors.New("telemetry envelope replayed")
+)
+
+// EnvironmentalSignals is the environment snapshot signed by <secure-telemetry-provider>.
+type EnvironmentalSignals struct {
+	WebdriverDetected        bool   `json:"webdriverDetected"`
+	HeadlessDetected         bool   `json:"headlessDetected"`
+	DomMutationDetected      bool   `json:"domMutationDetected"`
+	InjectedScriptCount      int    `json:"injectedScriptCount"`
+	SuspiciousScreenSize     bool   `json:"suspiciousScreenSize"`
+	PointerType              string `json:"pointerType"`
+	MouseMovementDetected    bool   `json:"mouseMovementDetected"`
+	KeyboardActivityDetected bool   `json:"keyboardActivityDetected"`
+	PageLoadToFirstKeystroke int    `json:"pageLoadToFirstKeystroke"`
+	LoadToSubmit             int    `json:"loadToSubmit"`
+	// KeyID is the signing key epoch the page was rendered with. It is added by
+	// the page when it re-signs the snapshot, so it is covered by the signature;
+	// signed envelopes without it are rejected.
+	KeyID string `json:"keyId,omitempty"`
+}
+
+// Envelope is the signed part of the payload (detail.telemetry._env).
+// Environment is kept as the raw bytes sent by the browser: the HMAC is computed
+// over JSON.stringify output, so re-marshalling a Go struct would not reproduce it.
+type Envelope struct {
+	Nonce       string          `json:"nonce"`
+	IssuedAt    string          `json:"issuedAt"`
+	Environment json.RawMessage `json:"environment"`
+	Signature   string          `json:"signature"`
+}
+
+// SignedPayload returns the exact byte string the client signed:
+// nonce + "." + issuedAt + "." + JSON(environment)
+func (e *Envelope) SignedPayload() []byte {
+	b := make([]byte, 0, len(e.Nonce)+len(e.IssuedAt)+len(e.Environment)+2)
+	b = append(b, e.Nonce...)
+	b = append(b, '.')
+	b = append(b, e.IssuedAt...)
+	b = append(b, '.')
+	b = append(b, e.Environment...)
+	return b
+}
+
+// FieldSignals holds the per-field behavioral metrics reported by secure-form.
+type FieldSignals struct {
+	FieldName         string  `json:"fieldName"`
+	FieldType         string  `json:"fieldType"`
+	Dwell             int     `json:"dwell"`
+	CompletionTime    int     `json:"completionTime"`
+	Velocity          float64 `json:"velocity"`
+	Corrections       int     `json:"corrections"`
+	PasteDetected     bool    `json:"pasteDetected"`
+	AutofillDetected  bool    `json:"autofillDetected"`
+	FocusCount        int     `json:"focusCount"`
+	BlurWithoutChange int     `json:"blurWithoutChange"`
+}
+
+// Payload is the full _telemetry object attached to a form submission.
+// Only Env is covered by the signature; the remaining fields are client-computed
+// and must be treated as untrusted input.
+type Payload struct {
+	SubmittedAt     string         `json:"submittedAt"`
+	SessionDuration int            `json:"sessionDuration"`
+	FieldCount      int            `json:"fieldCount"`
+	RiskScore       int            `json:"riskScore"`
+	RiskSignals     []string       `json:"riskSignals"`
+	Fields          []FieldSignals `json:"fields"`
+	Env             *Envelope      `json:"_env"`
+}
+
+// Parse decodes a raw _telemetry value.
+// Returns ErrMissing for an absent or null value and ErrMalformed for invalid JSON.
+func Parse(raw json.RawMessage) (*Payload, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ErrMissing
+	}
+	p := &Payload{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return p, nil
+}
+
+// parseIssuedAt accepts the ISO 8601 forms produced by Date.prototype.toISOString
+func parseIssuedAt(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid issuedAt %q", ErrMalformed, value)
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultKeyRotation is how often per-visitor signing keys roll over
+	DefaultKeyRotation = 1 * time.Hour
+	// keyInfoPrefix domain-separates telemetry keys from any other use of the master secret
+	keyInfoPrefix = "secure-ui telemetry signing key v1|"
+)
+
+// ErrNoVisitor is returned when a signing key is requested without a visitor ID
+var ErrNoVisitor = errors.New("telemetry visitor id required")
+
+// SigningKey is a derived HMAC key handed to <secure-telemetry-provider>.
+// ID names the rotation epoch the key belongs to; Secret is the hex string the
+// browser uses verbatim as HMAC key material.
+type SigningKey struct {
+	ID     string
+	Secret string
+}
+
+// KeyManager derives per-visitor telemetry signing keys from a server master secret
+// with HKDF-SHA-256. Keys are never stored: the same visitor ID and epoch always
+// derive the same key, so every tab a visitor opens signs with a key the server can
+// recompute. Epochs advance every rotation period and the previous epoch stays valid,
+// so a page rendered just before a rollover can still submit.
+type KeyManager struct {
+	master   []byte
+	rotation time.Duration
+}
+
+// NewKeyManager creates a new KeyManager.
+// rotation controls the key lifetime; pass 0 to use DefaultKeyRotation.
+func NewKeyManager(master []byte, rotation time.Duration) *KeyManager {
+	if rotation < time.Second {
+		rotation = DefaultKeyRotation
+	}
+	return &KeyManager{master: master, rotation: rotation}
+}
+
+// Current returns the visitor's signing key for the current epoch
+func (m *KeyManager) Current(visitorID string) (SigningKey, error) {
+	return m.derive(visitorID, m.epoch(time.Now()))
+}
+
+// Candidates returns the keys a submission from visitorID may have been signed with:
+// the current epoch, then the previous one.
+func (m *KeyManager) Candidates(visitorID string) []SigningKey {
+	if visitorID == "" {
+		return nil
+	}
+	current := m.epoch(time.Now())
+	epochs := []int64{current, current - 1}
+
+	keys := make([]SigningKey, 0, len(epochs))
+	for _, e := range epochs {
+		k, err := m.derive(visitorID, e)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// epoch returns the rotation period number containing t
+func (m *KeyManager) epoch(t time.Time) int64 {
+	return t.Unix() / int64(m.rotation/time.Second)
+}
+
+// derive computes the key for a visitor in a given epoch
+func (m *KeyManager) derive(visitorID string, epoch int64) (SigningKey, error) {
+	if visitorID == "" {
+		return SigningKey{}, ErrNoVisitor
+	}
+	id := strconv.FormatInt(epoch, 10)
+	key, err := hkdf.Key(sha256.New, m.master, []byte(id), keyInfoPrefix+visitorID, 32)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("failed to derive telemetry key: %w", err)
+	}
+	return SigningKey{ID: id, Secret: hex.EncodeToString(key)}, nil
+}
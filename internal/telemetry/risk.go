@@ -0,0 +1,303 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Action is the decision derived from a risk score
+type Action string
+
+const (
+	ActionAllow     Action = "allow"
+	ActionChallenge Action = "challenge"
+	ActionBlock     Action = "block"
+)
+
+// RiskRules configures the weight of each signal and the decision thresholds.
+// A weight of 0 disables the corresponding rule.
+type RiskRules struct {
+	// Environment (covered by the envelope signature)
+	WebdriverWeight        int `json:"webdriverWeight"`
+	HeadlessWeight         int `json:"headlessWeight"`
+	DomMutationWeight      int `json:"domMutationWeight"`
+	InjectedScriptWeight   int `json:"injectedScriptWeight"`
+	SuspiciousScreenWeight int `json:"suspiciousScreenWeight"`
+	NoPointerWeight        int `json:"noPointerWeight"`
+	NoKeyboardWeight       int `json:"noKeyboardWeight"`
+
+	// Envelope trust
+	UnsignedWeight int `json:"unsignedWeight"`
+	MissingWeight  int `json:"missingWeight"`
+
+	// Per-field behavior (client-reported, not signed)
+	FastSubmitWeight   int     `json:"fastSubmitWeight"`
+	FastSubmitMs       int     `json:"fastSubmitMs"`
+	LowDwellWeight     int     `json:"lowDwellWeight"`
+	MinDwellMs         int     `json:"minDwellMs"`
+	HighVelocityWeight int     `json:"highVelocityWeight"`
+	MaxVelocity        float64 `json:"maxVelocity"` // characters per second
+	PasteWeight        int     `json:"pasteWeight"`
+	PasteSensitiveOnly bool    `json:"pasteSensitiveOnly"` // only score paste on password/email fields
+	AutofillWeight     int     `json:"autofillWeight"`
+
+	// Decision thresholds (score is clamped to 0–100)
+	ChallengeThreshold int `json:"challengeThreshold"`
+	BlockThreshold     int `json:"blockThreshold"`
+}
+
+// DefaultRiskRules mirrors the client-side scoring in <secure-telemetry-provider>:
+// 30+ is reviewed, 60+ is blocked.
+func DefaultRiskRules() RiskRules {
+	return RiskRules{
+		WebdriverWeight:        50,
+		HeadlessWeight:         40,
+		DomMutationWeight:      10,
+		InjectedScriptWeight:   15,
+		SuspiciousScreenWeight: 15,
+		NoPointerWeight:        10,
+		NoKeyboardWeight:       15,
+
+		UnsignedWeight: 10,
+		MissingWeight:  15,
+
+		FastSubmitWeight:   30,
+		FastSubmitMs:       1500,
+		LowDwellWeight:     15,
+		MinDwellMs:         100,
+		HighVelocityWeight: 20,
+		MaxVelocity:        15,
+		PasteWeight:        15,
+		PasteSensitiveOnly: true,
+		AutofillWeight:     0,
+
+		ChallengeThreshold: 30,
+		BlockThreshold:     60,
+	}
+}
+
+// LoadRiskRules reads rules from a JSON object at path, for example:
+//
+//	{"webdriverWeight": 60, "pasteWeight": 0, "blockThreshold": 70}
+//
+// Fields that are left out keep their DefaultRiskRules value; unknown fields are
+// an error so a misspelt weight is not silently ignored. The result is validated.
+func LoadRiskRules(path string) (RiskRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RiskRules{}, fmt.Errorf("failed to read risk rules: %w", err)
+	}
+	defer f.Close()
+
+	rules := DefaultRiskRules()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return RiskRules{}, fmt.Errorf("failed to parse risk rules: %w", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return RiskRules{}, err
+	}
+	return rules, nil
+}
+
+// Validate checks that every weight and threshold is within 0–100, that the
+// limits behind enabled rules are positive, and that challenging starts below blocking.
+func (r RiskRules) Validate() error {
+	for _, w := range []struct {
+		name  string
+		value int
+	}{
+		{"webdriverWeight", r.WebdriverWeight},
+		{"headlessWeight", r.HeadlessWeight},
+		{"domMutationWeight", r.DomMutationWeight},
+		{"injectedScriptWeight", r.InjectedScriptWeight},
+		{"suspiciousScreenWeight", r.SuspiciousScreenWeight},
+		{"noPointerWeight", r.NoPointerWeight},
+		{"noKeyboardWeight", r.NoKeyboardWeight},
+		{"unsignedWeight", r.UnsignedWeight},
+		{"missingWeight", r.MissingWeight},
+		{"fastSubmitWeight", r.FastSubmitWeight},
+		{"lowDwellWeight", r.LowDwellWeight},
+		{"highVelocityWeight", r.HighVelocityWeight},
+		{"pasteWeight", r.PasteWeight},
+		{"autofillWeight", r.AutofillWeight},
+		{"challengeThreshold", r.ChallengeThreshold},
+		{"blockThreshold", r.BlockThreshold},
+	} {
+		if w.value < 0 || w.value > 100 {
+			return fmt.Errorf("risk rules: %s must be between 0 and 100, got %d", w.name, w.value)
+		}
+	}
+	switch {
+	case r.FastSubmitWeight > 0 && r.FastSubmitMs <= 0:
+		return errors.New("risk rules: fastSubmitMs must be positive when fastSubmitWeight is set")
+	case r.LowDwellWeight > 0 && r.MinDwellMs <= 0:
+		return errors.New("risk rules: minDwellMs must be positive when lowDwellWeight is set")
+	case r.HighVelocityWeight > 0 && r.MaxVelocity <= 0:
+		return errors.New("risk rules: maxVelocity must be positive when highVelocityWeight is set")
+	case r.ChallengeThreshold > 0 && r.BlockThreshold > 0 && r.ChallengeThreshold >= r.BlockThreshold:
+		return fmt.Errorf("risk rules: challengeThreshold (%d) must be below blockThreshold (%d)",
+			r.ChallengeThreshold, r.BlockThreshold)
+	}
+	return nil
+}
+
+// Assessment is the server-side risk verdict for a single submission
+type Assessment struct {
+	Score   int      `json:"score"`
+	Reasons []string `json:"reasons"`
+	Action  Action   `json:"action"`
+}
+
+// RiskEngine scores verified telemetry against a set of RiskRules.
+// The client-reported riskScore is never trusted; every score is recomputed here.
+type RiskEngine struct {
+	rules RiskRules
+}
+
+// NewRiskEngine creates a new RiskEngine with the given rules
+func NewRiskEngine(rules RiskRules) *RiskEngine {
+	return &RiskEngine{rules: rules}
+}
+
+// Rules returns the engine's configured rules
+func (e *RiskEngine) Rules() RiskRules {
+	return e.rules
+}
+
+// Assess scores a verification result. A nil result is scored as missing telemetry;
+// a rejected result (tampered, stale or replayed) is always blocked.
+func (e *RiskEngine) Assess(res *Result) *Assessment {
+	a := &Assessment{Reasons: []string{}}
+	rules := e.rules
+
+	if res.Rejected() {
+		a.Score = 100
+		a.Reasons = append(a.Reasons, "telemetry_"+string(res.Status))
+		a.Action = ActionBlock
+		return a
+	}
+
+	if res == nil || res.Status == StatusMissing {
+		a.add(rules.MissingWeight, "telemetry_missing")
+		return e.decide(a)
+	}
+	if res.Status == StatusUnsigned {
+		a.add(rules.UnsignedWeight, "telemetry_unsigned")
+	}
+
+	env := res.Environment
+	if env.WebdriverDetected {
+		a.add(rules.WebdriverWeight, "webdriver_detected")
+	}
+	if env.HeadlessDetected {
+		a.add(rules.HeadlessWeight, "headless_browser")
+	}
+	if env.DomMutationDetected {
+		a.add(rules.DomMutationWeight, "dom_mutation")
+	}
+	if env.InjectedScriptCount > 0 {
+		a.add(rules.InjectedScriptWeight, "injected_scripts")
+	}
+	if env.SuspiciousScreenSize {
+		a.add(rules.SuspiciousScreenWeight, "suspicious_screen_size")
+	}
+	if !env.MouseMovementDetected && (env.PointerType == "" || env.PointerType == "none") {
+		a.add(rules.NoPointerWeight, "no_pointer_activity")
+	}
+	if !env.KeyboardActivityDetected {
+		a.add(rules.NoKeyboardWeight, "no_keyboard_activity")
+	}
+
+	if p := res.Payload; p != nil {
+		e.scoreFields(a, p)
+	}
+
+	return e.decide(a)
+}
+
+// scoreFields applies the per-field behavioral rules
+func (e *RiskEngine) scoreFields(a *Assessment, p *Payload) {
+	rules := e.rules
+
+	if rules.FastSubmitMs > 0 && p.SessionDuration > 0 && p.SessionDuration < rules.FastSubmitMs {
+		a.add(rules.FastSubmitWeight, "fast_completion")
+	}
+
+	var lowDwell, fastTyping, pasted, autofilled bool
+	for _, f := range p.Fields {
+		if rules.MinDwellMs > 0 && f.Dwell > 0 && f.Dwell < rules.MinDwellMs && !f.AutofillDetected {
+			lowDwell = true
+		}
+		if rules.MaxVelocity > 0 && f.Velocity > rules.MaxVelocity && !f.PasteDetected && !f.AutofillDetected {
+			fastTyping = true
+		}
+		if f.PasteDetected && (!rules.PasteSensitiveOnly || isSensitiveField(f)) {
+			pasted = true
+		}
+		if f.AutofillDetected {
+			autofilled = true
+		}
+	}
+
+	// Each behavioral rule fires at most once per submission so that
+	// long forms are not penalised simply for having more fields.
+	if lowDwell {
+		a.add(rules.LowDwellWeight, "low_dwell_time")
+	}
+	if fastTyping {
+		a.add(rules.HighVelocityWeight, "high_typing_velocity")
+	}
+	if pasted {
+		a.add(rules.PasteWeight, "paste_detected")
+	}
+	if autofilled {
+		a.add(rules.AutofillWeight, "autofill_detected")
+	}
+}
+
+// decide clamps the score and maps it to an action
+func (e *RiskEngine) decide(a *Assessment) *Assessment {
+	if a.Score > 100 {
+		a.Score = 100
+	}
+	switch {
+	case e.rules.BlockThreshold > 0 && a.Score >= e.rules.BlockThreshold:
+		a.Action = ActionBlock
+	case e.rules.ChallengeThreshold > 0 && a.Score >= e.rules.ChallengeThreshold:
+		a.Action = ActionChallenge
+	default:
+		a.Action = ActionAllow
+	}
+	return a
+}
+
+// add records a triggered rule; rules with zero weight are ignored entirely
+func (a *Assessment) add(weight int, reason string) {
+	if weight == 0 {
+		return
+	}
+	a.Score += weight
+	a.Reasons = append(a.Reasons, reason)
+}
+
+// isSensitiveField reports whether pasting into a field is worth scoring
+func isSensitiveField(f FieldSignals) bool {
+	t := strings.ToLower(f.FieldType)
+	return t == "password" || t == "email"
+}
+
+// LogAssessment writes a single structured log line for a scored submission
+func LogAssessment(form, ip string, res *Result, a *Assessment) {
+	status := StatusMissing
+	if res != nil {
+		status = res.Status
+	}
+	log.Printf("[RISK] form=%s ip=%s telemetry=%s score=%d action=%s reasons=%s",
+		form, ip, status, a.Score, a.Action, strings.Join(a.Reasons, ","))
+}
@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRiskRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{name: "overrides merge over defaults", json: `{"webdriverWeight": 60, "pasteWeight": 0}`},
+		{name: "empty object keeps defaults", json: `{}`},
+		{name: "unknown field", json: `{"webdriverWieght": 60}`, wantErr: true},
+		{name: "negative weight", json: `{"headlessWeight": -5}`, wantErr: true},
+		{name: "weight above 100", json: `{"missingWeight": 150}`, wantErr: true},
+		{name: "challenge not below block", json: `{"challengeThreshold": 60, "blockThreshold": 60}`, wantErr: true},
+		{name: "enabled rule without its limit", json: `{"fastSubmitMs": 0}`, wantErr: true},
+		{name: "not json", json: `webdriverWeight=60`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := LoadRiskRules(writeRules(t, tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadRiskRules() err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rules.HeadlessWeight != DefaultRiskRules().HeadlessWeight {
+				t.Errorf("HeadlessWeight = %d, want the default", rules.HeadlessWeight)
+			}
+		})
+	}
+
+	rules, err := LoadRiskRules(writeRules(t, `{"webdriverWeight": 60, "pasteWeight": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.WebdriverWeight != 60 || rules.PasteWeight != 0 {
+		t.Errorf("rules = %+v, want webdriverWeight 60 and pasteWeight 0", rules)
+	}
+}
+
+func TestDefaultRiskRulesValid(t *testing.T) {
+	if err := DefaultRiskRules().Validate(); err != nil {
+		t.Errorf("DefaultRiskRules().Validate() = %v", err)
+	}
+}
+
+func writeRules(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "risk.json")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
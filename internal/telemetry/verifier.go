@@ -0,0 +1,228 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxAge is how long after issuedAt an envelope is accepted
+	DefaultMaxAge = 10 * time.Minute
+	// maxClockSkew tolerates client clocks running ahead of the server
+	maxClockSkew = 1 * time.Minute
+)
+
+// Status classifies the outcome of verifying a _telemetry payload
+type Status string
+
+const (
+	StatusVerified  Status = "verified"
+	StatusUnsigned  Status = "unsigned"
+	StatusMissing   Status = "missing"
+	StatusMalformed Status = "malformed"
+	StatusInvalid   Status = "invalid"
+	StatusStale     Status = "stale"
+	StatusReplayed  Status = "replayed"
+)
+
+// Result is the typed outcome of Verify.
+// Payload is populated whenever the JSON could be decoded, even if verification failed,
+// so callers can still log client-reported signals for rejected submissions.
+type Result struct {
+	Status      Status
+	Payload     *Payload
+	Environment EnvironmentalSignals
+	IssuedAt    time.Time
+	KeyID       string // epoch of the key that verified the signature
+	Err         error
+}
+
+// Verified reports whether the envelope signature, freshness and nonce all checked out
+func (r *Result) Verified() bool {
+	return r != nil && r.Status == StatusVerified
+}
+
+// Rejected reports whether the payload shows evidence of tampering or replay.
+// Missing and unsigned payloads are low-trust but not rejected: SubtleCrypto
+// is unavailable on http:// and scripted clients may omit telemetry entirely.
+func (r *Result) Rejected() bool {
+	if r == nil {
+		return false
+	}
+	switch r.Status {
+	case StatusMalformed, StatusInvalid, StatusStale, StatusReplayed:
+		return true
+	}
+	return false
+}
+
+// Verifier checks signed telemetry envelopes and remembers accepted nonces
+// so each envelope can only be used once within its validity window.
+type Verifier struct {
+	nonces map[string]time.Time
+	mu     sync.Mutex
+	maxAge time.Duration
+}
+
+// NewVerifier creates a new Verifier.
+// maxAge bounds how old an envelope may be; pass 0 to use DefaultMaxAge.
+// The cleanup goroutine stops when ctx is cancelled.
+func NewVerifier(ctx context.Context, maxAge time.Duration) *Verifier {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	v := &Verifier{
+		nonces: make(map[string]time.Time),
+		maxAge: maxAge,
+	}
+
+	go v.cleanupExpiredNonces(ctx)
+
+	return v
+}
+
+// Verify parses a raw _telemetry value and checks it against each candidate key in turn.
+// A signed envelope must embed the ID of the key that verifies it.
+// The nonce is only recorded once the signature has been verified, so forged
+// envelopes cannot be used to burn nonces belonging to legitimate submissions.
+func (v *Verifier) Verify(raw json.RawMessage, keys ...SigningKey) *Result {
+	payload, err := Parse(raw)
+	if err != nil {
+		if errors.Is(err, ErrMissing) {
+			return &Result{Status: StatusMissing, Err: err}
+		}
+		return &Result{Status: StatusMalformed, Err: err}
+	}
+
+	res := &Result{Payload: payload}
+	env := payload.Env
+	if env == nil {
+		res.Status, res.Err = StatusMissing, ErrMissing
+		return res
+	}
+
+	if len(env.Environment) > 0 {
+		if err := json.Unmarshal(env.Environment, &res.Environment); err != nil {
+			res.Status, res.Err = StatusMalformed, ErrMalformed
+			return res
+		}
+	}
+
+	if env.Signature == "" {
+		res.Status, res.Err = StatusUnsigned, ErrUnsigned
+		return res
+	}
+	if len(keys) == 0 {
+		res.Status, res.Err = StatusUnsigned, ErrNoKey
+		return res
+	}
+	if env.Nonce == "" {
+		res.Status, res.Err = StatusMalformed, ErrMalformed
+		return res
+	}
+
+	issuedAt, err := parseIssuedAt(env.IssuedAt)
+	if err != nil {
+		res.Status, res.Err = StatusMalformed, err
+		return res
+	}
+	res.IssuedAt = issuedAt
+
+	for _, k := range keys {
+		if checkSignature(env, []byte(k.Secret)) {
+			res.KeyID = k.ID
+			break
+		}
+	}
+	if res.KeyID == "" {
+		res.Status, res.Err = StatusInvalid, ErrInvalidSignature
+		return res
+	}
+	switch {
+	case res.Environment.KeyID == "":
+		res.Status, res.Err = StatusInvalid, ErrNoKeyID
+		return res
+	case res.Environment.KeyID != res.KeyID:
+		res.Status, res.Err = StatusInvalid, ErrKeyMismatch
+		return res
+	}
+
+	now := time.Now()
+	if now.Sub(issuedAt) > v.maxAge || issuedAt.Sub(now) > maxClockSkew {
+		res.Status, res.Err = StatusStale, ErrStale
+		return res
+	}
+
+	if !v.rememberNonce(env.Nonce, issuedAt.Add(v.maxAge+maxClockSkew)) {
+		res.Status, res.Err = StatusReplayed, ErrReplayed
+		return res
+	}
+
+	res.Status = StatusVerified
+	return res
+}
+
+// checkSignature recomputes the HMAC-SHA-256 and compares in constant time
+func checkSignature(env *Envelope, key []byte) bool {
+	sig, err := hex.DecodeString(env.Signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(env.SignedPayload())
+	return hmac.Equal(mac.Sum(nil), sig)
+}
+
+// rememberNonce atomically records a nonce; returns false if it was already seen
+func (v *Verifier) rememberNonce(nonce string, expiry time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if existing, seen := v.nonces[nonce]; seen && time.Now().Before(existing) {
+		return false
+	}
+	v.nonces[nonce] = expiry
+	return true
+}
+
+// cleanupExpiredNonces removes nonces past their validity window until ctx is cancelled
+func (v *Verifier) cleanupExpiredNonces(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			v.mu.Lock()
+			for nonce, expiry := range v.nonces {
+				if now.After(expiry) {
+					delete(v.nonces, nonce)
+				}
+			}
+			v.mu.Unlock()
+		}
+	}
+}
+
+// resultKey is a private type for the verification result context key
+type resultKey struct{}
+
+// NewContext returns a copy of ctx carrying the verification result
+func NewContext(ctx context.Context, res *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, res)
+}
+
+// FromContext returns the verification result stored in ctx, or nil
+func FromContext(ctx context.Context) *Result {
+	res, _ := ctx.Value(resultKey{}).(*Result)
+	return res
+}
@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedPayload returns a _telemetry value signed with key the way
+// <secure-telemetry-provider> signs it
+func signedPayload(t *testing.T, key SigningKey, nonce string, env map[string]any) json.RawMessage {
+	t.Helper()
+	environment, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Envelope{Nonce: nonce, IssuedAt: time.Now().UTC().Format(time.RFC3339Nano), Environment: environment}
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	mac.Write(e.SignedPayload())
+	e.Signature = hex.EncodeToString(mac.Sum(nil))
+	raw, err := json.Marshal(Payload{Env: e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestVerifyKeyID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	v := NewVerifier(ctx, time.Minute)
+	keys := NewKeyManager([]byte("master secret"), time.Hour).Candidates("visitor")
+	current, previous := keys[0], keys[1]
+
+	tests := []struct {
+		name    string
+		signer  SigningKey
+		env     map[string]any
+		want    Status
+		wantErr error
+	}{
+		{name: "signed without an id", signer: current, env: map[string]any{}, want: StatusInvalid, wantErr: ErrNoKeyID},
+		{name: "id of the signing key", signer: current, env: map[string]any{"keyId": current.ID}, want: StatusVerified},
+		{name: "previous epoch with its id", signer: previous, env: map[string]any{"keyId": previous.ID}, want: StatusVerified},
+		{name: "id of another epoch", signer: previous, env: map[string]any{"keyId": current.ID}, want: StatusInvalid, wantErr: ErrKeyMismatch},
+		{name: "id of no candidate", signer: current, env: map[string]any{"keyId": "1"}, want: StatusInvalid, wantErr: ErrKeyMismatch},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := v.Verify(signedPayload(t, tt.signer, "nonce-"+strconv.Itoa(i), tt.env), keys...)
+			if res.Status != tt.want || !errors.Is(res.Err, tt.wantErr) {
+				t.Errorf("Verify = %s, %v; want %s, %v", res.Status, res.Err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053, RFC 8812)
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// COSE key types and curves
+const (
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// minRSABits rejects RSA keys too short to be trusted
+const minRSABits = 2048
+
+// publicKey verifies assertion signatures for one COSE algorithm
+type publicKey struct {
+	alg int64
+	ec  *ecdsa.PublicKey
+	ed  ed25519.PublicKey
+	rsa *rsa.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and checks it is one of the algorithms
+// offered in the creation options
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(raw)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", ErrUnsupportedKey)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == algES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad P-256 key", ErrUnsupportedKey)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: point not on curve", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, ec: pub}, nil
+
+	case kty == ktyOKP && alg == algEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad Ed25519 key", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, ed: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == algRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad RSA exponent", ErrUnsupportedKey)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < minRSABits || pub.E < 3 {
+			return nil, fmt.Errorf("%w: weak RSA key", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, rsa: pub}, nil
+	}
+	return nil, fmt.Errorf("%w: kty %d alg %d", ErrUnsupportedKey, kty, alg)
+}
+
+// verify checks sig over data
+func (k *publicKey) verify(data, sig []byte) error {
+	switch k.alg {
+	case algES256:
+		digest := sha256.Sum256(data)
+		if ecdsa.VerifyASN1(k.ec, digest[:], sig) {
+			return nil
+		}
+	case algEdDSA:
+		if ed25519.Verify(k.ed, data, sig) {
+			return nil
+		}
+	case algRS256:
+		digest := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	}
+	return ErrSignature
+}
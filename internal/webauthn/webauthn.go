@@ -0,0 +1,430 @@
+// Package webauthn implements the relying-party side of WebAuthn passkey
+// registration and authentication.
+//
+// Only "none" attestation is accepted: the server trusts the public key it is
+// handed at registration rather than the authenticator's make and model. That
+// is the right choice for consumer passkeys, which are synced between devices
+// and usually cannot attest anyway.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Verification errors. Every failure wraps one of these so callers can log the
+// reason without exposing it to the client.
+var (
+	ErrMalformed          = errors.New("malformed webauthn response")
+	ErrCeremony           = errors.New("unexpected ceremony type")
+	ErrChallenge          = errors.New("unknown or expired challenge")
+	ErrOrigin             = errors.New("origin not allowed")
+	ErrRPID               = errors.New("relying party id mismatch")
+	ErrUserPresence       = errors.New("user presence not asserted")
+	ErrUserVerification   = errors.New("user verification not performed")
+	ErrAttestationFormat  = errors.New("unsupported attestation format")
+	ErrUnsupportedKey     = errors.New("unsupported credential public key")
+	ErrSignature          = errors.New("invalid assertion signature")
+	ErrSignCountRegressed = errors.New("signature counter did not increase")
+)
+
+// Authenticator data flags (WebAuthn §6.1)
+const (
+	flagUserPresent       = 0x01
+	flagUserVerified      = 0x04
+	flagAttestedCredData  = 0x40
+	flagExtensionDataSent = 0x80
+)
+
+// DefaultTimeout is how long the browser lets the user complete a ceremony
+const DefaultTimeout = 5 * time.Minute
+
+// RelyingParty describes this site to authenticators. ID is the registrable
+// domain credentials are scoped to (e.g. "example.com"); Origins lists every
+// exact origin ("https://example.com") the ceremonies may run on.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	Timeout time.Duration
+}
+
+// URLBytes is a byte slice carried in JSON as unpadded base64url, the encoding
+// WebAuthn's JSON serialization uses for binary fields
+type URLBytes []byte
+
+// MarshalJSON encodes b as unpadded base64url
+func (b URLBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url with or without padding
+func (b *URLBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	*b = decoded
+	return nil
+}
+
+// UserEntity identifies the account a credential is created for. ID is an
+// opaque user handle and must not contain personal information.
+type UserEntity struct {
+	ID          URLBytes `json:"id"`
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName"`
+}
+
+// CredentialDescriptor names an existing credential
+type CredentialDescriptor struct {
+	Type string   `json:"type"`
+	ID   URLBytes `json:"id"`
+}
+
+// CredentialParameter is one acceptable public key algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// AuthenticatorSelection constrains which authenticators may register
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// RelyingPartyEntity is the rp member of the creation options
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CreationOptions is the JSON form of PublicKeyCredentialCreationOptions
+type CreationOptions struct {
+	Challenge              URLBytes               `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is the JSON form of PublicKeyCredentialRequestOptions.
+// AllowCredentials is left empty so the authenticator offers any discoverable
+// passkey for this site and the user never has to type an identifier.
+type RequestOptions struct {
+	Challenge        URLBytes               `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.create()
+type RegistrationResponse struct {
+	ID       string   `json:"id"`
+	RawID    URLBytes `json:"rawId"`
+	Type     string   `json:"type"`
+	Response struct {
+		ClientDataJSON    URLBytes `json:"clientDataJSON"`
+		AttestationObject URLBytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string   `json:"id"`
+	RawID    URLBytes `json:"rawId"`
+	Type     string   `json:"type"`
+	Response struct {
+		ClientDataJSON    URLBytes `json:"clientDataJSON"`
+		AuthenticatorData URLBytes `json:"authenticatorData"`
+		Signature         URLBytes `json:"signature"`
+		UserHandle        URLBytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered passkey. PublicKey is the COSE_Key exactly
+// as the authenticator produced it.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// ChallengeFunc reports whether challenge was issued by this server and is
+// still valid. It should consume the challenge so it cannot be replayed.
+type ChallengeFunc func(challenge []byte) bool
+
+// CreationOptions builds the options for navigator.credentials.create().
+// exclude lists the user's existing credential IDs so an authenticator that
+// already holds one is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude [][]byte) *CreationOptions {
+	excluded := make([]CredentialDescriptor, 0, len(exclude))
+	for _, id := range exclude {
+		excluded = append(excluded, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return &CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: algES256},
+			{Type: "public-key", Alg: algEdDSA},
+			{Type: "public-key", Alg: algRS256},
+		},
+		Timeout:            rp.timeout().Milliseconds(),
+		ExcludeCredentials: excluded,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions builds the options for navigator.credentials.get()
+func (rp *RelyingParty) RequestOptions(challenge []byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          rp.timeout().Milliseconds(),
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+// VerifyRegistration checks a registration response and returns the new
+// credential. The challenge is checked (and consumed) before anything else is
+// parsed, so a response is only ever accepted once.
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge ChallengeFunc) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: credential type %q", ErrMalformed, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attObj, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrMalformed, err)
+	}
+	att, ok := attObj.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrMalformed)
+	}
+	format, _ := att["fmt"].(string)
+	if format != "none" {
+		return nil, fmt.Errorf("%w: %q", ErrAttestationFormat, format)
+	}
+	if stmt, ok := att["attStmt"].(map[any]any); !ok || len(stmt) != 0 {
+		return nil, fmt.Errorf("%w: none attestation with a statement", ErrAttestationFormat)
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrMalformed)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrMalformed)
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, authData.credentialID) {
+		return nil, fmt.Errorf("%w: rawId does not match attested credential", ErrMalformed)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks an authentication response against the stored
+// credential's COSE public key and signature counter and returns the new
+// counter. A counter that fails to increase (when either side is non-zero)
+// suggests a cloned authenticator and is rejected.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, publicKey []byte, signCount uint32, challenge ChallengeFunc) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: credential type %q", ErrMalformed, resp.Type)
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(slices.Clip(resp.Response.AuthenticatorData), clientDataHash[:]...)
+	if err := key.verify(signed, resp.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, fmt.Errorf("%w: stored %d, received %d", ErrSignCountRegressed, signCount, authData.signCount)
+	}
+	return authData.signCount, nil
+}
+
+// clientData is the subset of CollectedClientData the server checks
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData checks the ceremony type, origin and challenge
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge ChallengeFunc) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrMalformed, err)
+	}
+	if cd.Type != ceremony {
+		return fmt.Errorf("%w: %q", ErrCeremony, cd.Type)
+	}
+	if cd.CrossOrigin || !rp.allowedOrigin(cd.Origin) {
+		return fmt.Errorf("%w: %q", ErrOrigin, cd.Origin)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || len(decoded) == 0 {
+		return fmt.Errorf("%w: challenge encoding", ErrMalformed)
+	}
+	if !challenge(decoded) {
+		return ErrChallenge
+	}
+	return nil
+}
+
+// allowedOrigin reports whether origin exactly matches a configured origin
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, o := range rp.Origins {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimRight(o, "/")), []byte(origin)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAuthenticatorData checks the RP ID hash and the presence and
+// verification flags; passkeys replace the password, so UV is mandatory
+func (rp *RelyingParty) verifyAuthenticatorData(ad *authenticatorData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, want[:]) != 1 {
+		return ErrRPID
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return ErrUserVerification
+	}
+	return nil
+}
+
+func (rp *RelyingParty) timeout() time.Duration {
+	if rp.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return rp.Timeout
+}
+
+// authenticatorData is a parsed authenticator data structure (WebAuthn §6.1)
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData splits raw authenticator data into its fields,
+// including the attested credential when the AT flag is set
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrMalformed)
+	}
+	ad := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if ad.flags&flagAttestedCredData != 0 {
+		// aaguid (16) || credentialIdLength (2) || credentialId || credentialPublicKey
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrMalformed)
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+			return nil, fmt.Errorf("%w: credential id length", ErrMalformed)
+		}
+		ad.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: credential public key: %v", ErrMalformed, err)
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if ad.flags&flagExtensionDataSent != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extensions: %v", ErrMalformed, err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrMalformed)
+	}
+	return ad, nil
+}
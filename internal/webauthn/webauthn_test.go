@@ -0,0 +1,156 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"secure-ui-showcase-go/internal/webauthn"
+	"secure-ui-showcase-go/internal/webauthn/webauthntest"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newRP() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: testRPID, Name: "Test", Origins: []string{testOrigin}}
+}
+
+// challenges issues single-use challenges like the server's store
+type challenges map[string]bool
+
+func (c challenges) issue(s string) []byte {
+	c[s] = true
+	return []byte(s)
+}
+
+func (c challenges) consume(challenge []byte) bool {
+	ok := c[string(challenge)]
+	delete(c, string(challenge))
+	return ok
+}
+
+// register enrols auth with rp and returns the stored credential
+func register(t *testing.T, rp *webauthn.RelyingParty, auth *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	ch := challenges{}
+	cred, err := rp.VerifyRegistration(auth.Register(ch.issue("reg"), []byte("handle")), ch.consume)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := newRP()
+	auth := webauthntest.New(testRPID, testOrigin)
+	cred := register(t, rp, auth)
+
+	if string(cred.ID) != string(auth.CredentialID) {
+		t.Fatalf("credential ID = %x, want %x", cred.ID, auth.CredentialID)
+	}
+
+	ch := challenges{}
+	count, err := rp.VerifyAssertion(auth.Assert(ch.issue("login")), cred.PublicKey, cred.SignCount, ch.consume)
+	if err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+	if count != auth.SignCount {
+		t.Errorf("sign count = %d, want %d", count, auth.SignCount)
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*webauthntest.Authenticator)
+		want   error
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example" }, webauthn.ErrOrigin},
+		{"wrong rpId hash", func(a *webauthntest.Authenticator) { a.RPID = "evil.example" }, webauthn.ErrRPID},
+		{"missing UV flag", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserPresent }, webauthn.ErrUserVerification},
+		{"missing UP flag", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserVerified }, webauthn.ErrUserPresence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := webauthntest.New(testRPID, testOrigin)
+			tt.tamper(auth)
+			ch := challenges{}
+			_, err := newRP().VerifyRegistration(auth.Register(ch.issue("reg"), []byte("handle")), ch.consume)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(*webauthntest.Authenticator)
+		want   error
+	}{
+		{"wrong origin", func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example" }, webauthn.ErrOrigin},
+		{"wrong rpId hash", func(a *webauthntest.Authenticator) { a.RPID = "evil.example" }, webauthn.ErrRPID},
+		{"missing UV flag", func(a *webauthntest.Authenticator) { a.Flags = webauthntest.FlagUserPresent }, webauthn.ErrUserVerification},
+		{"sign count goes backwards", func(a *webauthntest.Authenticator) { a.SignCount = 0 }, webauthn.ErrSignCountRegressed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newRP()
+			auth := webauthntest.New(testRPID, testOrigin)
+			cred := register(t, rp, auth)
+			// A stored counter ahead of the authenticator's
+			stored := cred.SignCount + 5
+			auth.SignCount = stored
+
+			tt.tamper(auth)
+			ch := challenges{}
+			_, err := rp.VerifyAssertion(auth.Assert(ch.issue("login")), cred.PublicKey, stored, ch.consume)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertionReplayedChallenge(t *testing.T) {
+	rp := newRP()
+	auth := webauthntest.New(testRPID, testOrigin)
+	cred := register(t, rp, auth)
+
+	ch := challenges{}
+	resp := auth.Assert(ch.issue("login"))
+	count, err := rp.VerifyAssertion(resp, cred.PublicKey, cred.SignCount, ch.consume)
+	if err != nil {
+		t.Fatalf("first VerifyAssertion: %v", err)
+	}
+	if _, err := rp.VerifyAssertion(resp, cred.PublicKey, count-1, ch.consume); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("replay err = %v, want %v", err, webauthn.ErrChallenge)
+	}
+}
+
+func TestAssertionWrongKey(t *testing.T) {
+	rp := newRP()
+	cred := register(t, rp, webauthntest.New(testRPID, testOrigin))
+
+	other := webauthntest.New(testRPID, testOrigin)
+	ch := challenges{}
+	if _, err := rp.VerifyAssertion(other.Assert(ch.issue("login")), cred.PublicKey, 0, ch.consume); !errors.Is(err, webauthn.ErrSignature) {
+		t.Errorf("err = %v, want %v", err, webauthn.ErrSignature)
+	}
+}
+
+func TestRegistrationReplayedChallenge(t *testing.T) {
+	rp := newRP()
+	auth := webauthntest.New(testRPID, testOrigin)
+	ch := challenges{}
+	resp := auth.Register(ch.issue("reg"), []byte("handle"))
+	if _, err := rp.VerifyRegistration(resp, ch.consume); err != nil {
+		t.Fatalf("first VerifyRegistration: %v", err)
+	}
+	if _, err := rp.VerifyRegistration(resp, ch.consume); !errors.Is(err, webauthn.ErrChallenge) {
+		t.Errorf("replay err = %v, want %v", err, webauthn.ErrChallenge)
+	}
+}
@@ -0,0 +1,195 @@
+// Package webauthntest provides a software authenticator for testing
+// relying-party code, in the way net/http/httptest provides a test server.
+// It produces the JSON responses a browser would send after
+// navigator.credentials.create() and get(), signed with an ES256 key.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"secure-ui-showcase-go/internal/webauthn"
+)
+
+// Authenticator flags (WebAuthn §6.1)
+const (
+	FlagUserPresent  byte = 0x01
+	FlagUserVerified byte = 0x04
+	flagAttested     byte = 0x40
+)
+
+// Authenticator is a passkey held in memory. Its exported fields describe the
+// next ceremony and may be changed between calls to simulate a misbehaving
+// or hostile client: Origin goes in the client data, RPID is hashed into the
+// authenticator data, and Flags are sent as they are.
+type Authenticator struct {
+	Origin     string
+	RPID       string
+	Flags      byte
+	SignCount  uint32 // incremented before each assertion
+	UserHandle []byte // returned with assertions; set from Register's argument
+
+	CredentialID []byte
+	key          *ecdsa.PrivateKey
+}
+
+// New returns an authenticator with a fresh key that asserts user presence
+// and verification for rpID on origin
+func New(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+	return &Authenticator{
+		Origin:       origin,
+		RPID:         rpID,
+		Flags:        FlagUserPresent | FlagUserVerified,
+		CredentialID: id,
+		key:          key,
+	}
+}
+
+// Register answers creation options with a "none" attestation
+func (a *Authenticator) Register(challenge, userHandle []byte) *webauthn.RegistrationResponse {
+	a.UserHandle = userHandle
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	var cose bytes.Buffer
+	writeMap(&cose, 5)
+	writeInt(&cose, 1) // kty: EC2
+	writeInt(&cose, 2)
+	writeInt(&cose, 3) // alg: ES256
+	writeInt(&cose, -7)
+	writeInt(&cose, -1) // crv: P-256
+	writeInt(&cose, 1)
+	writeInt(&cose, -2)
+	writeBytes(&cose, x)
+	writeInt(&cose, -3)
+	writeBytes(&cose, y)
+
+	authData := a.authData(a.Flags | flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, cose.Bytes()...)
+
+	var att bytes.Buffer
+	writeMap(&att, 3)
+	writeText(&att, "fmt")
+	writeText(&att, "none")
+	writeText(&att, "attStmt")
+	writeMap(&att, 0)
+	writeText(&att, "authData")
+	writeBytes(&att, authData)
+
+	resp := &webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", challenge)
+	resp.Response.AttestationObject = att.Bytes()
+	return resp
+}
+
+// Assert answers request options, signing over the authenticator data and
+// the client data hash
+func (a *Authenticator) Assert(challenge []byte) *webauthn.AssertionResponse {
+	a.SignCount++
+	authData := a.authData(a.Flags)
+	clientData := a.clientData("webauthn.get", challenge)
+
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.CredentialID),
+		RawID: a.CredentialID,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = a.UserHandle
+	return resp
+}
+
+// authData returns the fixed part of the authenticator data
+func (a *Authenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+// clientData returns CollectedClientData as the browser serializes it
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		panic("webauthntest: " + err.Error())
+	}
+	return data
+}
+
+// writeHead writes a CBOR initial byte and its argument in the shortest form
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n < 1<<8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(n))
+	case n < 1<<16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n < 1<<32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, v int64) {
+	if v >= 0 {
+		writeHead(buf, 0, uint64(v))
+		return
+	}
+	writeHead(buf, 1, uint64(-1-v))
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	writeHead(buf, 2, uint64(len(b)))
+	buf.Write(b)
+}
+
+func writeText(buf *bytes.Buffer, s string) {
+	writeHead(buf, 3, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func writeMap(buf *bytes.Buffer, pairs int) {
+	writeHead(buf, 5, uint64(pairs))
+}
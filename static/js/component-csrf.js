@@ -0,0 +1,40 @@
+/**
+ * Component CSRF — shares one CSRF token between the demo forms on a
+ * component showcase page.
+ *
+ * The server renders a single token per page for each form action. Tokens are
+ * single-use, so once any form spends it, a fresh token for the same action is
+ * fetched and handed to every form that posts there.
+ */
+(function() {
+    'use strict';
+
+    async function refresh(action) {
+        try {
+            const res = await fetch('/api/demo/csrf-token?action=' + encodeURIComponent(action), {
+                credentials: 'same-origin',
+                headers: { 'Accept': 'application/json' },
+            });
+            if (!res.ok) return;
+            const data = await res.json();
+            const token = data?.data?.token;
+            if (!token) return;
+
+            document.querySelectorAll('secure-form[csrf-token]').forEach(form => {
+                if (form.getAttribute('action') !== action) return;
+                form.setAttribute('csrf-token', token);
+                const hidden = form.querySelector('input[name="csrf_token"]');
+                if (hidden) hidden.value = token;
+            });
+        } catch {
+            // Non-critical: the next submission fails its CSRF check and a
+            // reload renders a fresh token.
+        }
+    }
+
+    document.addEventListener('secure-form-success', (event) => {
+        const form = event.target.closest?.('secure-form');
+        const action = form?.getAttribute('action');
+        if (action) refresh(action);
+    });
+})();
@@ -0,0 +1,27 @@
+(function() {
+'use strict';
+async function refresh(action) {
+try {
+const res = await fetch('/api/demo/csrf-token?action=' + encodeURIComponent(action), {
+credentials: 'same-origin',
+headers: { 'Accept': 'application/json' },
+});
+if (!res.ok) return;
+const data = await res.json();
+const token = data?.data?.token;
+if (!token) return;
+document.querySelectorAll('secure-form[csrf-token]').forEach(form => {
+if (form.getAttribute('action') !== action) return;
+form.setAttribute('csrf-token', token);
+const hidden = form.querySelector('input[name="csrf_token"]');
+if (hidden) hidden.value = token;
+});
+} catch {
+}
+}
+document.addEventListener('secure-form-success', (event) => {
+const form = event.target.closest?.('secure-form');
+const action = form?.getAttribute('action');
+if (action) refresh(action);
+});
+})();
\ No newline at end of file
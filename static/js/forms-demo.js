@@ -88,6 +88,18 @@ function handleInjectionBlocked(event) {
   body.appendChild(resetBtn);
 }
 
+// Re-sign the environment with the key epoch this page was rendered with
+// embedded, so the ID is covered by the signature. The server rejects a signed
+// envelope without the ID, or whose ID names a different key from the one that
+// verifies it, so a provider without sign() shows up as failed verification.
+async function withKeyId(form, telemetry) {
+  const provider = form.closest('secure-telemetry-provider');
+  const keyId = provider?.dataset.keyId;
+  const env = telemetry._env;
+  if (!keyId || !env?.signature || typeof provider.sign !== 'function') return telemetry;
+  return { ...telemetry, _env: await provider.sign({ ...env.environment, keyId }) };
+}
+
 async function handleDemoSubmit(event) {
   const form = event.target;
   const formId = form.id;
@@ -121,7 +133,7 @@ async function handleDemoSubmit(event) {
 
   // For the payment form, attach safe card identifiers from the
   // secure-card element. Full PAN and CVC are never present here.
-  const payload = { ...formData, _telemetry: telemetry };
+  const payload = { ...formData, _telemetry: await withKeyId(form, telemetry) };
   if (formId === 'demo-payment-form') {
     const cardEl = form.querySelector('secure-card');
     if (cardEl) {
@@ -171,7 +183,9 @@ async function handleDemoSubmit(event) {
  */
 async function refreshCSRFToken(form) {
   try {
-    const res = await fetch('/api/demo/csrf-token', {
+    // Signed tokens are bound to the form's action, so ask for one for this form.
+    const action = encodeURIComponent(form.getAttribute('action') ?? '');
+    const res = await fetch(`/api/demo/csrf-token?action=${action}`, {
       credentials: 'same-origin',
       headers: { 'Accept': 'application/json' },
     });
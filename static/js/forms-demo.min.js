@@ -57,6 +57,13 @@ body.innerHTML = '<p class="demo-response-placeholder">Submit the form to see th
 });
 body.appendChild(resetBtn);
 }
+async function withKeyId(form, telemetry) {
+const provider = form.closest('secure-telemetry-provider');
+const keyId = provider?.dataset.keyId;
+const env = telemetry._env;
+if (!keyId || !env?.signature || typeof provider.sign !== 'function') return telemetry;
+return { ...telemetry, _env: await provider.sign({ ...env.environment, keyId }) };
+}
 async function handleDemoSubmit(event) {
 const form = event.target;
 const formId = form.id;
@@ -74,7 +81,7 @@ form.querySelectorAll('secure-select[name]').forEach(sel => {
 const n = sel.getAttribute('name');
 if (n) formData[n] = sel.value;
 });
-const payload = { ...formData, _telemetry: telemetry };
+const payload = { ...formData, _telemetry: await withKeyId(form, telemetry) };
 if (formId === 'demo-payment-form') {
 const cardEl = form.querySelector('secure-card');
 if (cardEl) {
@@ -108,7 +115,8 @@ if (submitBtn) submitBtn.disabled = false;
 }
 async function refreshCSRFToken(form) {
 try {
-const res = await fetch('/api/demo/csrf-token', {
+const action = encodeURIComponent(form.getAttribute('action') ?? '');
+const res = await fetch(`/api/demo/csrf-token?action=${action}`, {
 credentials: 'same-origin',
 headers: { 'Accept': 'application/json' },
 });
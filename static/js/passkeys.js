@@ -0,0 +1,157 @@
+/**
+ * Passkeys — WebAuthn registration (profile page) and passwordless sign-in
+ * (login page).
+ *
+ * Each ceremony is two requests: begin returns the options for the browser
+ * and a CSRF token for finish; finish sends the authenticator's response back.
+ * Binary fields travel as unpadded base64url in both directions. CSRF tokens
+ * are single-use, so after a failure the button reloads the page for fresh ones.
+ *
+ * Buttons stay hidden unless the browser supports WebAuthn.
+ */
+(function() {
+    'use strict';
+
+    function toBase64URL(buffer) {
+        const bytes = new Uint8Array(buffer);
+        let binary = '';
+        for (let i = 0; i < bytes.length; i++) {
+            binary += String.fromCharCode(bytes[i]);
+        }
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function fromBase64URL(value) {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+        const bytes = new Uint8Array(binary.length);
+        for (let i = 0; i < binary.length; i++) {
+            bytes[i] = binary.charCodeAt(i);
+        }
+        return bytes.buffer;
+    }
+
+    async function postJSON(path, csrfToken, body) {
+        const response = await fetch(path, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken,
+            },
+            body: JSON.stringify(body || {}),
+        });
+        let data = null;
+        try {
+            data = await response.json();
+        } catch (_) {
+            // Non-JSON error pages fall through to the generic message
+        }
+        if (!response.ok || !data || !data.success) {
+            throw new Error((data && data.error) || 'Request failed');
+        }
+        return data.data;
+    }
+
+    function showError(message) {
+        const el = document.getElementById('passkey-error');
+        if (el) {
+            el.textContent = message;
+            el.hidden = false;
+        }
+    }
+
+    // The authenticator rejects or the user cancels with a DOMException; those
+    // get a neutral message rather than the browser's wording
+    function ceremonyMessage(error, fallback) {
+        if (error instanceof DOMException) {
+            return fallback;
+        }
+        return error.message || fallback;
+    }
+
+    async function register(button) {
+        const begin = await postJSON('/api/webauthn/register/begin', button.dataset.csrfToken);
+        const options = begin.options;
+        options.challenge = fromBase64URL(options.challenge);
+        options.user.id = fromBase64URL(options.user.id);
+        options.excludeCredentials = options.excludeCredentials.map(c => ({ ...c, id: fromBase64URL(c.id) }));
+
+        const credential = await navigator.credentials.create({ publicKey: options });
+
+        const nameInput = document.querySelector('secure-input[name="passkey_name"]');
+        await postJSON('/api/webauthn/register/finish', begin.csrfToken, {
+            name: nameInput && typeof nameInput.value === 'string' ? nameInput.value : '',
+            credential: {
+                id: credential.id,
+                rawId: toBase64URL(credential.rawId),
+                type: credential.type,
+                response: {
+                    clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+                    attestationObject: toBase64URL(credential.response.attestationObject),
+                },
+            },
+        });
+        window.location.reload();
+    }
+
+    async function login(button) {
+        const begin = await postJSON('/api/webauthn/login/begin', button.dataset.csrfToken);
+        const options = begin.options;
+        options.challenge = fromBase64URL(options.challenge);
+        options.allowCredentials = options.allowCredentials.map(c => ({ ...c, id: fromBase64URL(c.id) }));
+
+        const credential = await navigator.credentials.get({ publicKey: options });
+
+        const result = await postJSON('/api/webauthn/login/finish', begin.csrfToken, {
+            id: credential.id,
+            rawId: toBase64URL(credential.rawId),
+            type: credential.type,
+            response: {
+                clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+                authenticatorData: toBase64URL(credential.response.authenticatorData),
+                signature: toBase64URL(credential.response.signature),
+                userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : '',
+            },
+        });
+        window.location.assign(result.redirect);
+    }
+
+    function bind(id, ceremony, fallback) {
+        const button = document.getElementById(id);
+        if (!button) {
+            return;
+        }
+        button.hidden = false;
+
+        let spent = false;
+        button.addEventListener('click', async () => {
+            if (spent) {
+                window.location.reload();
+                return;
+            }
+            spent = true;
+            button.disabled = true;
+            try {
+                await ceremony(button);
+            } catch (error) {
+                showError(ceremonyMessage(error, fallback));
+                button.disabled = false;
+            }
+        });
+    }
+
+    function init() {
+        if (!window.PublicKeyCredential || !navigator.credentials) {
+            return;
+        }
+        bind('passkey-register', register, 'The passkey was not added. Click the button to try again.');
+        bind('passkey-login', login, 'Passkey sign-in was cancelled. Click the button to try again.');
+    }
+
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', init);
+    } else {
+        init();
+    }
+})();